@@ -0,0 +1,3 @@
+package gophermartv1
+
+//go:generate protoc -I ../.. --go_out=../../.. --go_opt=module=github.com/mkarulina/loyalty-system-service.git --go-grpc_out=../../.. --go-grpc_opt=module=github.com/mkarulina/loyalty-system-service.git gophermart/v1/gophermart.proto
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"log/slog"
+	"os"
+)
+
+const keysUsage = "usage: gophermart keys rotate"
+
+// runKeysCommand handles "gophermart keys ...". Rotating re-encrypts stored
+// data with the newest key; once it succeeds older keys can be removed
+// from the configuration. Session tokens are opaque and left as they are,
+// so users stay logged in.
+func runKeysCommand(args []string) {
+	if len(args) != 1 || args[0] != "rotate" {
+		fmt.Fprintln(os.Stderr, keysUsage)
+		os.Exit(2)
+	}
+
+	keys, err := encryption.LoadKeyring()
+	if err != nil {
+		fatal("cannot load encryption keys", err)
+	}
+
+	rotated, err := storage.RotateEncryptedData(encryption.NewWithKeyring(keys))
+	if err != nil {
+		slog.Error("key rotation failed", "rotated", rotated, "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("re-encrypted %d values with key %q\n", rotated, keys.ActiveID())
+}
@@ -1,65 +1,131 @@
 package main
 
 import (
-	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
+	"context"
+	"flag"
 	"github.com/mkarulina/loyalty-system-service.git/config"
 	"github.com/mkarulina/loyalty-system-service.git/internal/accrual"
 	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/grpcserver"
 	"github.com/mkarulina/loyalty-system-service.git/internal/handlers"
-	middleware2 "github.com/mkarulina/loyalty-system-service.git/internal/middleware"
+	"github.com/mkarulina/loyalty-system-service.git/internal/logging"
+	"github.com/mkarulina/loyalty-system-service.git/internal/metrics"
 	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"github.com/mkarulina/loyalty-system-service.git/internal/tracing"
 	"github.com/mkarulina/loyalty-system-service.git/sql"
 	"github.com/spf13/viper"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	_, err := config.LoadConfig("config")
 	if err != nil {
-		log.Fatal("cannot load config:", err)
+		fatal("cannot load config", err)
+	}
+	logging.Setup()
+
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "keys":
+			runKeysCommand(args[1:])
+		default:
+			slog.Error("unknown command", "command", args[0])
+			os.Exit(2)
+		}
+		return
+	}
+
+	if _, err := encryption.LoadKeyring(); err != nil {
+		fatal("cannot load encryption keys", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		fatal("cannot set up tracing", err)
+	}
+
+	if metricsAddress := viper.GetString("METRICS_ADDRESS"); metricsAddress != "" {
+		go func() {
+			if err := metrics.ListenAndServe(metricsAddress); err != nil {
+				fatal("metrics server failed", err)
+			}
+		}()
 	}
 
 	sql.RunMigration()
 	accrual.StartCron()
 
-	h := handlers.NewHandler(
-		storage.NewOrderStorage(),
-		storage.NewHistoryStorage(),
-		authentication.New(),
-	)
-
-	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-
-	r.Route("/api/", func(r chi.Router) {
-
-		r.Route("/user/register", func(r chi.Router) {
-			r.Use(middleware2.TokenHandle)
-			r.Post("/", h.RegisterHandler)
-		})
-
-		r.Route("/user/login", func(r chi.Router) {
-			r.Use(middleware2.TokenHandle)
-			r.Post("/", h.LoginHandler)
-		})
-
-		r.Route("/user/", func(r chi.Router) {
-			r.Use(middleware2.Auth)
-			r.Use(middleware2.GzipHandle)
-			r.Post("/orders", h.SendOrderHandler)                         //загрузка пользователем номера заказа для расчёта
-			r.Get("/orders", h.GetOrderHandler)                           //получение списка загруженных пользователем номеров заказов, статусов их обработки и информации о начислениях
-			r.Get("/balance", h.GetBalanceHandler)                        //получение текущего баланса счёта баллов лояльности пользователя
-			r.Post("/balance/withdraw", h.WithdrawHandler)                //запрос на списание баллов с накопительного счёта в счёт оплаты нового заказа
-			r.Get("/balance/withdrawals", h.GetWithdrawalsHistoryHandler) //получение информации о выводе средств с накопительного счёта пользователем
-		})
-	})
-
-	address := viper.GetString("RUN_ADDRESS")
-
-	if err := http.ListenAndServe(address, r); err != nil {
-		log.Fatal(err)
+	auth := authentication.New()
+	if err := authentication.BootstrapAdmin(auth); err != nil {
+		fatal("cannot bootstrap admin", err)
+	}
+
+	orderStg := storage.NewOrderStorage()
+	historyStg := storage.NewHistoryStorage()
+
+	h := handlers.NewHandler(orderStg, historyStg, auth)
+
+	// on SIGINT or SIGTERM the servers stop accepting requests and wait
+	// for the ones in flight, so that the spans still buffered can be
+	// flushed before exit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var servers sync.WaitGroup
+
+	if grpcAddress := viper.GetString("GRPC_ADDRESS"); grpcAddress != "" {
+		servers.Add(1)
+		go func() {
+			defer servers.Done()
+			if err := grpcserver.New(orderStg, historyStg, auth).ListenAndServe(ctx, grpcAddress); err != nil {
+				fatal("gRPC server failed", err)
+			}
+		}()
 	}
+
+	r, err := newRouter(h, auth)
+	if err != nil {
+		fatal("cannot build router", err)
+	}
+
+	srv := &http.Server{Addr: viper.GetString("RUN_ADDRESS"), Handler: r}
+	// Shutdown does not interrupt event streams, they have to end themselves
+	srv.RegisterOnShutdown(h.CloseStreams)
+
+	servers.Add(1)
+	go func() {
+		defer servers.Done()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("HTTP server shutdown", "error", err)
+		}
+	}()
+
+	slog.Info("HTTP API listening", "address", srv.Addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fatal("HTTP server failed", err)
+	}
+	servers.Wait()
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("can't flush spans", "error", err)
+	}
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
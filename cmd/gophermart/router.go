@@ -0,0 +1,147 @@
+package main
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/handlers"
+	"github.com/mkarulina/loyalty-system-service.git/internal/metrics"
+	middleware2 "github.com/mkarulina/loyalty-system-service.git/internal/middleware"
+	"github.com/mkarulina/loyalty-system-service.git/internal/openapi"
+	"github.com/mkarulina/loyalty-system-service.git/internal/tracing"
+	"github.com/spf13/viper"
+)
+
+// newRouter registers every route of the service. Each route must also be
+// described in internal/openapi/openapi.yaml.
+func newRouter(h handlers.Handler, auth authentication.Auth) (*chi.Mux, error) {
+	r := chi.NewRouter()
+	r.Use(middleware2.RequestID)
+	r.Use(tracing.Middleware)
+	r.Use(middleware2.Logger)
+	r.Use(metrics.Middleware)
+	r.Use(middleware.Recoverer)
+
+	if mode := viper.GetString("OPENAPI_VALIDATION"); mode != openapi.ValidateOff {
+		validator, err := openapi.Validator(mode)
+		if err != nil {
+			return nil, err
+		}
+		r.Use(validator)
+	}
+
+	// /api/v2 исправляет контракт v1: JSON в запросах и ответах, пустые
+	// массивы вместо 204, суммы в сотых долях балла целыми числами и
+	// ошибки только в формате application/problem+json
+	r.Route("/api/v2", func(r chi.Router) {
+		r.NotFound(h.NotFoundV2Handler)
+		r.MethodNotAllowed(h.MethodNotAllowedV2Handler)
+
+		r.With(middleware2.TokenHandle).Post("/user/register", h.RegisterHandler)        //регистрация пользователя
+		r.With(middleware2.TokenHandle).Post("/user/login", h.LoginHandler)              //аутентификация пользователя
+		r.With(middleware2.TokenHandle).Post("/user/login/2fa", h.LoginTwoFactorHandler) //ввод второго фактора
+
+		r.Route("/user/", func(r chi.Router) {
+			r.Use(middleware2.Auth)
+			r.Use(middleware2.GzipHandle)
+			r.Post("/orders", h.SendOrderV2Handler)                         //загрузка номера заказа в JSON, в ответе заказ
+			r.Get("/orders", h.GetOrdersV2Handler)                          //список заказов, пустой массив если заказов нет
+			r.Get("/balance", h.GetBalanceV2Handler)                        //баланс в сотых долях балла
+			r.Post("/balance/withdraw", h.WithdrawV2Handler)                //списание суммы в сотых долях балла, в ответе баланс
+			r.Get("/balance/withdrawals", h.GetWithdrawalsHistoryV2Handler) //история списаний, пустой массив если списаний нет
+		})
+	})
+
+	// v1: маршруты, у которых есть замена в /api/v2, помечены Deprecated
+	r.Route("/api/", func(r chi.Router) {
+
+		r.Get("/openapi.json", openapi.Handler) //описание API в формате OpenAPI 3
+
+		r.Route("/user/register", func(r chi.Router) {
+			r.Use(middleware2.Deprecated)
+			r.Use(middleware2.TokenHandle)
+			r.Post("/", h.RegisterHandler)
+		})
+
+		r.Route("/user/login", func(r chi.Router) {
+			r.Use(middleware2.Deprecated)
+			r.Use(middleware2.TokenHandle)
+			r.Post("/", h.LoginHandler)
+		})
+
+		r.Route("/user/login/2fa", func(r chi.Router) {
+			r.Use(middleware2.Deprecated)
+			r.Use(middleware2.TokenHandle)
+			r.Post("/", h.LoginTwoFactorHandler)
+		})
+
+		r.Route("/user/oidc", func(r chi.Router) {
+			r.Get("/login", h.OIDCLoginHandler) //вход через внешнего OIDC-провайдера
+			r.With(middleware2.TokenHandle).Get("/callback", h.OIDCCallbackHandler)
+		})
+
+		r.Route("/user/password/reset-request", func(r chi.Router) {
+			r.Post("/", h.PasswordResetRequestHandler)
+		})
+
+		r.Route("/user/password/reset", func(r chi.Router) {
+			r.Post("/", h.PasswordResetHandler)
+		})
+
+		r.Route("/user/", func(r chi.Router) {
+			r.Use(middleware2.Auth)
+			r.Use(middleware2.GzipHandle)
+			r.With(middleware2.Deprecated).Post("/orders", h.SendOrderHandler)                         //загрузка пользователем номера заказа для расчёта
+			r.Post("/orders/batch", h.SendOrdersBatchHandler)                                          //загрузка списка номеров заказов с результатом по каждому
+			r.With(middleware2.Deprecated).Get("/orders", h.GetOrderHandler)                           //получение списка загруженных пользователем номеров заказов, статусов их обработки и информации о начислениях
+			r.Get("/orders/{number}", h.GetOrderDetailHandler)                                         //заказ со временем смены статуса и списаниями по нему
+			r.With(middleware2.Deprecated).Get("/balance", h.GetBalanceHandler)                        //получение текущего баланса счёта баллов лояльности пользователя
+			r.Get("/balance/statement", h.GetStatementHandler)                                         //выписка с остатком после каждой операции, JSON или CSV
+			r.With(middleware2.Deprecated).Post("/balance/withdraw", h.WithdrawHandler)                //запрос на списание баллов с накопительного счёта в счёт оплаты нового заказа
+			r.With(middleware2.Deprecated).Get("/balance/withdrawals", h.GetWithdrawalsHistoryHandler) //получение информации о выводе средств с накопительного счёта пользователем
+			r.Post("/balance/withdrawals/{id}/cancel", h.CancelWithdrawalHandler)                      //отмена списания в течение WITHDRAWAL_CANCEL_WINDOW
+			r.Post("/balance/transfer", h.TransferHandler)                                             //перевод баллов другому пользователю
+			r.Post("/password", h.ChangePasswordHandler)                                               //смена пароля с отзывом остальных сессий
+			r.Post("/2fa/enroll", h.EnrollTwoFactorHandler)                                            //подключение двухфакторной аутентификации
+			r.Post("/2fa/confirm", h.ConfirmTwoFactorHandler)                                          //подтверждение первым кодом, выдача кодов восстановления
+			r.Get("/export", h.ExportHandler)                                                          //выгрузка персональных данных пользователя
+			r.Get("/partners", h.ListPartnerGrantsHandler)                                             //партнёры, которым выдан доступ
+			r.Put("/partners/{id}", h.GrantPartnerAccessHandler)                                       //выдача партнёру доступа по API-ключу
+			r.Delete("/partners/{id}", h.RevokePartnerAccessHandler)                                   //отзыв доступа партнёра
+		})
+
+		r.With(middleware2.Auth).Delete("/user", h.DeleteAccountHandler) //удаление (обезличивание) учётной записи
+		r.With(middleware2.Auth).Get("/user/events", h.EventsHandler)    //поток событий по заказам и балансу (SSE), без сжатия
+
+		r.Route("/partner/users/{login}", func(r chi.Router) {
+			r.Use(middleware2.APIKeyAuth(auth))
+			r.Use(middleware2.GzipHandle)
+			r.With(middleware2.RequireScope(authentication.ScopeOrdersWrite)).Post("/orders", h.SendOrderHandler)  //загрузка номера заказа от имени пользователя
+			r.With(middleware2.RequireScope(authentication.ScopeOrdersRead)).Get("/orders", h.GetOrderHandler)     //список заказов пользователя
+			r.With(middleware2.RequireScope(authentication.ScopeBalanceRead)).Get("/balance", h.GetBalanceHandler) //баланс пользователя
+		})
+
+		r.Route("/admin/", func(r chi.Router) {
+			r.Use(middleware2.Auth)
+			r.Use(middleware2.RequireRole(authentication.RoleSupport, authentication.RoleAdmin))
+			r.Use(middleware2.GzipHandle)
+			r.Get("/users", h.AdminFindUserHandler)                  //поиск пользователя по логину
+			r.Get("/users/{id}", h.AdminGetUserHandler)              //данные пользователя
+			r.Get("/users/{id}/orders", h.AdminGetUserOrdersHandler) //заказы пользователя
+			r.Get("/users/{id}/ledger", h.AdminGetUserLedgerHandler) //баланс, начисления и списания пользователя
+			r.Get("/transfers", h.AdminListTransfersHandler)         //переводы между пользователями для проверки на мошенничество
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware2.RequireRole(authentication.RoleAdmin))
+				r.Put("/users/{id}/role", h.AdminSetUserRoleHandler)                 //изменение роли пользователя
+				r.Post("/orders/{number}/reprocess", h.AdminReprocessOrderHandler)   //повторная отправка заказа в систему расчёта
+				r.Post("/withdrawals/{id}/reverse", h.AdminReverseWithdrawalHandler) //отмена списания без ограничения по сроку
+				r.Post("/api-keys", h.CreateAPIKeyHandler)                           //выпуск API-ключа партнёра
+				r.Get("/api-keys", h.ListAPIKeysHandler)                             //список API-ключей и их использование
+				r.Delete("/api-keys/{id}", h.RevokeAPIKeyHandler)                    //отзыв API-ключа
+			})
+		})
+	})
+
+	return r, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/golang/mock/gomock"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/handlers"
+	"github.com/mkarulina/loyalty-system-service.git/internal/openapi"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func testRouter(t *testing.T, mode string) *chi.Mux {
+	viper.Set("OPENAPI_VALIDATION", mode)
+	t.Cleanup(func() { viper.Set("OPENAPI_VALIDATION", openapi.ValidateOff) })
+
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	auth := mock_authentication.NewMockAuth(ctrl)
+	h := handlers.NewHandler(mock_storage.NewMockOrderStorage(ctrl), mock_storage.NewMockHistoryStorage(ctrl), auth)
+
+	r, err := newRouter(h, auth)
+	require.NoError(t, err)
+	return r
+}
+
+var repeatedSlashes = regexp.MustCompile(`/{2,}`)
+
+// routePath turns a chi pattern into the path template used in the spec:
+// sub-routers leave doubled and trailing slashes in walked patterns.
+func routePath(pattern string) string {
+	path := repeatedSlashes.ReplaceAllString(pattern, "/")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+func Test_router_matchesSpec(t *testing.T) {
+	spec, err := openapi.Spec()
+	require.NoError(t, err)
+
+	routed := map[string]bool{}
+	err = chi.Walk(testRouter(t, openapi.ValidateOff), func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routed[method+" "+routePath(route)] = true
+		return nil
+	})
+	require.NoError(t, err)
+
+	described := map[string]bool{}
+	for path, item := range spec.Paths {
+		for method := range item.Operations() {
+			described[method+" "+path] = true
+		}
+	}
+
+	var undescribed, unrouted []string
+	for route := range routed {
+		if !described[route] {
+			undescribed = append(undescribed, route)
+		}
+	}
+	for route := range described {
+		if !routed[route] {
+			unrouted = append(unrouted, route)
+		}
+	}
+	sort.Strings(undescribed)
+	sort.Strings(unrouted)
+
+	require.Empty(t, undescribed, "routes missing from internal/openapi/openapi.yaml")
+	require.Empty(t, unrouted, "spec describes routes the router does not serve")
+}
+
+func Test_router_openAPIDocument(t *testing.T) {
+	rec := httptest.NewRecorder()
+	testRouter(t, openapi.ValidateAll).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	doc := struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	require.Equal(t, "3.0.3", doc.OpenAPI)
+	require.Contains(t, doc.Paths, "/api/user/orders")
+}
+
+func Test_router_validatesRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		wantField   string
+	}{
+		{
+			name:        "missing field",
+			method:      http.MethodPost,
+			target:      "/api/user/register",
+			contentType: "application/json",
+			body:        `{"login":"alice1"}`,
+			wantField:   "password",
+		},
+		{
+			name:        "wrong type",
+			method:      http.MethodPost,
+			target:      "/api/user/login",
+			contentType: "application/json",
+			body:        `{"login":"alice1","password":42}`,
+			wantField:   "password",
+		},
+		{
+			name:        "wrong content type",
+			method:      http.MethodPost,
+			target:      "/api/user/password/reset-request",
+			contentType: "text/plain",
+			body:        "alice1",
+			wantField:   "body",
+		},
+		{
+			name:      "missing query parameter",
+			method:    http.MethodGet,
+			target:    "/api/admin/users",
+			wantField: "login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			rec := httptest.NewRecorder()
+			testRouter(t, openapi.ValidateRequests).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			require.Equal(t, http.StatusBadRequest, result.StatusCode)
+			require.Equal(t, problem.ContentType, result.Header.Get("Content-Type"))
+
+			details := problem.Details{}
+			require.NoError(t, json.Unmarshal(body, &details))
+			require.Equal(t, problem.ValidationFailed.Code, details.Code)
+			require.NotEmpty(t, details.Errors)
+			require.Equal(t, tt.wantField, details.Errors[0].Field)
+		})
+	}
+}
+
+func Test_router_versions(t *testing.T) {
+	r := testRouter(t, openapi.ValidateOff)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/user/register", nil))
+	require.Equal(t, "true", rec.Header().Get("Deprecation"))
+	require.Equal(t, `</api/v2/user/register>; rel="successor-version"`, rec.Header().Get("Link"))
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/user/password/reset", nil))
+	require.Empty(t, rec.Header().Get("Deprecation"))
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v2/user/balance", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Empty(t, rec.Header().Get("Deprecation"))
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v2/unknown", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Equal(t, problem.ContentType, rec.Header().Get("Content-Type"))
+}
@@ -3,13 +3,14 @@ package config
 import (
 	"flag"
 	"github.com/spf13/viper"
-	"log"
+	"log/slog"
 )
 
 type Config struct {
 	runAddress     string `yaml:"RUN_ADDRESS"`
 	dbAddress      string `yaml:"DATABASE_URI"`
 	accrualAddress string `yaml:"ACCRUAL_SYSTEM_ADDRESS"`
+	keyFile        string `yaml:"ENCRYPTION_KEY_FILE"`
 }
 
 func LoadConfig(path string) (config *Config, err error) {
@@ -22,13 +23,14 @@ func LoadConfig(path string) (config *Config, err error) {
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err != nil {
-		log.Println(err)
+		slog.Error("can't read config", "error", err)
 		return conf, err
 	}
 
 	flag.StringVar(&conf.runAddress, "a", ":8080", "port to listen on")
 	flag.StringVar(&conf.dbAddress, "d", "postgresql://localhost:5432/postgres", "data base address")
 	flag.StringVar(&conf.accrualAddress, "r", ":8090", "accrual system address")
+	flag.StringVar(&conf.keyFile, "k", "", "encryption key file")
 
 	flag.Parse()
 
@@ -40,6 +42,8 @@ func LoadConfig(path string) (config *Config, err error) {
 			viper.Set("DATABASE_URI", &conf.dbAddress)
 		case "r":
 			viper.Set("ACCRUAL_SYSTEM_ADDRESS", &conf.accrualAddress)
+		case "k":
+			viper.Set("ENCRYPTION_KEY_FILE", &conf.keyFile)
 		}
 	})
 
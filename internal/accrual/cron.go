@@ -1,15 +1,36 @@
 package accrual
 
 import (
+	"context"
 	"encoding/json"
+	"github.com/mkarulina/loyalty-system-service.git/internal/metrics"
 	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"github.com/mkarulina/loyalty-system-service.git/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/robfig/cron"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+const defaultEventsRetention = 30 * 24 * time.Hour
+
+// eventsRetention is how long the user events are kept for resuming
+// streams.
+func eventsRetention() time.Duration {
+	if retention := viper.GetDuration("EVENTS_RETENTION"); retention > 0 {
+		return retention
+	}
+	return defaultEventsRetention
+}
+
 func StartCron() {
 	c := cron.New()
 	s := storage.NewOrderStorage()
@@ -17,6 +38,9 @@ func StartCron() {
 	c.AddFunc("@every 10s", func() {
 		GetOrdersStatus(s)
 	})
+	c.AddFunc("@every 1h", func() {
+		PruneUserEvents(s)
+	})
 
 	c.Start()
 }
@@ -29,38 +53,48 @@ func GetOrdersStatus(s storage.OrderStorage) {
 	}
 	var ordersStatus []storage.Order
 
+	// every cycle is a trace of its own
+	ctx, span := tracing.Tracer().Start(context.Background(), "accrual.poll")
+	defer span.End()
+
+	defer updateOrdersGauge(ctx, s)
+	timer := prometheus.NewTimer(metrics.AccrualPollDuration)
+	defer timer.ObserveDuration()
+
 	accrualAddress := viper.GetString("ACCRUAL_SYSTEM_ADDRESS")
 
-	orders, err := s.GetUnprocessedOrders()
+	orders, err := s.GetUnprocessedOrders(ctx)
 	if err != nil {
-		log.Println(err)
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "can't get unprocessed orders", "error", err)
 	}
+	span.SetAttributes(attribute.Int("accrual.orders", len(orders)))
 
 	for _, order := range orders {
-		response, err := http.Get(accrualAddress + "/api/orders/" + order)
+		response, err := requestOrder(ctx, accrualAddress, order)
 		if err != nil {
-			log.Println(err)
+			metrics.AccrualResponses.WithLabelValues("error").Inc()
+			slog.WarnContext(ctx, "accrual request failed", "order", order, "error", err)
+			continue
 		}
+		metrics.AccrualResponses.WithLabelValues(strconv.Itoa(response.StatusCode)).Inc()
 
-		switch response.StatusCode {
-		case http.StatusInternalServerError:
-			log.Println("accrual response code: ", http.StatusInternalServerError)
-		case http.StatusTooManyRequests:
-			log.Println("accrual response code: ", http.StatusTooManyRequests)
-		case http.StatusNoContent:
-			log.Println("accrual response code: ", http.StatusNoContent)
+		if response.StatusCode != http.StatusOK {
+			slog.WarnContext(ctx, "unexpected accrual response", "order", order, "code", response.StatusCode)
+			response.Body.Close()
+			continue
 		}
 
 		body, err := io.ReadAll(response.Body)
 		if err != nil {
-			log.Println(err)
+			slog.WarnContext(ctx, "can't read accrual response", "order", order, "error", err)
 		}
 		response.Body.Close()
 
 		data := accrualResp{}
 		err = json.Unmarshal(body, &data)
 		if err != nil {
-			log.Println(err)
+			slog.WarnContext(ctx, "can't decode accrual response", "order", order, "error", err)
 		}
 
 		orderStatus := storage.Order{
@@ -72,8 +106,71 @@ func GetOrdersStatus(s storage.OrderStorage) {
 		ordersStatus = append(ordersStatus, orderStatus)
 	}
 
-	err = s.UpdateOrdersStatus(ordersStatus)
+	err = s.UpdateOrdersStatus(ctx, ordersStatus)
+	if err != nil {
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "can't update orders", "error", err)
+	}
+}
+
+// PruneUserEvents deletes the user events older than EVENTS_RETENTION.
+func PruneUserEvents(s storage.OrderStorage) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "events.prune")
+	defer span.End()
+
+	deleted, err := s.PruneUserEvents(ctx, time.Now().Add(-eventsRetention()))
+	if err != nil {
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "can't prune user events", "error", err)
+		return
+	}
+	span.SetAttributes(attribute.Int64("events.deleted", deleted))
+}
+
+// requestOrder asks the accrual system about the order in a client span,
+// passing the trace on in the traceparent header. The span ends with the
+// response headers.
+func requestOrder(ctx context.Context, accrualAddress string, order string) (*http.Response, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "GET /api/orders/{number}", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, accrualAddress+"/api/orders/"+order, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "")
+		return nil, err
+	}
+	span.SetAttributes(
+		semconv.HTTPRequestMethodKey.String(http.MethodGet),
+		semconv.URLFull(req.URL.String()),
+	)
+	tracing.Inject(ctx, req.Header)
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "")
+		return nil, err
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(response.StatusCode))
+	if response.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(response.StatusCode))
+	}
+	return response, nil
+}
+
+// updateOrdersGauge replaces the orders by status metric with the current
+// counts.
+func updateOrdersGauge(ctx context.Context, s storage.OrderStorage) {
+	counts, err := s.CountOrdersByStatus(ctx)
 	if err != nil {
-		log.Println("order update error: ", err)
+		slog.ErrorContext(ctx, "can't count orders", "error", err)
+		return
+	}
+
+	metrics.Orders.Reset()
+	for status, count := range counts {
+		metrics.Orders.WithLabelValues(status).Set(float64(count))
 	}
 }
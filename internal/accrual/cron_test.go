@@ -0,0 +1,109 @@
+package accrual
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/mkarulina/loyalty-system-service.git/internal/metrics"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetOrdersStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	accrualSystem := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/orders/12345678903":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"12345678903","status":"PROCESSED","accrual":500}`))
+		case "/api/orders/2377225624":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer accrualSystem.Close()
+
+	viper.Set("ACCRUAL_SYSTEM_ADDRESS", accrualSystem.URL)
+	t.Cleanup(viper.Reset)
+
+	ok := testutil.ToFloat64(metrics.AccrualResponses.WithLabelValues("200"))
+	tooMany := testutil.ToFloat64(metrics.AccrualResponses.WithLabelValues("429"))
+	failed := testutil.ToFloat64(metrics.AccrualResponses.WithLabelValues("500"))
+
+	s := mock_storage.NewMockOrderStorage(ctrl)
+	s.EXPECT().GetUnprocessedOrders(gomock.Any()).Return([]string{"12345678903", "2377225624", "4561261212345467"}, nil)
+	s.EXPECT().UpdateOrdersStatus(gomock.Any(), []storage.Order{{Number: "12345678903", Status: "PROCESSED", Accrual: 500}}).Return(nil)
+	s.EXPECT().CountOrdersByStatus(gomock.Any()).Return(map[string]int{"PROCESSED": 3, "NEW": 1}, nil)
+
+	GetOrdersStatus(s)
+
+	require.Equal(t, ok+1, testutil.ToFloat64(metrics.AccrualResponses.WithLabelValues("200")))
+	require.Equal(t, tooMany+1, testutil.ToFloat64(metrics.AccrualResponses.WithLabelValues("429")))
+	require.Equal(t, failed+1, testutil.ToFloat64(metrics.AccrualResponses.WithLabelValues("500")))
+	require.Equal(t, float64(3), testutil.ToFloat64(metrics.Orders.WithLabelValues("PROCESSED")))
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.Orders.WithLabelValues("NEW")))
+}
+
+func Test_requestOrder(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	_, err := tracing.Setup(context.Background())
+	require.NoError(t, err)
+
+	var traceparent string
+	accrualSystem := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer accrualSystem.Close()
+
+	ctx, poll := tracing.Tracer().Start(context.Background(), "accrual.poll")
+	response, err := requestOrder(ctx, accrualSystem.URL, "12345678903")
+	require.NoError(t, err)
+	response.Body.Close()
+	poll.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	client := spans[0]
+	require.Equal(t, "GET /api/orders/{number}", client.Name())
+	require.Equal(t, trace.SpanKindClient, client.SpanKind())
+	require.Equal(t, poll.SpanContext().SpanID(), client.Parent().SpanID())
+	require.Contains(t, client.Attributes(), semconv.HTTPResponseStatusCode(http.StatusNoContent))
+
+	sc := client.SpanContext()
+	require.Equal(t, "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01", traceparent)
+}
+
+func TestPruneUserEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	viper.Set("EVENTS_RETENTION", "24h")
+	t.Cleanup(viper.Reset)
+
+	s := mock_storage.NewMockOrderStorage(ctrl)
+	s.EXPECT().PruneUserEvents(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, before time.Time) (int64, error) {
+		require.WithinDuration(t, time.Now().Add(-24*time.Hour), before, time.Minute)
+		return 3, nil
+	})
+
+	PruneUserEvents(s)
+}
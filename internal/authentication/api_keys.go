@@ -0,0 +1,394 @@
+package authentication
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"github.com/spf13/viper"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeOrdersRead  = "orders:read"
+	ScopeOrdersWrite = "orders:write"
+	ScopeBalanceRead = "balance:read"
+
+	defaultAPIKeyMaxSkew = 5 * time.Minute
+)
+
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeOrdersRead, ScopeOrdersWrite, ScopeBalanceRead:
+		return true
+	}
+	return false
+}
+
+// APIKey is a credential of a partner integration. Requests are signed with
+// HMAC, so the server needs the secret itself: it is stored encrypted with
+// the keyring rather than hashed, and is covered by key rotation.
+type APIKey struct {
+	ID         string
+	Name       string
+	Secret     string
+	Scopes     []string
+	CreatedBy  string
+	CreatedAt  time.Time
+	RevokedAt  *time.Time
+	LastUsedAt *time.Time
+	UsageCount int64
+}
+
+// APIKeyGrant is the consent of a user to a partner key acting for them.
+type APIKeyGrant struct {
+	APIKeyID  string
+	Name      string
+	Scopes    []string
+	CreatedAt time.Time
+}
+
+func APIKeyMaxSkew() time.Duration {
+	if skew := viper.GetDuration("API_KEY_MAX_SKEW"); skew > 0 {
+		return skew
+	}
+	return defaultAPIKeyMaxSkew
+}
+
+// SignRequest computes the hex encoded HMAC-SHA256 signature of a request:
+// the method, the request URI, the SHA-256 of the body and the unix
+// timestamp, separated by newlines.
+func SignRequest(secret []byte, method string, requestURI string, body []byte, timestamp string) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.ToUpper(method) + "\n" + requestURI + "\n" + hex.EncodeToString(bodyHash[:]) + "\n" + timestamp))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *auth) CreateAPIKey(key APIKey) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err = db.ExecContext(
+		ctx,
+		"INSERT INTO api_keys (id, name, secret, scopes, created_by) VALUES ($1, $2, $3, $4, $5)",
+		key.ID, key.Name, key.Secret, strings.Join(key.Scopes, ","), key.CreatedBy,
+	)
+	return err
+}
+
+func (a *auth) GetAPIKey(id string) (*APIKey, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key, err := scanAPIKey(db.QueryRowContext(
+		ctx,
+		"SELECT id, name, secret, scopes, created_by, created_at, revoked_at, last_used_at, usage_count FROM api_keys WHERE id = $1",
+		id,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns every key without its secret.
+func (a *auth) ListAPIKeys() ([]APIKey, error) {
+	var keys []APIKey
+
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(
+		ctx,
+		"SELECT id, name, '', scopes, created_by, created_at, revoked_at, last_used_at, usage_count FROM api_keys ORDER BY created_at",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (a *auth) RevokeAPIKey(id string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result, err := db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (a *auth) TrackAPIKeyUsage(id string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = now(), usage_count = usage_count + 1 WHERE id = $1", id)
+	return err
+}
+
+// UseAPIKeySignature records the signature of a request and reports
+// whether it was seen for the first time. The signature covers the
+// timestamp, so it only has to be remembered until expiresAt, when the
+// timestamp is too old to be accepted anyway.
+func (a *auth) UseAPIKeySignature(id string, signature string, expiresAt time.Time) (bool, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = db.ExecContext(ctx, "DELETE FROM api_key_requests WHERE expires_at < now()")
+	if err != nil {
+		return false, err
+	}
+
+	result, err := db.ExecContext(
+		ctx,
+		"INSERT INTO api_key_requests (api_key_id, signature, expires_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		id, signature, expiresAt.UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// GrantAPIKeyAccess lets the partner key act for the user. Granting it
+// again is a no-op.
+func (a *auth) GrantAPIKeyAccess(id string, userID string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result, err := db.ExecContext(
+		ctx,
+		"INSERT INTO api_key_grants (api_key_id, user_id) SELECT id, $2 FROM api_keys WHERE id = $1 AND revoked_at IS NULL ON CONFLICT DO NOTHING",
+		id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return nil
+	}
+
+	granted, err := hasAPIKeyAccess(ctx, db, id, userID)
+	if err != nil {
+		return err
+	}
+	if !granted {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (a *auth) RevokeAPIKeyAccess(id string, userID string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result, err := db.ExecContext(ctx, "DELETE FROM api_key_grants WHERE api_key_id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (a *auth) HasAPIKeyAccess(id string, userID string) (bool, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return hasAPIKeyAccess(ctx, db, id, userID)
+}
+
+func hasAPIKeyAccess(ctx context.Context, db *sql.DB, id string, userID string) (bool, error) {
+	var granted bool
+
+	err := db.QueryRowContext(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM api_key_grants WHERE api_key_id = $1 AND user_id = $2)",
+		id, userID,
+	).Scan(&granted)
+
+	return granted, err
+}
+
+// ListAPIKeyGrants returns the partner keys the user has granted access to,
+// revoked keys left out.
+func (a *auth) ListAPIKeyGrants(userID string) ([]APIKeyGrant, error) {
+	var grants []APIKeyGrant
+
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(
+		ctx,
+		"SELECT k.id, k.name, k.scopes, g.created_at FROM api_key_grants g JOIN api_keys k ON k.id = g.api_key_id WHERE g.user_id = $1 AND k.revoked_at IS NULL ORDER BY g.created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var grant APIKeyGrant
+		var scopes string
+
+		if err := rows.Scan(&grant.APIKeyID, &grant.Name, &scopes, &grant.CreatedAt); err != nil {
+			return nil, err
+		}
+		if scopes != "" {
+			grant.Scopes = strings.Split(scopes, ",")
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var scopes string
+	var revokedAt, lastUsedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.Name, &key.Secret, &scopes, &key.CreatedBy, &key.CreatedAt, &revokedAt, &lastUsedAt, &key.UsageCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &key, nil
+}
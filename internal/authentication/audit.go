@@ -0,0 +1,149 @@
+package authentication
+
+import (
+	"context"
+	"database/sql"
+	"github.com/spf13/viper"
+	"time"
+)
+
+const (
+	AuditDataExport      = "data_export"
+	AuditAccountDeletion = "account_deletion"
+	// AuditLoginRenamed is written by the migration folding logins for a
+	// user whose login collided with another one after case folding.
+	AuditLoginRenamed = "login_renamed"
+)
+
+// AuditRecord notes an action taken on the personal data of UserID. Actor
+// is the id of the user who did it.
+type AuditRecord struct {
+	ID        string
+	UserID    string
+	Actor     string
+	Action    string
+	Details   string
+	CreatedAt time.Time
+}
+
+func addAuditRecord(ctx context.Context, db execer, record AuditRecord) error {
+	_, err := db.ExecContext(
+		ctx,
+		"INSERT INTO audit_log (user_id, actor, action, details) VALUES ($1, $2, $3, $4)",
+		record.UserID, record.Actor, record.Action, record.Details,
+	)
+	return err
+}
+
+func (a *auth) AddAuditRecord(record AuditRecord) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return addAuditRecord(ctx, db, record)
+}
+
+func (a *auth) ListAuditRecords(userID string) ([]AuditRecord, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(
+		ctx,
+		"SELECT id, user_id, actor, action, details, created_at FROM audit_log WHERE user_id = $1 ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []AuditRecord{}
+	for rows.Next() {
+		var r AuditRecord
+		if err := rows.Scan(&r.ID, &r.UserID, &r.Actor, &r.Action, &r.Details, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+// AnonymizeUser deletes the account: the login is replaced with the
+// pseudonym, encoded like any login, credentials, second factors, linked
+// identities and partner grants are dropped and every session is revoked.
+// The user id stays, so orders and withdrawals remain in the books under
+// it. The deletion is audited in the same transaction.
+func (a *auth) AnonymizeUser(userID string, pseudonym string, record AuditRecord) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		"UPDATE users SET login = $1, password = '', totp_secret = NULL, totp_enabled = false, deleted_at = now() WHERE id = $2::bigint AND deleted_at IS NULL",
+		pseudonym, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrUserNotFound
+	}
+
+	for _, query := range []string{
+		"DELETE FROM recovery_codes WHERE user_id = $1",
+		"DELETE FROM login_challenges WHERE user_id = $1",
+		"DELETE FROM password_resets WHERE user_id = $1",
+		"DELETE FROM user_identities WHERE user_id = $1",
+		"DELETE FROM api_key_grants WHERE user_id = $1",
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	if err := revokeSessions(ctx, tx, userID, ""); err != nil {
+		return err
+	}
+
+	if err := addAuditRecord(ctx, tx, record); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -4,25 +4,69 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"github.com/jackc/pgerrcode"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
 	"github.com/spf13/viper"
 	"sync"
 	"time"
 )
 
 type User struct {
-	Token    string
-	Login    string
-	Password string
+	ID    string
+	Token string
+	Login string
+	// Password is the plain password on the way in; the storage keeps only
+	// its hash and never returns it.
+	Password  string
+	Role      string
+	SessionID string
+	TwoFactor bool
 }
 
 type Auth interface {
 	AddUserInfoToTable(user User) error
-	CheckUserData(user User) error
-	CheckTokenIsValid(token string) (bool, error)
-	GetUserLoginByToken(token string, db *sql.DB) (string, error)
+	CheckUserData(user User) (*User, error)
+	CreateSession(userID string, token string) error
+	GetUserByToken(token string) (*User, error)
+	GetUserByID(id string) (*User, error)
+	GetUserByLogin(login string) (*User, error)
+	SetUserRole(id string, role string) error
+	EnsureAdmin(user User) error
+	ChangePassword(userID string, currentPassword string, newPassword string, keepSessionID string) error
+	RevokeSessions(userID string, exceptSessionID string) error
+	CreatePasswordReset(userID string, tokenHash string, ttl time.Duration) error
+	ResetPassword(tokenHash string, newPassword string) error
+	EnrollTOTP(userID string, encSecret string) error
+	GetTOTP(userID string) (string, bool, error)
+	ConfirmTOTP(userID string, counter int64, recoveryCodeHashes []string) error
+	UseRecoveryCode(userID string, codeHash string) (bool, error)
+	AcceptTOTPCounter(userID string, counter int64) (bool, error)
+	CreateLoginChallenge(userID string, challengeHash string, token string, ttl time.Duration) error
+	AttemptLoginChallenge(challengeHash string, token string) (string, error)
+	CompleteLoginChallenge(challengeHash string, token string) error
+	CreateAPIKey(key APIKey) error
+	GetAPIKey(id string) (*APIKey, error)
+	ListAPIKeys() ([]APIKey, error)
+	RevokeAPIKey(id string) error
+	TrackAPIKeyUsage(id string) error
+	UseAPIKeySignature(id string, signature string, expiresAt time.Time) (bool, error)
+	GrantAPIKeyAccess(id string, userID string) error
+	RevokeAPIKeyAccess(id string, userID string) error
+	HasAPIKeyAccess(id string, userID string) (bool, error)
+	ListAPIKeyGrants(userID string) ([]APIKeyGrant, error)
+	GetUserByIdentity(issuer string, subject string) (*User, error)
+	LinkIdentity(userID string, issuer string, subject string) error
+	CreateUserWithIdentity(user User, issuer string, subject string) (string, error)
+	ListSessions(userID string) ([]Session, error)
+	AddAuditRecord(record AuditRecord) error
+	ListAuditRecords(userID string) ([]AuditRecord, error)
+	AnonymizeUser(userID string, pseudonym string, record AuditRecord) error
 }
 
+// insertUserQuery also refuses a login that a row stored before migration
+// 000020 may hold in the truncated form, so that the row can take the full
+// form once its owner logs in.
+const insertUserQuery = "INSERT INTO users (login, password) SELECT $1, $2 WHERE NOT EXISTS (SELECT 1 FROM users WHERE legacy_encoding AND login = $3) ON CONFLICT DO NOTHING RETURNING id"
+
 type auth struct {
 	mu sync.RWMutex
 }
@@ -35,6 +79,11 @@ func New() Auth {
 }
 
 func (a *auth) AddUserInfoToTable(user User) error {
+	hash, err := HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
 	dbAddress := viper.GetString("DATABASE_URI")
 
 	db, err := sql.Open("pgx", dbAddress)
@@ -49,90 +98,244 @@ func (a *auth) AddUserInfoToTable(user User) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	result, err := db.ExecContext(
-		ctx,
-		"INSERT INTO users (token, login, password) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
-		user.Token, user.Login, user.Password,
-	)
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return errors.New(pgerrcode.UniqueViolation)
+	var userID string
+
+	err = tx.QueryRowContext(ctx, insertUserQuery, user.Login, hash, encryption.LegacyEncoding(user.Login)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrLoginTaken
+		}
+		return err
 	}
 
-	return nil
+	if err := createSession(ctx, tx, userID, user.Token); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (a *auth) CheckUserData(user User) error {
+// CheckUserData verifies the login and password and returns the user.
+// It does not start a session: that is up to the caller, since users with
+// two-factor authentication have to pass a second step first. A user
+// stored in the truncated encoding or with a hash of the encoded password
+// gets the full encoding and a hash of the password itself here.
+func (a *auth) CheckUserData(user User) (*User, error) {
 	dbAddress := viper.GetString("DATABASE_URI")
 
 	db, err := sql.Open("pgx", dbAddress)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer db.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := db.ExecContext(ctx, "SELECT * FROM users WHERE login = $1 AND password = $2", user.Login, user.Password)
+	found := User{}
+	var hash string
+	var encoded, legacy bool
+
+	err = db.QueryRowContext(
+		ctx,
+		`SELECT id, login, role, totp_enabled, password, password_encoded, legacy_encoding FROM users
+WHERE (login = $1 OR (legacy_encoding AND login = $2)) AND deleted_at IS NULL
+ORDER BY legacy_encoding LIMIT 1`,
+		user.Login, encryption.LegacyEncoding(user.Login),
+	).Scan(&found.ID, &found.Login, &found.Role, &found.TwoFactor, &hash, &encoded, &legacy)
 	if err != nil {
-		return err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
 	}
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return errors.New("user not registered")
+	if !passwordMatches(hash, encoded, legacy, user.Password) {
+		return nil, ErrInvalidCredentials
 	}
 
-	a.mu.Lock()
-	defer a.mu.Unlock()
+	if encoded || legacy {
+		newHash, err := HashPassword(user.Password)
+		if err != nil {
+			return nil, err
+		}
+		_, err = db.ExecContext(
+			ctx,
+			"UPDATE users SET login = $1, password = $2, legacy_encoding = false, password_encoded = false WHERE id = $3::bigint",
+			user.Login, newHash, found.ID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		found.Login = user.Login
+	}
+
+	return &found, nil
+}
 
-	_, err = db.ExecContext(ctx, "UPDATE users SET token = $1 WHERE login = $2 AND password = $3", user.Token, user.Login, user.Password)
+func (a *auth) GetUserByToken(token string) (*User, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer db.Close()
 
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user := User{Token: token}
+
+	err = db.QueryRowContext(
+		ctx,
+		"SELECT u.id, u.login, u.role, u.totp_enabled, s.id FROM sessions s JOIN users u ON u.id = s.user_id::bigint WHERE s.token = $1 AND s.revoked_at IS NULL",
+		token,
+	).Scan(&user.ID, &user.Login, &user.Role, &user.TwoFactor, &user.SessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &user, nil
 }
 
-func (a *auth) CheckTokenIsValid(token string) (bool, error) {
+func (a *auth) GetUserByID(id string) (*User, error) {
 	dbAddress := viper.GetString("DATABASE_URI")
 
 	db, err := sql.Open("pgx", dbAddress)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	defer db.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := db.ExecContext(ctx, "SELECT * FROM users WHERE token = $1", token)
+	user := User{}
+
+	err = db.QueryRowContext(ctx, "SELECT id, login, role FROM users WHERE id = $1::bigint", id).Scan(&user.ID, &user.Login, &user.Role)
 	if err != nil {
-		return false, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return false, nil
+	return &user, nil
+}
+
+// GetUserByLogin expects the login in the same encoded form it is stored in.
+// A user still stored in the truncated form is found by that form.
+func (a *auth) GetUserByLogin(login string) (*User, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user := User{}
+
+	err = db.QueryRowContext(
+		ctx,
+		"SELECT id, login, role FROM users WHERE login = $1 OR (legacy_encoding AND login = $2) ORDER BY legacy_encoding LIMIT 1",
+		login, encryption.LegacyEncoding(login),
+	).Scan(&user.ID, &user.Login, &user.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	return true, nil
+	return &user, nil
 }
 
-func (a *auth) GetUserLoginByToken(token string, db *sql.DB) (string, error) {
-	var login string
+func (a *auth) SetUserRole(id string, role string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	loginRow := db.QueryRowContext(ctx, "SELECT login FROM users WHERE token = $1", token)
-	if loginRow == nil {
-		return "", errors.New("user not found")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result, err := db.ExecContext(ctx, "UPDATE users SET role = $1 WHERE id = $2::bigint", role, id)
+	if err != nil {
+		return err
 	}
-	err := loginRow.Scan(&login)
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// EnsureAdmin creates the user with the admin role. An existing admin with
+// the same login is left untouched; an existing regular user makes it fail
+// with ErrLoginTaken.
+func (a *auth) EnsureAdmin(user User) error {
+	hash, err := HashPassword(user.Password)
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// the admin created before migration 000020 takes the full login; the
+	// password stays legacy until the admin logs in
+	_, err = db.ExecContext(
+		ctx,
+		"UPDATE users SET login = $1 WHERE legacy_encoding AND login = $2 AND role = $3",
+		user.Login, encryption.LegacyEncoding(user.Login), RoleAdmin,
+	)
+	if err != nil {
+		return err
+	}
+
+	// an account that somebody registered under the admin login, or under
+	// its legacy form, is never promoted: it would hand the admin role to
+	// whoever got there first
+	var id string
+	err = db.QueryRowContext(
+		ctx,
+		"INSERT INTO users (login, password, role) SELECT $1, $2, $3 "+
+			"WHERE NOT EXISTS (SELECT 1 FROM users WHERE legacy_encoding AND login = $4 AND role != $3) "+
+			"ON CONFLICT (login) DO UPDATE SET role = EXCLUDED.role WHERE users.role = EXCLUDED.role RETURNING id",
+		user.Login, hash, RoleAdmin, encryption.LegacyEncoding(user.Login),
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrLoginTaken
 	}
-	return login, nil
+	return err
 }
@@ -0,0 +1,37 @@
+package authentication
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"github.com/spf13/viper"
+)
+
+// BootstrapAdmin creates the first administrator from ADMIN_LOGIN and
+// ADMIN_PASSWORD. Nothing happens when ADMIN_LOGIN is not configured or the
+// admin already exists, and it fails with ErrLoginTaken when a regular user
+// holds that login.
+func BootstrapAdmin(a Auth) error {
+	login := validation.NormalizeLogin(viper.GetString("ADMIN_LOGIN"))
+	if login == "" {
+		return nil
+	}
+	password := viper.GetString("ADMIN_PASSWORD")
+
+	errs := append(validation.ValidateLogin(login), validation.PasswordPolicyFromConfig().Validate(password, login)...)
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid admin credentials: %w", errs)
+	}
+
+	e := encryption.New()
+
+	err := a.EnsureAdmin(User{
+		Login:    e.EncodeData(login),
+		Password: password,
+	})
+	if errors.Is(err, ErrLoginTaken) {
+		return fmt.Errorf("%w: %q belongs to a user who is not an admin", err, login)
+	}
+	return err
+}
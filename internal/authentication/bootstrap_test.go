@@ -0,0 +1,47 @@
+package authentication_test
+
+import (
+	"github.com/golang/mock/gomock"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBootstrapAdmin(t *testing.T) {
+	login := encryption.New().EncodeData("root")
+
+	tests := []struct {
+		name       string
+		adminLogin string
+		ensureErr  error
+		calls      int
+		wantErr    error
+	}{
+		{name: "not configured"},
+		{name: "created or already admin", adminLogin: "root", calls: 1},
+		{name: "login held by a user", adminLogin: "root", ensureErr: authentication.ErrLoginTaken, calls: 1, wantErr: authentication.ErrLoginTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer viper.Reset()
+			viper.Set("ADMIN_LOGIN", tt.adminLogin)
+			viper.Set("ADMIN_PASSWORD", "Str0ng-Passw0rd!")
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			a := mock_authentication.NewMockAuth(ctrl)
+			a.EXPECT().EnsureAdmin(authentication.User{Login: login, Password: "Str0ng-Passw0rd!"}).Return(tt.ensureErr).Times(tt.calls)
+
+			err := authentication.BootstrapAdmin(a)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
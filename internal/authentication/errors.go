@@ -0,0 +1,15 @@
+package authentication
+
+import "errors"
+
+var (
+	ErrLoginTaken         = errors.New("login already taken")
+	ErrInvalidCredentials = errors.New("invalid login or password")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrWrongPassword      = errors.New("wrong password")
+	ErrInvalidResetToken  = errors.New("invalid reset token")
+	ErrTwoFactorEnabled   = errors.New("2fa already enabled")
+	ErrInvalidChallenge   = errors.New("invalid challenge")
+	ErrIdentityLinked     = errors.New("identity already linked")
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+)
@@ -0,0 +1,124 @@
+package authentication
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/spf13/viper"
+	"time"
+)
+
+// GetUserByIdentity returns the user linked to the external identity, or
+// nil when the identity is not linked yet.
+func (a *auth) GetUserByIdentity(issuer string, subject string) (*User, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user := User{}
+
+	err = db.QueryRowContext(
+		ctx,
+		"SELECT u.id, u.login, u.role, u.totp_enabled FROM user_identities i JOIN users u ON u.id = i.user_id::bigint WHERE i.issuer = $1 AND i.subject = $2",
+		issuer, subject,
+	).Scan(&user.ID, &user.Login, &user.Role, &user.TwoFactor)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// LinkIdentity links the external identity to an existing user. It fails
+// when the identity already belongs to someone.
+func (a *auth) LinkIdentity(userID string, issuer string, subject string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result, err := db.ExecContext(
+		ctx,
+		"INSERT INTO user_identities (user_id, issuer, subject) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		userID, issuer, subject,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrIdentityLinked
+	}
+
+	return nil
+}
+
+// CreateUserWithIdentity registers a user that signs in through an external
+// provider and returns its id. Like AddUserInfoToTable, it fails with
+// ErrLoginTaken when the login is taken.
+func (a *auth) CreateUserWithIdentity(user User, issuer string, subject string) (string, error) {
+	hash, err := HashPassword(user.Password)
+	if err != nil {
+		return "", err
+	}
+
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID string
+
+	err = tx.QueryRowContext(ctx, insertUserQuery, user.Login, hash, encryption.LegacyEncoding(user.Login)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrLoginTaken
+		}
+		return "", err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO user_identities (user_id, issuer, subject) VALUES ($1, $2, $3)",
+		userID, issuer, subject,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return userID, tx.Commit()
+}
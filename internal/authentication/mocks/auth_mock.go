@@ -5,8 +5,8 @@
 package mock_authentication
 
 import (
-	sql "database/sql"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication"
@@ -35,6 +35,35 @@ func (m *MockAuth) EXPECT() *MockAuthMockRecorder {
 	return m.recorder
 }
 
+// AcceptTOTPCounter mocks base method.
+func (m *MockAuth) AcceptTOTPCounter(userID string, counter int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptTOTPCounter", userID, counter)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcceptTOTPCounter indicates an expected call of AcceptTOTPCounter.
+func (mr *MockAuthMockRecorder) AcceptTOTPCounter(userID, counter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptTOTPCounter", reflect.TypeOf((*MockAuth)(nil).AcceptTOTPCounter), userID, counter)
+}
+
+// AddAuditRecord mocks base method.
+func (m *MockAuth) AddAuditRecord(record authentication.AuditRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddAuditRecord", record)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddAuditRecord indicates an expected call of AddAuditRecord.
+func (mr *MockAuthMockRecorder) AddAuditRecord(record interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAuditRecord", reflect.TypeOf((*MockAuth)(nil).AddAuditRecord), record)
+}
+
 // AddUserInfoToTable mocks base method.
 func (m *MockAuth) AddUserInfoToTable(user authentication.User) error {
 	m.ctrl.T.Helper()
@@ -49,46 +78,495 @@ func (mr *MockAuthMockRecorder) AddUserInfoToTable(user interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUserInfoToTable", reflect.TypeOf((*MockAuth)(nil).AddUserInfoToTable), user)
 }
 
-// CheckTokenIsValid mocks base method.
-func (m *MockAuth) CheckTokenIsValid(token string) (bool, error) {
+// AnonymizeUser mocks base method.
+func (m *MockAuth) AnonymizeUser(userID, pseudonym string, record authentication.AuditRecord) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CheckTokenIsValid", token)
-	ret0, _ := ret[0].(bool)
+	ret := m.ctrl.Call(m, "AnonymizeUser", userID, pseudonym, record)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AnonymizeUser indicates an expected call of AnonymizeUser.
+func (mr *MockAuthMockRecorder) AnonymizeUser(userID, pseudonym, record interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AnonymizeUser", reflect.TypeOf((*MockAuth)(nil).AnonymizeUser), userID, pseudonym, record)
+}
+
+// AttemptLoginChallenge mocks base method.
+func (m *MockAuth) AttemptLoginChallenge(challengeHash, token string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AttemptLoginChallenge", challengeHash, token)
+	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// CheckTokenIsValid indicates an expected call of CheckTokenIsValid.
-func (mr *MockAuthMockRecorder) CheckTokenIsValid(token interface{}) *gomock.Call {
+// AttemptLoginChallenge indicates an expected call of AttemptLoginChallenge.
+func (mr *MockAuthMockRecorder) AttemptLoginChallenge(challengeHash, token interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckTokenIsValid", reflect.TypeOf((*MockAuth)(nil).CheckTokenIsValid), token)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AttemptLoginChallenge", reflect.TypeOf((*MockAuth)(nil).AttemptLoginChallenge), challengeHash, token)
 }
 
-// CheckUserData mocks base method.
-func (m *MockAuth) CheckUserData(user authentication.User) error {
+// ChangePassword mocks base method.
+func (m *MockAuth) ChangePassword(userID, currentPassword, newPassword, keepSessionID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CheckUserData", user)
+	ret := m.ctrl.Call(m, "ChangePassword", userID, currentPassword, newPassword, keepSessionID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockAuthMockRecorder) ChangePassword(userID, currentPassword, newPassword, keepSessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockAuth)(nil).ChangePassword), userID, currentPassword, newPassword, keepSessionID)
+}
+
+// CheckUserData mocks base method.
+func (m *MockAuth) CheckUserData(user authentication.User) (*authentication.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckUserData", user)
+	ret0, _ := ret[0].(*authentication.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // CheckUserData indicates an expected call of CheckUserData.
 func (mr *MockAuthMockRecorder) CheckUserData(user interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckUserData", reflect.TypeOf((*MockAuth)(nil).CheckUserData), user)
 }
 
-// GetUserLoginByToken mocks base method.
-func (m *MockAuth) GetUserLoginByToken(token string, db *sql.DB) (string, error) {
+// CompleteLoginChallenge mocks base method.
+func (m *MockAuth) CompleteLoginChallenge(challengeHash, token string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteLoginChallenge", challengeHash, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompleteLoginChallenge indicates an expected call of CompleteLoginChallenge.
+func (mr *MockAuthMockRecorder) CompleteLoginChallenge(challengeHash, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteLoginChallenge", reflect.TypeOf((*MockAuth)(nil).CompleteLoginChallenge), challengeHash, token)
+}
+
+// ConfirmTOTP mocks base method.
+func (m *MockAuth) ConfirmTOTP(userID string, counter int64, recoveryCodeHashes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTOTP", userID, counter, recoveryCodeHashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConfirmTOTP indicates an expected call of ConfirmTOTP.
+func (mr *MockAuthMockRecorder) ConfirmTOTP(userID, counter, recoveryCodeHashes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTOTP", reflect.TypeOf((*MockAuth)(nil).ConfirmTOTP), userID, counter, recoveryCodeHashes)
+}
+
+// CreateAPIKey mocks base method.
+func (m *MockAuth) CreateAPIKey(key authentication.APIKey) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserLoginByToken", token, db)
+	ret := m.ctrl.Call(m, "CreateAPIKey", key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAPIKey indicates an expected call of CreateAPIKey.
+func (mr *MockAuthMockRecorder) CreateAPIKey(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockAuth)(nil).CreateAPIKey), key)
+}
+
+// CreateLoginChallenge mocks base method.
+func (m *MockAuth) CreateLoginChallenge(userID, challengeHash, token string, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLoginChallenge", userID, challengeHash, token, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateLoginChallenge indicates an expected call of CreateLoginChallenge.
+func (mr *MockAuthMockRecorder) CreateLoginChallenge(userID, challengeHash, token, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLoginChallenge", reflect.TypeOf((*MockAuth)(nil).CreateLoginChallenge), userID, challengeHash, token, ttl)
+}
+
+// CreatePasswordReset mocks base method.
+func (m *MockAuth) CreatePasswordReset(userID, tokenHash string, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasswordReset", userID, tokenHash, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePasswordReset indicates an expected call of CreatePasswordReset.
+func (mr *MockAuthMockRecorder) CreatePasswordReset(userID, tokenHash, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasswordReset", reflect.TypeOf((*MockAuth)(nil).CreatePasswordReset), userID, tokenHash, ttl)
+}
+
+// CreateSession mocks base method.
+func (m *MockAuth) CreateSession(userID, token string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", userID, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockAuthMockRecorder) CreateSession(userID, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockAuth)(nil).CreateSession), userID, token)
+}
+
+// CreateUserWithIdentity mocks base method.
+func (m *MockAuth) CreateUserWithIdentity(user authentication.User, issuer, subject string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUserWithIdentity", user, issuer, subject)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUserWithIdentity indicates an expected call of CreateUserWithIdentity.
+func (mr *MockAuthMockRecorder) CreateUserWithIdentity(user, issuer, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUserWithIdentity", reflect.TypeOf((*MockAuth)(nil).CreateUserWithIdentity), user, issuer, subject)
+}
+
+// EnrollTOTP mocks base method.
+func (m *MockAuth) EnrollTOTP(userID, encSecret string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnrollTOTP", userID, encSecret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnrollTOTP indicates an expected call of EnrollTOTP.
+func (mr *MockAuthMockRecorder) EnrollTOTP(userID, encSecret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnrollTOTP", reflect.TypeOf((*MockAuth)(nil).EnrollTOTP), userID, encSecret)
+}
+
+// EnsureAdmin mocks base method.
+func (m *MockAuth) EnsureAdmin(user authentication.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnsureAdmin", user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnsureAdmin indicates an expected call of EnsureAdmin.
+func (mr *MockAuthMockRecorder) EnsureAdmin(user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureAdmin", reflect.TypeOf((*MockAuth)(nil).EnsureAdmin), user)
+}
+
+// GetAPIKey mocks base method.
+func (m *MockAuth) GetAPIKey(id string) (*authentication.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKey", id)
+	ret0, _ := ret[0].(*authentication.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKey indicates an expected call of GetAPIKey.
+func (mr *MockAuthMockRecorder) GetAPIKey(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKey", reflect.TypeOf((*MockAuth)(nil).GetAPIKey), id)
+}
+
+// GetTOTP mocks base method.
+func (m *MockAuth) GetTOTP(userID string) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTOTP", userID)
 	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetTOTP indicates an expected call of GetTOTP.
+func (mr *MockAuthMockRecorder) GetTOTP(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTOTP", reflect.TypeOf((*MockAuth)(nil).GetTOTP), userID)
+}
+
+// GetUserByID mocks base method.
+func (m *MockAuth) GetUserByID(id string) (*authentication.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", id)
+	ret0, _ := ret[0].(*authentication.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockAuthMockRecorder) GetUserByID(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockAuth)(nil).GetUserByID), id)
+}
+
+// GetUserByIdentity mocks base method.
+func (m *MockAuth) GetUserByIdentity(issuer, subject string) (*authentication.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByIdentity", issuer, subject)
+	ret0, _ := ret[0].(*authentication.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByIdentity indicates an expected call of GetUserByIdentity.
+func (mr *MockAuthMockRecorder) GetUserByIdentity(issuer, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByIdentity", reflect.TypeOf((*MockAuth)(nil).GetUserByIdentity), issuer, subject)
+}
+
+// GetUserByLogin mocks base method.
+func (m *MockAuth) GetUserByLogin(login string) (*authentication.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByLogin", login)
+	ret0, _ := ret[0].(*authentication.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByLogin indicates an expected call of GetUserByLogin.
+func (mr *MockAuthMockRecorder) GetUserByLogin(login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByLogin", reflect.TypeOf((*MockAuth)(nil).GetUserByLogin), login)
+}
+
+// GetUserByToken mocks base method.
+func (m *MockAuth) GetUserByToken(token string) (*authentication.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByToken", token)
+	ret0, _ := ret[0].(*authentication.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByToken indicates an expected call of GetUserByToken.
+func (mr *MockAuthMockRecorder) GetUserByToken(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByToken", reflect.TypeOf((*MockAuth)(nil).GetUserByToken), token)
+}
+
+// GrantAPIKeyAccess mocks base method.
+func (m *MockAuth) GrantAPIKeyAccess(id, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantAPIKeyAccess", id, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GrantAPIKeyAccess indicates an expected call of GrantAPIKeyAccess.
+func (mr *MockAuthMockRecorder) GrantAPIKeyAccess(id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantAPIKeyAccess", reflect.TypeOf((*MockAuth)(nil).GrantAPIKeyAccess), id, userID)
+}
+
+// HasAPIKeyAccess mocks base method.
+func (m *MockAuth) HasAPIKeyAccess(id, userID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HasAPIKeyAccess", id, userID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HasAPIKeyAccess indicates an expected call of HasAPIKeyAccess.
+func (mr *MockAuthMockRecorder) HasAPIKeyAccess(id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HasAPIKeyAccess", reflect.TypeOf((*MockAuth)(nil).HasAPIKeyAccess), id, userID)
+}
+
+// LinkIdentity mocks base method.
+func (m *MockAuth) LinkIdentity(userID, issuer, subject string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkIdentity", userID, issuer, subject)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkIdentity indicates an expected call of LinkIdentity.
+func (mr *MockAuthMockRecorder) LinkIdentity(userID, issuer, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkIdentity", reflect.TypeOf((*MockAuth)(nil).LinkIdentity), userID, issuer, subject)
+}
+
+// ListAPIKeyGrants mocks base method.
+func (m *MockAuth) ListAPIKeyGrants(userID string) ([]authentication.APIKeyGrant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAPIKeyGrants", userID)
+	ret0, _ := ret[0].([]authentication.APIKeyGrant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAPIKeyGrants indicates an expected call of ListAPIKeyGrants.
+func (mr *MockAuthMockRecorder) ListAPIKeyGrants(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAPIKeyGrants", reflect.TypeOf((*MockAuth)(nil).ListAPIKeyGrants), userID)
+}
+
+// ListAPIKeys mocks base method.
+func (m *MockAuth) ListAPIKeys() ([]authentication.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAPIKeys")
+	ret0, _ := ret[0].([]authentication.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAPIKeys indicates an expected call of ListAPIKeys.
+func (mr *MockAuthMockRecorder) ListAPIKeys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAPIKeys", reflect.TypeOf((*MockAuth)(nil).ListAPIKeys))
+}
+
+// ListAuditRecords mocks base method.
+func (m *MockAuth) ListAuditRecords(userID string) ([]authentication.AuditRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAuditRecords", userID)
+	ret0, _ := ret[0].([]authentication.AuditRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAuditRecords indicates an expected call of ListAuditRecords.
+func (mr *MockAuthMockRecorder) ListAuditRecords(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAuditRecords", reflect.TypeOf((*MockAuth)(nil).ListAuditRecords), userID)
+}
+
+// ListSessions mocks base method.
+func (m *MockAuth) ListSessions(userID string) ([]authentication.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSessions", userID)
+	ret0, _ := ret[0].([]authentication.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSessions indicates an expected call of ListSessions.
+func (mr *MockAuthMockRecorder) ListSessions(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSessions", reflect.TypeOf((*MockAuth)(nil).ListSessions), userID)
+}
+
+// ResetPassword mocks base method.
+func (m *MockAuth) ResetPassword(tokenHash, newPassword string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPassword", tokenHash, newPassword)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetPassword indicates an expected call of ResetPassword.
+func (mr *MockAuthMockRecorder) ResetPassword(tokenHash, newPassword interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockAuth)(nil).ResetPassword), tokenHash, newPassword)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockAuth) RevokeAPIKey(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockAuthMockRecorder) RevokeAPIKey(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockAuth)(nil).RevokeAPIKey), id)
+}
+
+// RevokeAPIKeyAccess mocks base method.
+func (m *MockAuth) RevokeAPIKeyAccess(id, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKeyAccess", id, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKeyAccess indicates an expected call of RevokeAPIKeyAccess.
+func (mr *MockAuthMockRecorder) RevokeAPIKeyAccess(id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKeyAccess", reflect.TypeOf((*MockAuth)(nil).RevokeAPIKeyAccess), id, userID)
+}
+
+// RevokeSessions mocks base method.
+func (m *MockAuth) RevokeSessions(userID, exceptSessionID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSessions", userID, exceptSessionID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSessions indicates an expected call of RevokeSessions.
+func (mr *MockAuthMockRecorder) RevokeSessions(userID, exceptSessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSessions", reflect.TypeOf((*MockAuth)(nil).RevokeSessions), userID, exceptSessionID)
+}
+
+// SetUserRole mocks base method.
+func (m *MockAuth) SetUserRole(id, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserRole", id, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserRole indicates an expected call of SetUserRole.
+func (mr *MockAuthMockRecorder) SetUserRole(id, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserRole", reflect.TypeOf((*MockAuth)(nil).SetUserRole), id, role)
+}
+
+// TrackAPIKeyUsage mocks base method.
+func (m *MockAuth) TrackAPIKeyUsage(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrackAPIKeyUsage", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TrackAPIKeyUsage indicates an expected call of TrackAPIKeyUsage.
+func (mr *MockAuthMockRecorder) TrackAPIKeyUsage(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrackAPIKeyUsage", reflect.TypeOf((*MockAuth)(nil).TrackAPIKeyUsage), id)
+}
+
+// UseAPIKeySignature mocks base method.
+func (m *MockAuth) UseAPIKeySignature(id, signature string, expiresAt time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseAPIKeySignature", id, signature, expiresAt)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseAPIKeySignature indicates an expected call of UseAPIKeySignature.
+func (mr *MockAuthMockRecorder) UseAPIKeySignature(id, signature, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseAPIKeySignature", reflect.TypeOf((*MockAuth)(nil).UseAPIKeySignature), id, signature, expiresAt)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockAuth) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", userID, codeHash)
+	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUserLoginByToken indicates an expected call of GetUserLoginByToken.
-func (mr *MockAuthMockRecorder) GetUserLoginByToken(token, db interface{}) *gomock.Call {
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockAuthMockRecorder) UseRecoveryCode(userID, codeHash interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserLoginByToken", reflect.TypeOf((*MockAuth)(nil).GetUserLoginByToken), token, db)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockAuth)(nil).UseRecoveryCode), userID, codeHash)
 }
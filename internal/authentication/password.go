@@ -0,0 +1,223 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+const defaultPasswordResetTTL = 30 * time.Minute
+
+// NewResetToken returns a random one-time token for the user and the hash
+// under which it is stored.
+func NewResetToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// HashPassword returns the bcrypt hash under which the password is stored.
+// bcrypt reads at most 72 bytes, so it is given the SHA-256 digest of the
+// password instead of the password itself.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword(passwordDigest(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func passwordDigest(password string) []byte {
+	sum := sha256.Sum256([]byte(password))
+	return []byte(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// passwordMatches compares the password with the stored hash. Migration
+// 000021 hashed the passwords in the base64 form they were stored in
+// (encoded), which for rows with legacy_encoding may also be truncated.
+func passwordMatches(hash string, encoded bool, legacy bool, password string) bool {
+	if !encoded {
+		return bcrypt.CompareHashAndPassword([]byte(hash), passwordDigest(password)) == nil
+	}
+
+	old := base64.URLEncoding.EncodeToString([]byte(password))
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(old)) == nil {
+		return true
+	}
+	return legacy && bcrypt.CompareHashAndPassword([]byte(hash), []byte(encryption.LegacyEncoding(old))) == nil
+}
+
+func PasswordResetTTL() time.Duration {
+	if ttl := viper.GetDuration("PASSWORD_RESET_TTL"); ttl > 0 {
+		return ttl
+	}
+	return defaultPasswordResetTTL
+}
+
+// ChangePassword replaces the password when currentPassword matches and
+// revokes every session of the user except keepSessionID.
+func (a *auth) ChangePassword(userID string, currentPassword string, newPassword string, keepSessionID string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hash string
+	var encoded, legacy bool
+
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT password, password_encoded, legacy_encoding FROM users WHERE id = $1::bigint FOR UPDATE",
+		userID,
+	).Scan(&hash, &encoded, &legacy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrWrongPassword
+		}
+		return err
+	}
+	if !passwordMatches(hash, encoded, legacy, currentPassword) {
+		return ErrWrongPassword
+	}
+
+	newHash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE users SET password = $1, password_encoded = false WHERE id = $2::bigint", newHash, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := revokeSessions(ctx, tx, userID, keepSessionID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreatePasswordReset stores the hash of a new reset token valid for ttl.
+// Reset tokens issued to the user earlier stop working.
+func (a *auth) CreatePasswordReset(userID string, tokenHash string, ttl time.Duration) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE password_resets SET used_at = now() WHERE user_id = $1 AND used_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES ($1, $2, now() + make_interval(secs => $3))",
+		userID, tokenHash, ttl.Seconds(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword consumes the reset token, sets the new password and
+// revokes all sessions of the user.
+func (a *auth) ResetPassword(tokenHash string, newPassword string) error {
+	newHash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID string
+
+	err = tx.QueryRowContext(
+		ctx,
+		"UPDATE password_resets SET used_at = now() WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now() RETURNING user_id",
+		tokenHash,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE users SET password = $1, password_encoded = false WHERE id = $2::bigint", newHash, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := revokeSessions(ctx, tx, userID, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
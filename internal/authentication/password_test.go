@@ -0,0 +1,34 @@
+package authentication
+
+import (
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func Test_passwordMatches(t *testing.T) {
+	hash, err := HashPassword("testPassword1")
+	require.NoError(t, err)
+	require.True(t, passwordMatches(hash, false, false, "testPassword1"))
+	require.False(t, passwordMatches(hash, false, false, "testPassword2"))
+
+	// longer than the 72 bytes bcrypt reads
+	long := strings.Repeat("a", 100)
+	hash, err = HashPassword(long)
+	require.NoError(t, err)
+	require.False(t, passwordMatches(hash, false, false, long[:99]+"b"))
+
+	// hashes made by the migration from the stored base64 form
+	encoded, err := bcrypt.GenerateFromPassword([]byte("dGVzdFBhc3N3b3JkMQ=="), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.True(t, passwordMatches(string(encoded), true, false, "testPassword1"))
+	require.False(t, passwordMatches(string(encoded), false, false, "testPassword1"))
+
+	truncated, err := bcrypt.GenerateFromPassword([]byte("dGVzdFBhc3N3b3Jk"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.True(t, passwordMatches(string(truncated), true, true, "testPassword1"))
+	require.False(t, passwordMatches(string(truncated), true, false, "testPassword1"))
+
+	require.False(t, passwordMatches("", false, false, ""))
+}
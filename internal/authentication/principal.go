@@ -0,0 +1,55 @@
+package authentication
+
+import (
+	"context"
+)
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+func ValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleSupport, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// Principal describes the authenticated user of the current request.
+type Principal struct {
+	UserID    string
+	Login     string
+	Roles     []string
+	SessionID string
+	TwoFactor bool
+	// APIKeyID and Scopes are set when a partner acts for the user with a
+	// signed API request instead of a session.
+	APIKeyID string
+	Scopes   []string
+}
+
+// HasRole reports whether the principal has any of the given roles.
+func (p Principal) HasRole(roles ...string) bool {
+	for _, have := range p.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,127 @@
+package authentication
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/spf13/viper"
+	"time"
+)
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// NewSessionToken returns a fresh session token: random bytes encrypted
+// with the current key.
+func NewSessionToken() (string, error) {
+	e := encryption.New()
+
+	random, err := e.GenerateRandom(16)
+	if err != nil {
+		return "", err
+	}
+
+	return e.EncryptData([]byte(hex.EncodeToString(random)))
+}
+
+// createSession binds a fresh session token to the user. Tokens are never
+// reused: a token that already has a session makes the insert fail.
+func createSession(ctx context.Context, db execer, userID string, token string) error {
+	_, err := db.ExecContext(
+		ctx,
+		"INSERT INTO sessions (user_id, token) VALUES ($1, $2)",
+		userID, token,
+	)
+	return err
+}
+
+func revokeSessions(ctx context.Context, db execer, userID string, exceptSessionID string) error {
+	_, err := db.ExecContext(
+		ctx,
+		"UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND id::text != $2 AND revoked_at IS NULL",
+		userID, exceptSessionID,
+	)
+	return err
+}
+
+func (a *auth) CreateSession(userID string, token string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return createSession(ctx, db, userID, token)
+}
+
+// RevokeSessions ends every active session of the user except the one
+// with exceptSessionID, which may be empty to end them all.
+func (a *auth) RevokeSessions(userID string, exceptSessionID string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return revokeSessions(ctx, db, userID, exceptSessionID)
+}
+
+type Session struct {
+	ID        string
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// ListSessions returns the sessions of the user without their tokens.
+func (a *auth) ListSessions(userID string) ([]Session, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, created_at, revoked_at FROM sessions WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		var revokedAt sql.NullTime
+
+		if err := rows.Scan(&s.ID, &s.CreatedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if revokedAt.Valid {
+			s.RevokedAt = &revokedAt.Time
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
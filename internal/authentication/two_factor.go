@@ -0,0 +1,356 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/totp"
+	"github.com/spf13/viper"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodesCount = 10
+	// maxChallengeAttempts limits how many codes can be tried against one
+	// login challenge before the password has to be entered again.
+	maxChallengeAttempts = 5
+
+	defaultLoginChallengeTTL = 5 * time.Minute
+)
+
+func LoginChallengeTTL() time.Duration {
+	if ttl := viper.GetDuration("LOGIN_CHALLENGE_TTL"); ttl > 0 {
+		return ttl
+	}
+	return defaultLoginChallengeTTL
+}
+
+// NewRecoveryCodes returns codes to show to the user once and the hashes
+// under which they are stored.
+func NewRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+
+	for i := 0; i < recoveryCodesCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode ignores case and dashes, so codes can be typed either way.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return HashToken(code)
+}
+
+// EnrollTOTP stores a new, not yet confirmed secret. It fails when two-factor
+// authentication is already enabled for the user.
+func (a *auth) EnrollTOTP(userID string, encSecret string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result, err := db.ExecContext(
+		ctx,
+		"UPDATE users SET totp_secret = $1 WHERE id = $2::bigint AND NOT totp_enabled",
+		encSecret, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	return nil
+}
+
+// VerifySecondFactor accepts either a current TOTP code or an unused
+// recovery code of the user.
+func VerifySecondFactor(a Auth, userID string, code string) (bool, error) {
+	encSecret, enabled, err := a.GetTOTP(userID)
+	if err != nil {
+		return false, err
+	}
+	if !enabled {
+		return false, nil
+	}
+
+	secret, err := encryption.New().DecryptData(encSecret)
+	if err != nil {
+		return false, err
+	}
+	if counter, ok := totp.Match(string(secret), code, time.Now()); ok {
+		return a.AcceptTOTPCounter(userID, counter)
+	}
+
+	return a.UseRecoveryCode(userID, HashRecoveryCode(code))
+}
+
+// GetTOTP returns the encrypted secret of the user and whether it has been
+// confirmed. The secret is empty when the user never enrolled.
+func (a *auth) GetTOTP(userID string) (string, bool, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return "", false, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var secret sql.NullString
+	var enabled bool
+
+	err = db.QueryRowContext(ctx, "SELECT totp_secret, totp_enabled FROM users WHERE id = $1::bigint", userID).Scan(&secret, &enabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, ErrUserNotFound
+		}
+		return "", false, err
+	}
+
+	return secret.String, enabled, nil
+}
+
+// ConfirmTOTP enables two-factor authentication and replaces the recovery
+// codes of the user. counter is the time step of the confirmation code, so
+// that the code can't be used again to log in.
+func (a *auth) ConfirmTOTP(userID string, counter int64, recoveryCodeHashes []string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		"UPDATE users SET totp_enabled = true, totp_last_counter = $2 WHERE id = $1::bigint AND totp_secret IS NOT NULL AND NOT totp_enabled",
+		userID, counter,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AcceptTOTPCounter records the time step of a valid TOTP code and reports
+// whether it is newer than the last accepted one. A code is thus accepted
+// only once, and so is any code of an earlier step.
+func (a *auth) AcceptTOTPCounter(userID string, counter int64) (bool, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result, err := db.ExecContext(
+		ctx,
+		"UPDATE users SET totp_last_counter = $2 WHERE id = $1::bigint AND (totp_last_counter IS NULL OR totp_last_counter < $2)",
+		userID, counter,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// UseRecoveryCode marks the code as used and reports whether it was valid.
+func (a *auth) UseRecoveryCode(userID string, codeHash string) (bool, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result, err := db.ExecContext(
+		ctx,
+		"UPDATE recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// CreateLoginChallenge remembers that the user passed the password check
+// with the given session token. The challenge can only be completed with
+// that token, but the session itself gets a fresh one in
+// CompleteLoginChallenge.
+func (a *auth) CreateLoginChallenge(userID string, challengeHash string, token string, ttl time.Duration) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err = db.ExecContext(
+		ctx,
+		"INSERT INTO login_challenges (user_id, challenge_hash, token, expires_at) VALUES ($1, $2, $3, now() + make_interval(secs => $4))",
+		userID, challengeHash, token, ttl.Seconds(),
+	)
+	return err
+}
+
+// AttemptLoginChallenge counts an attempt to complete a pending challenge
+// and returns its user. The attempt is counted before the code is checked,
+// so concurrent requests can't try more than maxChallengeAttempts codes.
+// The challenge is only valid together with the session token it was
+// issued for.
+func (a *auth) AttemptLoginChallenge(challengeHash string, token string) (string, error) {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var userID string
+
+	err = db.QueryRowContext(
+		ctx,
+		"UPDATE login_challenges SET attempts = attempts + 1 WHERE challenge_hash = $1 AND token = $2 AND used_at IS NULL AND expires_at > now() AND attempts < $3 RETURNING user_id",
+		challengeHash, token, maxChallengeAttempts,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrInvalidChallenge
+		}
+		return "", err
+	}
+
+	return userID, nil
+}
+
+// CompleteLoginChallenge consumes the challenge and starts a session of its
+// user with the given fresh token.
+func (a *auth) CompleteLoginChallenge(challengeHash string, token string) error {
+	dbAddress := viper.GetString("DATABASE_URI")
+
+	db, err := sql.Open("pgx", dbAddress)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID string
+
+	err = tx.QueryRowContext(
+		ctx,
+		"UPDATE login_challenges SET used_at = now() WHERE challenge_hash = $1 AND used_at IS NULL AND expires_at > now() AND attempts <= $2 RETURNING user_id",
+		challengeHash, maxChallengeAttempts,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidChallenge
+		}
+		return err
+	}
+
+	if err := createSession(ctx, tx, userID, token); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
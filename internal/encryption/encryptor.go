@@ -1,34 +1,65 @@
 package encryption
 
 import (
-	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"strings"
 )
 
+// keySeparator splits the key ID from the hex payload of a ciphertext.
+const keySeparator = "."
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
 type Encryptor interface {
 	EncryptData(data []byte) (string, error)
 	DecryptData(data string) ([]byte, error)
+	Rotate(data string) (string, bool, error)
 	GenerateRandom(size int) ([]byte, error)
 	EncodeData(data string) string
+	DecodeData(data string) (string, error)
 }
 
 type encryptor struct {
-	key []byte
+	keys *Keyring
+	err  error
 }
 
+// New builds an encryptor from the configured keys. The server refuses to
+// start when LoadKeyring fails; should the configuration break afterwards,
+// e.g. a removed key file, every operation that needs a key returns the
+// load error.
 func New() Encryptor {
+	keys, err := LoadKeyring()
+	if err != nil {
+		return &encryptor{keys: NewKeyring(), err: err}
+	}
+	return NewWithKeyring(keys)
+}
+
+func NewWithKeyring(keys *Keyring) Encryptor {
 	e := &encryptor{
-		key: []byte("passphrasewhichneedstobe32bytes!"),
+		keys: keys,
 	}
 	return e
 }
 
 func (e *encryptor) EncryptData(data []byte) (string, error) {
-	aesblock, err := aes.NewCipher(e.key)
+	if e.err != nil {
+		return "", e.err
+	}
+
+	keyID := e.keys.ActiveID()
+	key, ok := e.keys.Key(keyID)
+	if !ok {
+		return "", ErrNoKeys
+	}
+
+	aesblock, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -47,11 +78,60 @@ func (e *encryptor) EncryptData(data []byte) (string, error) {
 	encrypted = append(encrypted, nonce...)
 	encToString := hex.EncodeToString(encrypted)
 
-	return encToString, nil
+	return keyID + keySeparator + encToString, nil
 }
 
+// DecryptData selects the key by the ID prefix of the ciphertext. Data
+// written before key IDs existed has no prefix and is tried against every
+// configured key and then against legacyKey.
 func (e *encryptor) DecryptData(data string) ([]byte, error) {
-	aesblock, err := aes.NewCipher(e.key)
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	keyID, payload, found := strings.Cut(data, keySeparator)
+	if !found {
+		for _, key := range e.keys.keys {
+			if decrypted, err := decrypt(key, data); err == nil {
+				return decrypted, nil
+			}
+		}
+		if decrypted, err := decrypt(legacyKey, data); err == nil {
+			return decrypted, nil
+		}
+		return nil, ErrUnknownKey
+	}
+
+	key, ok := e.keys.Key(keyID)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return decrypt(key, payload)
+}
+
+// Rotate re-encrypts data with the active key. The second result reports
+// whether the data was encrypted with another key and has changed.
+func (e *encryptor) Rotate(data string) (string, bool, error) {
+	if keyID, _, found := strings.Cut(data, keySeparator); found && keyID == e.keys.ActiveID() {
+		return data, false, nil
+	}
+
+	decrypted, err := e.DecryptData(data)
+	if err != nil {
+		return "", false, err
+	}
+
+	encrypted, err := e.EncryptData(decrypted)
+	if err != nil {
+		return "", false, err
+	}
+
+	return encrypted, true, nil
+}
+
+func decrypt(key []byte, data string) ([]byte, error) {
+	aesblock, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +145,9 @@ func (e *encryptor) DecryptData(data string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(encData) < aesgcm.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
 
 	nonce := encData[len(encData)-aesgcm.NonceSize():]
 	enc := encData[:len(encData)-aesgcm.NonceSize()]
@@ -88,8 +171,24 @@ func (e *encryptor) GenerateRandom(size int) ([]byte, error) {
 }
 
 func (e *encryptor) EncodeData(data string) string {
-	buf := bytes.Buffer{}
-	encoder := base64.NewEncoder(base64.URLEncoding, &buf)
-	encoder.Write([]byte(data))
-	return buf.String()
+	return base64.URLEncoding.EncodeToString([]byte(data))
+}
+
+// LegacyEncoding returns the form EncodeData gave the same data before it
+// flushed the encoder: the last, partial group of up to two bytes was
+// dropped. Logins and passwords stored before migration 000020 are in that
+// form until their user logs in.
+func LegacyEncoding(encoded string) string {
+	if strings.HasSuffix(encoded, "=") {
+		return encoded[:len(encoded)-4]
+	}
+	return encoded
+}
+
+func (e *encryptor) DecodeData(data string) (string, error) {
+	decoded, err := base64.URLEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
 }
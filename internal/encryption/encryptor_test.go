@@ -1,27 +1,191 @@
 package encryption
 
 import (
+	"bytes"
+	"encoding/base64"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
+func testKeyring(t *testing.T, ids ...string) *Keyring {
+	k := NewKeyring()
+	for i, id := range ids {
+		require.NoError(t, k.Add(id, bytes.Repeat([]byte{byte(i + 1)}, keySize)))
+	}
+	return k
+}
+
 func Test_encryptor(t *testing.T) {
-	e := New()
+	e := NewWithKeyring(testKeyring(t, "k1"))
 	data := []byte("testDataToEncrypt")
 
 	encrypted, err := e.EncryptData(data)
 	require.NoError(t, err)
 	require.NotEmpty(t, encrypted)
+	require.True(t, strings.HasPrefix(encrypted, "k1."))
 
 	decrypted, err := e.DecryptData(encrypted)
 	require.NoError(t, err)
 	require.Equal(t, data, decrypted)
 }
 
-func Test_encryptor_GenerateRandom(t *testing.T) {
+func Test_encryptor_noKeys(t *testing.T) {
+	e := NewWithKeyring(NewKeyring())
+
+	_, err := e.EncryptData([]byte("testDataToEncrypt"))
+	require.ErrorIs(t, err, ErrNoKeys)
+}
+
+func Test_encryptor_severalKeys(t *testing.T) {
+	data := []byte("testDataToEncrypt")
+
+	oldEncrypted, err := NewWithKeyring(testKeyring(t, "k1")).EncryptData(data)
+	require.NoError(t, err)
+
+	e := NewWithKeyring(testKeyring(t, "k1", "k2"))
+
+	decrypted, err := e.DecryptData(oldEncrypted)
+	require.NoError(t, err)
+	require.Equal(t, data, decrypted)
+
+	newEncrypted, err := e.EncryptData(data)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(newEncrypted, "k2."))
+
+	_, err = NewWithKeyring(testKeyring(t, "k1")).DecryptData(newEncrypted)
+	require.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func Test_encryptor_legacyKey(t *testing.T) {
+	data := []byte("testDataToEncrypt")
+
+	legacy := NewKeyring()
+	require.NoError(t, legacy.Add("legacy", legacyKey))
+	encrypted, err := NewWithKeyring(legacy).EncryptData(data)
+	require.NoError(t, err)
+	_, payload, _ := strings.Cut(encrypted, keySeparator)
+
+	e := NewWithKeyring(testKeyring(t, "k1"))
+
+	decrypted, err := e.DecryptData(payload)
+	require.NoError(t, err)
+	require.Equal(t, data, decrypted)
+
+	rotated, changed, err := e.Rotate(payload)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.True(t, strings.HasPrefix(rotated, "k1."))
+}
+
+func Test_New_brokenKeys(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("ENCRYPTION_KEY", "short:"+base64.StdEncoding.EncodeToString([]byte("short")))
+
 	e := New()
+
+	_, err := e.EncryptData([]byte("testDataToEncrypt"))
+	require.ErrorContains(t, err, "must be 32 bytes")
+
+	_, err = e.DecryptData("k1.00")
+	require.ErrorContains(t, err, "must be 32 bytes")
+}
+
+func Test_encryptor_Rotate(t *testing.T) {
+	data := []byte("testDataToEncrypt")
+
+	oldEncrypted, err := NewWithKeyring(testKeyring(t, "k1")).EncryptData(data)
+	require.NoError(t, err)
+
+	e := NewWithKeyring(testKeyring(t, "k1", "k2"))
+
+	rotated, changed, err := e.Rotate(oldEncrypted)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.True(t, strings.HasPrefix(rotated, "k2."))
+
+	decrypted, err := e.DecryptData(rotated)
+	require.NoError(t, err)
+	require.Equal(t, data, decrypted)
+
+	again, changed, err := e.Rotate(rotated)
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Equal(t, rotated, again)
+}
+
+func Test_LoadKeyring(t *testing.T) {
+	defer viper.Reset()
+
+	key := func(b byte) string {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, keySize))
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(keyFile, []byte("# old keys\nk1:"+key(1)+"\n"), 0600))
+
+	viper.Set("ENCRYPTION_KEY_FILE", keyFile)
+	viper.Set("ENCRYPTION_KEYS", "k2:"+key(2)+",k3:"+key(3))
+
+	k, err := LoadKeyring()
+	require.NoError(t, err)
+	require.Equal(t, 3, k.Len())
+	require.Equal(t, "k3", k.ActiveID())
+
+	viper.Set("ENCRYPTION_KEY_ACTIVE", "k2")
+	k, err = LoadKeyring()
+	require.NoError(t, err)
+	require.Equal(t, "k2", k.ActiveID())
+
+	viper.Set("ENCRYPTION_KEY_ACTIVE", "missing")
+	_, err = LoadKeyring()
+	require.ErrorIs(t, err, ErrUnknownKey)
+
+	viper.Reset()
+	_, err = LoadKeyring()
+	require.ErrorIs(t, err, ErrNoKeys)
+
+	viper.Set("ENCRYPTION_KEY", "short:"+base64.StdEncoding.EncodeToString([]byte("short")))
+	_, err = LoadKeyring()
+	require.Error(t, err)
+}
+
+func Test_encryptor_GenerateRandom(t *testing.T) {
+	e := NewWithKeyring(NewKeyring())
 	got, err := e.GenerateRandom(16)
 	require.NoError(t, err)
 	require.Len(t, got, 16)
 	require.NotEmpty(t, got)
 }
+
+func Test_encryptor_EncodeData(t *testing.T) {
+	e := NewWithKeyring(NewKeyring())
+
+	tests := []struct {
+		data string
+	}{
+		{data: "bob"},
+		{data: "carl"},
+		{data: "alice"},
+		{data: "alicX"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			encoded := e.EncodeData(tt.data)
+
+			decoded, err := e.DecodeData(encoded)
+			require.NoError(t, err)
+			require.Equal(t, tt.data, decoded)
+
+			// the old encoder stopped at the last full group of three bytes
+			legacy, err := e.DecodeData(LegacyEncoding(encoded))
+			require.NoError(t, err)
+			require.Equal(t, tt.data[:len(tt.data)/3*3], legacy)
+		})
+	}
+
+	require.NotEqual(t, e.EncodeData("alice"), e.EncodeData("alicX"))
+}
@@ -0,0 +1,133 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const keySize = 32
+
+// legacyKey is the key every encryptor used before keys became
+// configurable. It only decrypts ciphertexts without a key ID and never
+// encrypts; "gophermart keys rotate" re-encrypts such data with the active
+// key, after which nothing depends on it any more.
+var legacyKey = []byte("passphrasewhichneedstobe32bytes!")
+
+var (
+	ErrNoKeys     = errors.New("no encryption keys configured")
+	ErrUnknownKey = errors.New("unknown encryption key")
+
+	keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Keyring holds every key that can decrypt stored data. The last key added
+// is the active one and is used for all new ciphertexts.
+type Keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: map[string][]byte{}}
+}
+
+func (k *Keyring) Add(id string, secret []byte) error {
+	if !keyIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid encryption key id %q", id)
+	}
+	if len(secret) != keySize {
+		return fmt.Errorf("encryption key %q must be %d bytes, got %d", id, keySize, len(secret))
+	}
+	if _, ok := k.keys[id]; ok {
+		return fmt.Errorf("duplicate encryption key id %q", id)
+	}
+
+	k.keys[id] = secret
+	k.active = id
+	return nil
+}
+
+func (k *Keyring) ActiveID() string {
+	return k.active
+}
+
+func (k *Keyring) Key(id string) ([]byte, bool) {
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+func (k *Keyring) Len() int {
+	return len(k.keys)
+}
+
+// LoadKeyring reads keys from ENCRYPTION_KEY_FILE, ENCRYPTION_KEYS and
+// ENCRYPTION_KEY, in that order. Every source holds "id:base64" entries;
+// ENCRYPTION_KEYS separates them with commas, the key file with newlines.
+// ENCRYPTION_KEY_ACTIVE overrides which key encrypts new data.
+func LoadKeyring() (*Keyring, error) {
+	k := NewKeyring()
+
+	if path := viper.GetString("ENCRYPTION_KEY_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := k.addEntries(strings.Split(string(content), "\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	if keys := viper.GetString("ENCRYPTION_KEYS"); keys != "" {
+		if err := k.addEntries(strings.Split(keys, ",")); err != nil {
+			return nil, err
+		}
+	}
+
+	if key := viper.GetString("ENCRYPTION_KEY"); key != "" {
+		if err := k.addEntries([]string{key}); err != nil {
+			return nil, err
+		}
+	}
+
+	if k.Len() == 0 {
+		return nil, ErrNoKeys
+	}
+
+	if active := viper.GetString("ENCRYPTION_KEY_ACTIVE"); active != "" {
+		if _, ok := k.keys[active]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, active)
+		}
+		k.active = active
+	}
+
+	return k, nil
+}
+
+func (k *Keyring) addEntries(entries []string) error {
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		id, encoded, found := strings.Cut(entry, ":")
+		if !found {
+			return fmt.Errorf("encryption key entry must look like id:base64key")
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return fmt.Errorf("encryption key %q: %w", id, err)
+		}
+
+		if err := k.Add(strings.TrimSpace(id), secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Package events fans notifications about new user events out to the
+// streams open on this replica.
+package events
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"github.com/spf13/viper"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const reconnectDelay = 5 * time.Second
+
+// Broker delivers the NOTIFY messages of storage.UserEventsChannel to the
+// subscribers of the user. A notification carries no event: the subscriber
+// reads what is new from the storage, so a missed or coalesced notification
+// only delays the delivery until the next one or the next reconnect.
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[string]map[chan struct{}]struct{}
+	listen sync.Once
+	dsn    string
+	// closed ends the streams on shutdown.
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// New returns a broker listening on DATABASE_URI. The connection is opened
+// with the first subscription.
+func New() *Broker {
+	return &Broker{
+		mu:     sync.Mutex{},
+		subs:   map[string]map[chan struct{}]struct{}{},
+		dsn:    viper.GetString("DATABASE_URI"),
+		closed: make(chan struct{}),
+	}
+}
+
+// Close tells the subscribers to end their streams. It is called when the
+// server shuts down, since http.Server.Shutdown waits for open streams
+// forever.
+func (b *Broker) Close() {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+	})
+}
+
+// Closed is closed by Close.
+func (b *Broker) Closed() <-chan struct{} {
+	return b.closed
+}
+
+// Subscribe returns a channel signalled when the user has new events and
+// the function that ends the subscription.
+func (b *Broker) Subscribe(userID string) (<-chan struct{}, func()) {
+	b.listen.Do(func() {
+		if b.dsn != "" {
+			go b.run()
+		}
+	})
+
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	if b.subs[userID] == nil {
+		b.subs[userID] = map[chan struct{}]struct{}{}
+	}
+	b.subs[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs[userID], ch)
+		if len(b.subs[userID]) == 0 {
+			delete(b.subs, userID)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Publish signals the subscribers of the user without blocking; a
+// subscriber that has not consumed the previous signal gets one for both.
+func (b *Broker) Publish(userID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[userID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// publishAll signals everybody, used after a reconnect when notifications
+// may have been lost.
+func (b *Broker) publishAll() {
+	b.mu.Lock()
+	users := make([]string, 0, len(b.subs))
+	for userID := range b.subs {
+		users = append(users, userID)
+	}
+	b.mu.Unlock()
+
+	for _, userID := range users {
+		b.Publish(userID)
+	}
+}
+
+func (b *Broker) run() {
+	for {
+		if err := b.listenOnce(context.Background()); err != nil {
+			slog.Error("user events listener failed", "error", err)
+		}
+		time.Sleep(reconnectDelay)
+	}
+}
+
+func (b *Broker) listenOnce(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+storage.UserEventsChannel); err != nil {
+		return err
+	}
+	b.publishAll()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		b.Publish(notification.Payload)
+	}
+}
@@ -0,0 +1,53 @@
+package events
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func signalled(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestBroker_Publish(t *testing.T) {
+	b := New()
+
+	first, unsubscribeFirst := b.Subscribe("1")
+	second, unsubscribeSecond := b.Subscribe("1")
+	other, unsubscribeOther := b.Subscribe("2")
+	defer unsubscribeSecond()
+	defer unsubscribeOther()
+
+	// signals are coalesced while the subscriber is busy
+	b.Publish("1")
+	b.Publish("1")
+
+	require.True(t, signalled(first))
+	require.False(t, signalled(first))
+	require.True(t, signalled(second))
+	require.False(t, signalled(other))
+
+	unsubscribeFirst()
+	b.Publish("1")
+	require.False(t, signalled(first))
+	require.True(t, signalled(second))
+}
+
+func TestBroker_publishAll(t *testing.T) {
+	b := New()
+
+	first, unsubscribeFirst := b.Subscribe("1")
+	second, unsubscribeSecond := b.Subscribe("2")
+	defer unsubscribeFirst()
+	defer unsubscribeSecond()
+
+	b.publishAll()
+
+	require.True(t, signalled(first))
+	require.True(t, signalled(second))
+}
@@ -0,0 +1,76 @@
+package grpcserver
+
+import (
+	"context"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/logging"
+	"github.com/mkarulina/loyalty-system-service.git/internal/middleware"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strings"
+)
+
+// publicMethods are called without a session token.
+var publicMethods = map[string]bool{
+	"/gophermart.v1.Gophermart/Register":       true,
+	"/gophermart.v1.Gophermart/Login":          true,
+	"/gophermart.v1.Gophermart/LoginTwoFactor": true,
+}
+
+// authenticate is the counterpart of middleware.Auth: it resolves the
+// "authorization: Bearer <token>" metadata to a principal in the context.
+func (s *Server) authenticate(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = logging.ContextWithRequest(ctx, requestID(ctx))
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	token := bearerToken(ctx)
+	if len(token) < 16 {
+		return nil, problemError(problem.Unauthorized, "")
+	}
+
+	user, err := s.auth.GetUserByToken(token)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	if user == nil {
+		return nil, problemError(problem.Unauthorized, "")
+	}
+
+	logging.SetUserID(ctx, user.ID)
+	ctx = authentication.ContextWithPrincipal(ctx, authentication.Principal{
+		UserID:    user.ID,
+		Login:     user.Login,
+		Roles:     []string{user.Role},
+		SessionID: user.SessionID,
+		TwoFactor: user.TwoFactor,
+	})
+	return handler(ctx, req)
+}
+
+// requestID takes the ID from the x-request-id metadata like the HTTP API
+// takes it from the header, or makes one up.
+func requestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, id := range md.Get(middleware.RequestIDHeader) {
+		if middleware.ValidRequestID(id) {
+			return id
+		}
+	}
+	return logging.NewRequestID()
+}
+
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, value := range md.Get("authorization") {
+		if token := strings.TrimPrefix(value, "Bearer "); token != value {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package grpcserver
+
+import (
+	"context"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"net/http"
+)
+
+// errorDomain is the domain of the ErrorInfo details.
+const errorDomain = "gophermart"
+
+var codesByHTTPStatus = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusPaymentRequired:     codes.FailedPrecondition,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusUnprocessableEntity: codes.InvalidArgument,
+	http.StatusBadGateway:          codes.Unavailable,
+}
+
+// problemError is the gRPC counterpart of problem.Write: the status code
+// follows the HTTP status of the problem and the ErrorInfo reason is its
+// code. detail must not carry internal error text.
+func problemError(t problem.Type, detail string) error {
+	return newStatus(t, detail, nil).Err()
+}
+
+// validationError is the counterpart of problem.WriteValidation; the field
+// errors go into a BadRequest detail.
+func validationError(errs validation.Errors) error {
+	return newStatus(problem.ValidationFailed, errs.Error(), errs).Err()
+}
+
+// internalError logs err and hides it from the client.
+func internalError(ctx context.Context, err error) error {
+	slog.ErrorContext(ctx, "internal error", "error", err)
+	return problemError(problem.Internal, "")
+}
+
+func newStatus(t problem.Type, detail string, errs validation.Errors) *status.Status {
+	code, ok := codesByHTTPStatus[t.Status]
+	if !ok {
+		code = codes.Internal
+	}
+
+	message := t.Title
+	if detail != "" {
+		message += ": " + detail
+	}
+	st := status.New(code, message)
+
+	info := &errdetails.ErrorInfo{Reason: t.Code, Domain: errorDomain}
+	var withDetails *status.Status
+	var err error
+	if len(errs) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, e := range errs {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       e.Field,
+				Description: e.Code + ": " + e.Message,
+			})
+		}
+		withDetails, err = st.WithDetails(info, badRequest)
+	} else {
+		withDetails, err = st.WithDetails(info)
+	}
+	if err != nil {
+		slog.Error("can't attach error details", "error", err)
+		return st
+	}
+	return withDetails
+}
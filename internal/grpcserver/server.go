@@ -0,0 +1,338 @@
+// Package grpcserver serves the gRPC API described in
+// api/gophermart/v1/gophermart.proto on top of the same storage and
+// authentication layers as the REST handlers.
+package grpcserver
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	gophermartv1 "github.com/mkarulina/loyalty-system-service.git/api/gophermart/v1"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"github.com/mkarulina/loyalty-system-service.git/internal/withdrawal"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log/slog"
+	"net"
+	"time"
+)
+
+type Server struct {
+	gophermartv1.UnimplementedGophermartServer
+
+	orderStg   storage.OrderStorage
+	historyStg storage.HistoryStorage
+	auth       authentication.Auth
+}
+
+func New(orderStg storage.OrderStorage, historyStg storage.HistoryStorage, auth authentication.Auth) *Server {
+	return &Server{
+		orderStg:   orderStg,
+		historyStg: historyStg,
+		auth:       auth,
+	}
+}
+
+// GRPCServer returns a grpc.Server with the service, tracing and the
+// token authentication installed.
+func (s *Server) GRPCServer() *grpc.Server {
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(traceCall, s.authenticate))
+	gophermartv1.RegisterGophermartServer(srv, s)
+	return srv
+}
+
+// gracefulStopTimeout bounds how long the calls in flight may take to
+// finish after ctx of ListenAndServe is done.
+const gracefulStopTimeout = 10 * time.Second
+
+// ListenAndServe serves the API on address until the listener fails or ctx
+// is done. In the latter case it stops accepting calls, waits for the calls
+// in flight and returns nil.
+func (s *Server) ListenAndServe(ctx context.Context, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	srv := s.GRPCServer()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		timer := time.AfterFunc(gracefulStopTimeout, srv.Stop)
+		defer timer.Stop()
+		srv.GracefulStop()
+	}()
+
+	slog.Info("gRPC API listening", "address", listener.Addr().String())
+	if err := srv.Serve(listener); err != nil {
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+func (s *Server) Register(ctx context.Context, req *gophermartv1.RegisterRequest) (*gophermartv1.RegisterResponse, error) {
+	login := validation.NormalizeLogin(req.GetLogin())
+	errs := append(validation.ValidateLogin(login), validation.PasswordPolicyFromConfig().Validate(req.GetPassword(), login)...)
+	if len(errs) > 0 {
+		return nil, validationError(errs)
+	}
+
+	token, err := authentication.NewSessionToken()
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+
+	e := encryption.New()
+	err = s.auth.AddUserInfoToTable(authentication.User{
+		Token:    token,
+		Login:    e.EncodeData(login),
+		Password: req.GetPassword(),
+	})
+	if err != nil {
+		if errors.Is(err, authentication.ErrLoginTaken) {
+			return nil, problemError(problem.LoginTaken, "")
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	return &gophermartv1.RegisterResponse{Token: token}, nil
+}
+
+func (s *Server) Login(ctx context.Context, req *gophermartv1.LoginRequest) (*gophermartv1.LoginResponse, error) {
+	login := validation.NormalizeLogin(req.GetLogin())
+	var errs validation.Errors
+	if login == "" {
+		errs = append(errs, validation.FieldError{Field: "login", Code: validation.CodeRequired, Message: "login is required"})
+	}
+	if req.GetPassword() == "" {
+		errs = append(errs, validation.FieldError{Field: "password", Code: validation.CodeRequired, Message: "password is required"})
+	}
+	if len(errs) > 0 {
+		return nil, validationError(errs)
+	}
+
+	e := encryption.New()
+	user, err := s.auth.CheckUserData(authentication.User{
+		Login:    e.EncodeData(login),
+		Password: req.GetPassword(),
+	})
+	if err != nil {
+		if errors.Is(err, authentication.ErrInvalidCredentials) {
+			return nil, problemError(problem.InvalidCredentials, "")
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	if user.TwoFactor {
+		return s.startLoginChallenge(ctx, user.ID)
+	}
+
+	token, err := authentication.NewSessionToken()
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	if err := s.auth.CreateSession(user.ID, token); err != nil {
+		return nil, internalError(ctx, err)
+	}
+
+	return &gophermartv1.LoginResponse{Token: token}, nil
+}
+
+// startLoginChallenge answers the password check of a user with two-factor
+// authentication with a challenge to complete in LoginTwoFactor. There is no
+// cookie to bind the challenge to, so it is bound to its own hash.
+func (s *Server) startLoginChallenge(ctx context.Context, userID string) (*gophermartv1.LoginResponse, error) {
+	random, err := encryption.New().GenerateRandom(16)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	challenge := hex.EncodeToString(random)
+	challengeHash := authentication.HashToken(challenge)
+	ttl := authentication.LoginChallengeTTL()
+
+	if err := s.auth.CreateLoginChallenge(userID, challengeHash, challengeHash, ttl); err != nil {
+		return nil, internalError(ctx, err)
+	}
+
+	return &gophermartv1.LoginResponse{
+		Challenge:          challenge,
+		ChallengeExpiresAt: timestamppb.New(time.Now().Add(ttl)),
+	}, nil
+}
+
+// LoginTwoFactor completes a login challenge with a TOTP or recovery code.
+// Every attempt is counted against the challenge before the code is checked.
+func (s *Server) LoginTwoFactor(ctx context.Context, req *gophermartv1.LoginTwoFactorRequest) (*gophermartv1.LoginResponse, error) {
+	var errs validation.Errors
+	if req.GetChallenge() == "" {
+		errs = append(errs, validation.FieldError{Field: "challenge", Code: validation.CodeRequired, Message: "challenge is required"})
+	}
+	if req.GetCode() == "" {
+		errs = append(errs, validation.FieldError{Field: "code", Code: validation.CodeRequired, Message: "code is required"})
+	}
+	if len(errs) > 0 {
+		return nil, validationError(errs)
+	}
+
+	challengeHash := authentication.HashToken(req.GetChallenge())
+
+	userID, err := s.auth.AttemptLoginChallenge(challengeHash, challengeHash)
+	if err != nil {
+		if errors.Is(err, authentication.ErrInvalidChallenge) {
+			return nil, problemError(problem.InvalidChallenge, "")
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	valid, err := authentication.VerifySecondFactor(s.auth, userID, req.GetCode())
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	if !valid {
+		return nil, problemError(problem.InvalidSecondFactor, "")
+	}
+
+	token, err := authentication.NewSessionToken()
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+	if err := s.auth.CompleteLoginChallenge(challengeHash, token); err != nil {
+		if errors.Is(err, authentication.ErrInvalidChallenge) {
+			return nil, problemError(problem.InvalidChallenge, "")
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	return &gophermartv1.LoginResponse{Token: token}, nil
+}
+
+func (s *Server) UploadOrder(ctx context.Context, req *gophermartv1.UploadOrderRequest) (*gophermartv1.UploadOrderResponse, error) {
+	principal, ok := authentication.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, problemError(problem.Unauthorized, "")
+	}
+
+	if !validation.OrderDigits(req.GetNumber()) {
+		return nil, problemError(problem.MalformedRequest, "order number must contain digits only")
+	}
+	if !validation.Luhn(req.GetNumber()) {
+		return nil, problemError(problem.InvalidOrder, "")
+	}
+
+	err := s.orderStg.AddOrderNumber(ctx, req.GetNumber(), principal.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrOrderExists) {
+			return &gophermartv1.UploadOrderResponse{AlreadyUploaded: true}, nil
+		}
+		if errors.Is(err, storage.ErrOrderOwnedByAnotherUser) {
+			return nil, problemError(problem.OrderOfOtherUser, "")
+		}
+		return nil, internalError(ctx, err)
+	}
+
+	return &gophermartv1.UploadOrderResponse{}, nil
+}
+
+func (s *Server) ListOrders(ctx context.Context, req *gophermartv1.ListOrdersRequest) (*gophermartv1.ListOrdersResponse, error) {
+	principal, ok := authentication.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, problemError(problem.Unauthorized, "")
+	}
+
+	orders, err := s.orderStg.GetUserOrders(ctx, principal.UserID)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+
+	resp := &gophermartv1.ListOrdersResponse{}
+	for _, o := range orders {
+		resp.Orders = append(resp.Orders, &gophermartv1.Order{
+			Number:     o.Number,
+			Status:     o.Status,
+			Accrual:    float64(o.Accrual),
+			UploadedAt: timestamppb.New(o.UploadedAt),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) GetBalance(ctx context.Context, req *gophermartv1.GetBalanceRequest) (*gophermartv1.GetBalanceResponse, error) {
+	principal, ok := authentication.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, problemError(problem.Unauthorized, "")
+	}
+
+	balance, withdrawn, err := s.orderStg.GetUserBalanceAndWithdrawn(ctx, principal.UserID)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+
+	return &gophermartv1.GetBalanceResponse{Current: float64(balance), Withdrawn: float64(withdrawn)}, nil
+}
+
+// Withdraw follows the same steps as the REST handler: the request rules,
+// then the withdrawal, which checks the usage rules and the balance itself.
+func (s *Server) Withdraw(ctx context.Context, req *gophermartv1.WithdrawRequest) (*gophermartv1.WithdrawResponse, error) {
+	principal, ok := authentication.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, problemError(problem.Unauthorized, "")
+	}
+
+	order := req.GetOrder()
+	sum := req.GetSum()
+
+	rules := withdrawal.RulesFromConfig()
+	if rejection := rules.CheckRequest(order, sum); rejection != nil {
+		return nil, problemError(rejection.Problem(), rejection.Message)
+	}
+
+	err := s.orderStg.Withdraw(ctx, principal.UserID, order, sum, rules)
+	if err != nil {
+		var rejection *withdrawal.Rejection
+		switch {
+		case errors.As(err, &rejection):
+			return nil, problemError(rejection.Problem(), rejection.Message)
+		case errors.Is(err, storage.ErrInsufficientFunds):
+			return nil, problemError(problem.InsufficientFunds, "")
+		case errors.Is(err, storage.ErrOrderOwnedByAnotherUser):
+			return nil, problemError(problem.OrderOfOtherUser, "")
+		default:
+			return nil, internalError(ctx, err)
+		}
+	}
+
+	return &gophermartv1.WithdrawResponse{}, nil
+}
+
+func (s *Server) ListWithdrawals(ctx context.Context, req *gophermartv1.ListWithdrawalsRequest) (*gophermartv1.ListWithdrawalsResponse, error) {
+	principal, ok := authentication.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, problemError(problem.Unauthorized, "")
+	}
+
+	withdrawals, err := s.historyStg.GetWithdrawalsHistory(ctx, principal.UserID)
+	if err != nil {
+		return nil, internalError(ctx, err)
+	}
+
+	resp := &gophermartv1.ListWithdrawalsResponse{}
+	for _, w := range withdrawals {
+		item := &gophermartv1.Withdrawal{
+			Id:          w.ID,
+			Order:       w.OrderNumber,
+			Sum:         float64(w.Sum),
+			ProcessedAt: timestamppb.New(w.ProcessedAt),
+		}
+		if w.ReversedAt != nil {
+			item.ReversedAt = timestamppb.New(*w.ReversedAt)
+		}
+		resp.Withdrawals = append(resp.Withdrawals, item)
+	}
+	return resp, nil
+}
@@ -0,0 +1,247 @@
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/golang/mock/gomock"
+	gophermartv1 "github.com/mkarulina/loyalty-system-service.git/api/gophermart/v1"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+const testToken = "0123456789abcdef0123456789abcdef"
+
+type testEnv struct {
+	client     gophermartv1.GophermartClient
+	orderStg   *mock_storage.MockOrderStorage
+	historyStg *mock_storage.MockHistoryStorage
+	auth       *mock_authentication.MockAuth
+}
+
+// newTestEnv serves the API over an in-memory listener so that the calls go
+// through the interceptor and the status encoding.
+func newTestEnv(t *testing.T) *testEnv {
+	ctrl := gomock.NewController(t)
+
+	env := &testEnv{
+		orderStg:   mock_storage.NewMockOrderStorage(ctrl),
+		historyStg: mock_storage.NewMockHistoryStorage(ctrl),
+		auth:       mock_authentication.NewMockAuth(ctrl),
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	srv := New(env.orderStg, env.historyStg, env.auth).GRPCServer()
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	env.client = gophermartv1.NewGophermartClient(conn)
+	return env
+}
+
+func (env *testEnv) signedIn() context.Context {
+	env.auth.EXPECT().GetUserByToken(testToken).Return(&authentication.User{ID: "testUserID", Role: authentication.RoleUser}, nil)
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+testToken)
+}
+
+func requireStatus(t *testing.T, err error, code codes.Code, reason string) {
+	t.Helper()
+
+	st, ok := status.FromError(err)
+	require.True(t, ok, err)
+	require.Equal(t, code, st.Code())
+
+	var info *errdetails.ErrorInfo
+	for _, d := range st.Details() {
+		if i, ok := d.(*errdetails.ErrorInfo); ok {
+			info = i
+		}
+	}
+	require.NotNil(t, info)
+	require.Equal(t, reason, info.Reason)
+	require.Equal(t, errorDomain, info.Domain)
+}
+
+func TestServer_ListenAndServe_gracefulStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- New(nil, nil, nil).ListenAndServe(ctx, "127.0.0.1:0")
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+}
+
+func TestServer_authentication(t *testing.T) {
+	env := newTestEnv(t)
+
+	_, err := env.client.GetBalance(context.Background(), &gophermartv1.GetBalanceRequest{})
+	requireStatus(t, err, codes.Unauthenticated, "unauthorized")
+
+	env.auth.EXPECT().GetUserByToken(testToken).Return(nil, nil)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+testToken)
+	_, err = env.client.GetBalance(ctx, &gophermartv1.GetBalanceRequest{})
+	requireStatus(t, err, codes.Unauthenticated, "unauthorized")
+}
+
+func TestServer_GetBalance(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.orderStg.EXPECT().GetUserBalanceAndWithdrawn(gomock.Any(), "testUserID").Return(float32(500), float32(300), nil)
+
+	resp, err := env.client.GetBalance(env.signedIn(), &gophermartv1.GetBalanceRequest{})
+	require.NoError(t, err)
+	require.Equal(t, float64(500), resp.GetCurrent())
+	require.Equal(t, float64(300), resp.GetWithdrawn())
+
+	env.orderStg.EXPECT().GetUserBalanceAndWithdrawn(gomock.Any(), "testUserID").Return(float32(0), float32(0), errors.New("some error"))
+
+	_, err = env.client.GetBalance(env.signedIn(), &gophermartv1.GetBalanceRequest{})
+	requireStatus(t, err, codes.Internal, "internal_error")
+}
+
+func TestServer_UploadOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		number     string
+		storageErr error
+		wantCode   codes.Code
+		wantReason string
+		wantExists bool
+	}{
+		{name: "accepted", number: "12345678903"},
+		{name: "already uploaded", number: "12345678903", storageErr: storage.ErrOrderExists, wantExists: true},
+		{name: "another user", number: "12345678903", storageErr: storage.ErrOrderOwnedByAnotherUser, wantCode: codes.AlreadyExists, wantReason: "order_owned_by_another_user"},
+		{name: "luhn", number: "12345678904", wantCode: codes.InvalidArgument, wantReason: "invalid_order_number"},
+		{name: "not digits", number: "12a45", wantCode: codes.InvalidArgument, wantReason: "malformed_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+
+			if tt.wantReason == "" || tt.storageErr != nil {
+				env.orderStg.EXPECT().AddOrderNumber(gomock.Any(), tt.number, "testUserID").Return(tt.storageErr)
+			}
+
+			resp, err := env.client.UploadOrder(env.signedIn(), &gophermartv1.UploadOrderRequest{Number: tt.number})
+			if tt.wantReason != "" {
+				requireStatus(t, err, tt.wantCode, tt.wantReason)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantExists, resp.GetAlreadyUploaded())
+		})
+	}
+}
+
+func TestServer_Withdraw_insufficientFunds(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.orderStg.EXPECT().Withdraw(gomock.Any(), "testUserID", "2377225624", float64(100), gomock.Any()).Return(storage.ErrInsufficientFunds)
+
+	_, err := env.client.Withdraw(env.signedIn(), &gophermartv1.WithdrawRequest{Order: "2377225624", Sum: 100})
+	requireStatus(t, err, codes.FailedPrecondition, "insufficient_funds")
+}
+
+func TestServer_Withdraw_orderOfAnotherUser(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.orderStg.EXPECT().Withdraw(gomock.Any(), "testUserID", "2377225624", float64(100), gomock.Any()).Return(storage.ErrOrderOwnedByAnotherUser)
+
+	_, err := env.client.Withdraw(env.signedIn(), &gophermartv1.WithdrawRequest{Order: "2377225624", Sum: 100})
+	requireStatus(t, err, codes.AlreadyExists, "order_owned_by_another_user")
+}
+
+func TestServer_LoginTwoFactor(t *testing.T) {
+	viper.Set("ENCRYPTION_KEY", "test:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	t.Cleanup(viper.Reset)
+
+	env := newTestEnv(t)
+
+	encSecret, err := encryption.New().EncryptData([]byte("JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+
+	env.auth.EXPECT().CheckUserData(gomock.Any()).Return(&authentication.User{ID: "7", TwoFactor: true}, nil)
+	var challengeHash string
+	env.auth.EXPECT().CreateLoginChallenge("7", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ string, hash string, token string, _ time.Duration) error {
+		challengeHash = hash
+		require.Equal(t, hash, token)
+		return nil
+	})
+
+	resp, err := env.client.Login(context.Background(), &gophermartv1.LoginRequest{Login: "user", Password: "password"})
+	require.NoError(t, err)
+	require.Empty(t, resp.GetToken())
+	require.NotEmpty(t, resp.GetChallenge())
+	require.Equal(t, challengeHash, authentication.HashToken(resp.GetChallenge()))
+
+	// a wrong code still uses up an attempt
+	env.auth.EXPECT().AttemptLoginChallenge(challengeHash, challengeHash).Return("7", nil)
+	env.auth.EXPECT().GetTOTP("7").Return(encSecret, true, nil)
+	env.auth.EXPECT().UseRecoveryCode("7", authentication.HashRecoveryCode("00000-00000")).Return(false, nil)
+
+	_, err = env.client.LoginTwoFactor(context.Background(), &gophermartv1.LoginTwoFactorRequest{Challenge: resp.GetChallenge(), Code: "00000-00000"})
+	requireStatus(t, err, codes.Unauthenticated, "invalid_second_factor")
+
+	env.auth.EXPECT().AttemptLoginChallenge(challengeHash, challengeHash).Return("7", nil)
+	env.auth.EXPECT().GetTOTP("7").Return(encSecret, true, nil)
+	env.auth.EXPECT().UseRecoveryCode("7", authentication.HashRecoveryCode("abcde-12345")).Return(true, nil)
+	env.auth.EXPECT().CompleteLoginChallenge(challengeHash, gomock.Any()).Return(nil)
+
+	done, err := env.client.LoginTwoFactor(context.Background(), &gophermartv1.LoginTwoFactorRequest{Challenge: resp.GetChallenge(), Code: "abcde-12345"})
+	require.NoError(t, err)
+	require.NotEmpty(t, done.GetToken())
+
+	// once the attempts are used up the password has to be entered again
+	env.auth.EXPECT().AttemptLoginChallenge(challengeHash, challengeHash).Return("", authentication.ErrInvalidChallenge)
+
+	_, err = env.client.LoginTwoFactor(context.Background(), &gophermartv1.LoginTwoFactorRequest{Challenge: resp.GetChallenge(), Code: "abcde-12345"})
+	requireStatus(t, err, codes.Unauthenticated, "invalid_challenge")
+}
+
+func TestServer_Register_validation(t *testing.T) {
+	env := newTestEnv(t)
+
+	_, err := env.client.Register(context.Background(), &gophermartv1.RegisterRequest{Login: "", Password: ""})
+	requireStatus(t, err, codes.InvalidArgument, "validation_failed")
+
+	st, _ := status.FromError(err)
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, d := range st.Details() {
+		if b, ok := d.(*errdetails.BadRequest); ok {
+			violations = b.GetFieldViolations()
+		}
+	}
+	require.NotEmpty(t, violations)
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type exportProfile struct {
+	ID        string `json:"id"`
+	Login     string `json:"login"`
+	Role      string `json:"role"`
+	TwoFactor bool   `json:"two_factor"`
+}
+
+type exportAccrual struct {
+	Order   string  `json:"order"`
+	Status  string  `json:"status"`
+	Accrual float32 `json:"accrual"`
+}
+
+type exportSession struct {
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type exportAuditRecord struct {
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportFile struct {
+	name string
+	data interface{}
+}
+
+// ExportHandler returns a zip archive with a JSON file for every kind of
+// personal data kept about the user.
+func (h *handler) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	files, err := h.exportFiles(r.Context(), principal)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	for _, f := range files {
+		fw, err := archive.Create(f.name)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	err = h.auth.AddAuditRecord(authentication.AuditRecord{
+		UserID: principal.UserID,
+		Actor:  principal.UserID,
+		Action: authentication.AuditDataExport,
+	})
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="gophermart-export.zip"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func (h *handler) exportFiles(ctx context.Context, principal authentication.Principal) ([]exportFile, error) {
+	user, err := h.auth.GetUserByID(principal.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		user = &authentication.User{ID: principal.UserID, Login: principal.Login}
+	}
+	login, err := encryption.New().DecodeData(user.Login)
+	if err != nil {
+		login = user.Login
+	}
+
+	orders, err := h.orderStg.GetUserOrders(ctx, principal.UserID)
+	if err != nil {
+		return nil, err
+	}
+	accruals := []exportAccrual{}
+	for _, o := range orders {
+		if o.Accrual > 0 {
+			accruals = append(accruals, exportAccrual{Order: o.Number, Status: o.Status, Accrual: o.Accrual})
+		}
+	}
+
+	history, err := h.historyStg.GetWithdrawalsHistory(ctx, principal.UserID)
+	if err != nil {
+		return nil, err
+	}
+	withdrawals := []withdrawalsHistoryResp{}
+	for _, wd := range history {
+		withdrawals = append(withdrawals, newWithdrawalResp(wd))
+	}
+
+	sessions, err := h.auth.ListSessions(principal.UserID)
+	if err != nil {
+		return nil, err
+	}
+	exportSessions := []exportSession{}
+	for _, s := range sessions {
+		exportSessions = append(exportSessions, exportSession{ID: s.ID, CreatedAt: s.CreatedAt, RevokedAt: s.RevokedAt})
+	}
+
+	records, err := h.auth.ListAuditRecords(principal.UserID)
+	if err != nil {
+		return nil, err
+	}
+	audit := []exportAuditRecord{}
+	for _, rec := range records {
+		audit = append(audit, exportAuditRecord{Action: rec.Action, Actor: rec.Actor, CreatedAt: rec.CreatedAt})
+	}
+
+	return []exportFile{
+		{name: "profile.json", data: exportProfile{ID: user.ID, Login: login, Role: user.Role, TwoFactor: principal.TwoFactor}},
+		{name: "orders.json", data: newOrdersResp(orders)},
+		{name: "accruals.json", data: accruals},
+		{name: "withdrawals.json", data: withdrawals},
+		{name: "sessions.json", data: exportSessions},
+		{name: "audit.json", data: audit},
+	}, nil
+}
+
+type deleteAccountReq struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+}
+
+// DeleteAccountHandler anonymises the account of the current user. Orders
+// and withdrawals are kept for accounting under the numeric user id, which
+// no longer leads to a login. A stolen session is not enough: the user
+// confirms with the current password, or with the second factor when it is
+// enabled.
+func (h *handler) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	req := deleteAccountReq{}
+	errs := decodeStrict(body, &req)
+	if len(errs) == 0 {
+		if principal.TwoFactor {
+			errs = requiredField("code", req.Code)
+		} else {
+			errs = requiredField("current_password", req.CurrentPassword)
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	if principal.TwoFactor {
+		valid, err := authentication.VerifySecondFactor(h.auth, principal.UserID, req.Code)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		if !valid {
+			problem.Write(w, r, problem.InvalidSecondFactor, "")
+			return
+		}
+	} else {
+		user, err := h.auth.CheckUserData(authentication.User{Login: principal.Login, Password: req.CurrentPassword})
+		if err != nil && !errors.Is(err, authentication.ErrInvalidCredentials) {
+			problem.WriteError(w, r, err)
+			return
+		}
+		if err != nil || user.ID != principal.UserID {
+			problem.Write(w, r, problem.WrongPassword, "")
+			return
+		}
+	}
+
+	e := encryption.New()
+
+	random, err := e.GenerateRandom(8)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	pseudonym := "deleted-" + hex.EncodeToString(random)
+
+	err = h.auth.AnonymizeUser(principal.UserID, e.EncodeData(pseudonym), authentication.AuditRecord{
+		UserID:  principal.UserID,
+		Actor:   principal.UserID,
+		Action:  authentication.AuditAccountDeletion,
+		Details: pseudonym,
+	})
+	if err != nil {
+		if errors.Is(err, authentication.ErrUserNotFound) {
+			problem.Write(w, r, problem.UserNotFound, "")
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: "session_token", Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_handler_ExportHandler(t *testing.T) {
+	withTestEncryptionKey(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	auth.EXPECT().GetUserByID("testUserID").Return(&authentication.User{
+		ID:    "testUserID",
+		Login: encryption.New().EncodeData("alice1"),
+		Role:  authentication.RoleUser,
+	}, nil)
+	orderStg.EXPECT().GetUserOrders(gomock.Any(), "testUserID").Return([]storage.Order{
+		{Number: "12345678903", Status: "PROCESSED", Accrual: 500, UploadedAt: now},
+		{Number: "9278923470", Status: "NEW", UploadedAt: now},
+	}, nil)
+	historyStg.EXPECT().GetWithdrawalsHistory(gomock.Any(), "testUserID").Return([]storage.Withdrawn{
+		{OrderNumber: "2377225624", Sum: 100, ProcessedAt: now},
+	}, nil)
+	auth.EXPECT().ListSessions("testUserID").Return([]authentication.Session{{ID: "1", CreatedAt: now}}, nil)
+	auth.EXPECT().ListAuditRecords("testUserID").Return([]authentication.AuditRecord{}, nil)
+	auth.EXPECT().AddAuditRecord(authentication.AuditRecord{
+		UserID: "testUserID",
+		Actor:  "testUserID",
+		Action: authentication.AuditDataExport,
+	}).Return(nil)
+
+	rec := httptest.NewRecorder()
+	req := withPrincipal(httptest.NewRequest(http.MethodGet, "/api/user/export", nil), "testUserID")
+
+	http.HandlerFunc(h.ExportHandler).ServeHTTP(rec, req)
+
+	result := rec.Result()
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	require.Equal(t, "application/zip", result.Header.Get("Content-Type"))
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], err = io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	}
+	require.Len(t, files, 6)
+
+	profile := exportProfile{}
+	require.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+	require.Equal(t, "alice1", profile.Login)
+
+	accruals := []exportAccrual{}
+	require.NoError(t, json.Unmarshal(files["accruals.json"], &accruals))
+	require.Equal(t, []exportAccrual{{Order: "12345678903", Status: "PROCESSED", Accrual: 500}}, accruals)
+
+	require.Contains(t, string(files["withdrawals.json"]), "2377225624")
+	require.Contains(t, string(files["sessions.json"]), `"id": "1"`)
+}
+
+func Test_handler_DeleteAccountHandler(t *testing.T) {
+	withTestEncryptionKey(t)
+
+	e := encryption.New()
+	login := e.EncodeData("alice")
+	encSecret, err := e.EncryptData([]byte("JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		twoFactor      bool
+		body           string
+		prepare        func(auth *mock_authentication.MockAuth)
+		err            error
+		anonymize      bool
+		wantStatusCode int
+		wantProblem    string
+	}{
+		{
+			name: "deleted",
+			body: `{"current_password":"secret"}`,
+			prepare: func(auth *mock_authentication.MockAuth) {
+				auth.EXPECT().CheckUserData(authentication.User{Login: login, Password: "secret"}).Return(&authentication.User{ID: "testUserID"}, nil)
+			},
+			anonymize:      true,
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name: "already deleted",
+			body: `{"current_password":"secret"}`,
+			prepare: func(auth *mock_authentication.MockAuth) {
+				auth.EXPECT().CheckUserData(gomock.Any()).Return(&authentication.User{ID: "testUserID"}, nil)
+			},
+			err:            authentication.ErrUserNotFound,
+			anonymize:      true,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name: "db error",
+			body: `{"current_password":"secret"}`,
+			prepare: func(auth *mock_authentication.MockAuth) {
+				auth.EXPECT().CheckUserData(gomock.Any()).Return(&authentication.User{ID: "testUserID"}, nil)
+			},
+			err:            errors.New("boom"),
+			anonymize:      true,
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "password missing",
+			body:           `{}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    problem.ValidationFailed.Code,
+		},
+		{
+			name: "wrong password",
+			body: `{"current_password":"wrong"}`,
+			prepare: func(auth *mock_authentication.MockAuth) {
+				auth.EXPECT().CheckUserData(gomock.Any()).Return(nil, authentication.ErrInvalidCredentials)
+			},
+			wantStatusCode: http.StatusForbidden,
+			wantProblem:    problem.WrongPassword.Code,
+		},
+		{
+			name:      "recovery code",
+			twoFactor: true,
+			body:      `{"code":"abcde12345"}`,
+			prepare: func(auth *mock_authentication.MockAuth) {
+				auth.EXPECT().GetTOTP("testUserID").Return(encSecret, true, nil)
+				auth.EXPECT().UseRecoveryCode("testUserID", authentication.HashRecoveryCode("abcde12345")).Return(true, nil)
+			},
+			anonymize:      true,
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "password instead of second factor",
+			twoFactor:      true,
+			body:           `{"current_password":"secret"}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    problem.ValidationFailed.Code,
+		},
+		{
+			name:      "wrong code",
+			twoFactor: true,
+			body:      `{"code":"000000"}`,
+			prepare: func(auth *mock_authentication.MockAuth) {
+				auth.EXPECT().GetTOTP("testUserID").Return(encSecret, true, nil)
+				auth.EXPECT().UseRecoveryCode("testUserID", gomock.Any()).Return(false, nil)
+			},
+			wantStatusCode: http.StatusUnauthorized,
+			wantProblem:    problem.InvalidSecondFactor.Code,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			orderStg := mock_storage.NewMockOrderStorage(ctrl)
+			historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+			auth := mock_authentication.NewMockAuth(ctrl)
+
+			h := NewHandler(orderStg, historyStg, auth)
+
+			if tt.prepare != nil {
+				tt.prepare(auth)
+			}
+			if tt.anonymize {
+				auth.EXPECT().AnonymizeUser("testUserID", gomock.Any(), gomock.Any()).DoAndReturn(
+					func(userID string, pseudonym string, record authentication.AuditRecord) error {
+						decoded, err := e.DecodeData(pseudonym)
+						require.NoError(t, err)
+						require.True(t, strings.HasPrefix(decoded, "deleted-"))
+						require.Equal(t, authentication.AuditAccountDeletion, record.Action)
+						require.Equal(t, "testUserID", record.UserID)
+						return tt.err
+					})
+			}
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodDelete, "/api/user", strings.NewReader(tt.body))
+			req = req.WithContext(authentication.ContextWithPrincipal(req.Context(), authentication.Principal{
+				UserID:    "testUserID",
+				Login:     login,
+				Roles:     []string{authentication.RoleUser},
+				TwoFactor: tt.twoFactor,
+			}))
+
+			http.HandlerFunc(h.DeleteAccountHandler).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+			if tt.wantProblem != "" {
+				requireProblem(t, result, body, tt.wantProblem)
+			}
+		})
+	}
+}
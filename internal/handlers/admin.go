@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+type adminUserResp struct {
+	ID    string `json:"id"`
+	Login string `json:"login"`
+	Role  string `json:"role"`
+}
+
+type adminLedgerResp struct {
+	Current     float32                  `json:"current"`
+	Withdrawn   float32                  `json:"withdrawn"`
+	Accruals    []orderResp              `json:"accruals"`
+	Withdrawals []withdrawalsHistoryResp `json:"withdrawals"`
+}
+
+type adminRoleReq struct {
+	Role string `json:"role"`
+}
+
+func newAdminUserResp(e encryption.Encryptor, u *authentication.User) adminUserResp {
+	login, err := e.DecodeData(u.Login)
+	if err != nil {
+		login = u.Login
+	}
+	return adminUserResp{ID: u.ID, Login: login, Role: u.Role}
+}
+
+func newOrdersResp(orders []storage.Order) []orderResp {
+	resp := []orderResp{}
+	for _, o := range orders {
+		resp = append(resp, newOrderResp(o))
+	}
+	return resp
+}
+
+// adminUser loads the user named by the {id} URL parameter and writes
+// the error response itself when there is none.
+func (h *handler) adminUser(w http.ResponseWriter, r *http.Request) (*authentication.User, bool) {
+	id := chi.URLParam(r, "id")
+	if !validID(id) {
+		problem.Write(w, r, problem.UserNotFound, "")
+		return nil, false
+	}
+
+	user, err := h.auth.GetUserByID(id)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return nil, false
+	}
+	if user == nil {
+		problem.Write(w, r, problem.UserNotFound, "")
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *handler) AdminFindUserHandler(w http.ResponseWriter, r *http.Request) {
+	login := validation.NormalizeLogin(r.URL.Query().Get("login"))
+	if login == "" {
+		problem.WriteValidation(w, r, requiredField("login", login))
+		return
+	}
+
+	e := encryption.New()
+
+	user, err := h.auth.GetUserByLogin(e.EncodeData(login))
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	if user == nil {
+		problem.Write(w, r, problem.UserNotFound, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAdminUserResp(e, user))
+}
+
+func (h *handler) AdminGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAdminUserResp(encryption.New(), user))
+}
+
+func (h *handler) AdminGetUserOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	orders, err := h.orderStg.GetUserOrders(r.Context(), user.ID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newOrdersResp(orders))
+}
+
+func (h *handler) AdminGetUserLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	balance, withdrawn, err := h.orderStg.GetUserBalanceAndWithdrawn(r.Context(), user.ID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	orders, err := h.orderStg.GetUserOrders(r.Context(), user.ID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	withdrawals, err := h.historyStg.GetWithdrawalsHistory(r.Context(), user.ID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	resp := adminLedgerResp{
+		Current:     balance,
+		Withdrawn:   withdrawn,
+		Accruals:    []orderResp{},
+		Withdrawals: []withdrawalsHistoryResp{},
+	}
+	for _, o := range newOrdersResp(orders) {
+		if o.Accrual > 0 {
+			resp.Accruals = append(resp.Accruals, o)
+		}
+	}
+	for _, wd := range withdrawals {
+		resp.Withdrawals = append(resp.Withdrawals, newWithdrawalResp(wd))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) AdminSetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	unmarshalBody := adminRoleReq{}
+	if err := json.Unmarshal(body, &unmarshalBody); err != nil || !authentication.ValidRole(unmarshalBody.Role) {
+		writeValidationErrors(w, r, validation.Errors{{Field: "role", Code: "invalid", Message: "role must be one of user, support, admin"}})
+		return
+	}
+
+	user, ok := h.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.auth.SetUserRole(user.ID, unmarshalBody.Role)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	user.Role = unmarshalBody.Role
+	writeJSON(w, http.StatusOK, newAdminUserResp(encryption.New(), user))
+}
+
+func (h *handler) AdminReprocessOrderHandler(w http.ResponseWriter, r *http.Request) {
+	err := h.orderStg.ReprocessOrder(r.Context(), chi.URLParam(r, "number"))
+	if err != nil {
+		if errors.Is(err, storage.ErrOrderNotFound) {
+			problem.Write(w, r, problem.OrderNotFound, "")
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/golang/mock/gomock"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withURLParams(req *http.Request, params map[string]string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for k, v := range params {
+		rctx.URLParams.Add(k, v)
+	}
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func Test_handler_AdminFindUserHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	encLogin := encryption.New().EncodeData("testlogin")
+	auth.EXPECT().GetUserByLogin(encLogin).Return(&authentication.User{ID: "7", Login: encLogin, Role: authentication.RoleUser}, nil)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/users?login=TestLogin", nil)
+
+	handler := http.HandlerFunc(h.AdminFindUserHandler)
+	handler.ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+
+	resp := adminUserResp{}
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+	require.Equal(t, adminUserResp{ID: "7", Login: "testlogin", Role: authentication.RoleUser}, resp)
+
+	err := result.Body.Close()
+	require.NoError(t, err)
+}
+
+func Test_handler_AdminGetUserLedgerHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	processedAt := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	auth.EXPECT().GetUserByID("7").Return(&authentication.User{ID: "7", Role: authentication.RoleUser}, nil)
+	orderStg.EXPECT().GetUserBalanceAndWithdrawn(gomock.Any(), "7").Return(float32(400), float32(100), nil)
+	orderStg.EXPECT().GetUserOrders(gomock.Any(), "7").Return([]storage.Order{
+		{Number: "9278923470", Status: "PROCESSED", Accrual: 500, UploadedAt: processedAt},
+		{Number: "12345678903", Status: "NEW", UploadedAt: processedAt},
+	}, nil)
+	historyStg.EXPECT().GetWithdrawalsHistory(gomock.Any(), "7").Return([]storage.Withdrawn{
+		{UserID: "7", OrderNumber: "2377225624", Sum: 100, ProcessedAt: processedAt},
+	}, nil)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/users/7/ledger", nil)
+	req = withURLParams(req, map[string]string{"id": "7"})
+
+	handler := http.HandlerFunc(h.AdminGetUserLedgerHandler)
+	handler.ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+
+	resp := adminLedgerResp{}
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+	require.Equal(t, float32(400), resp.Current)
+	require.Len(t, resp.Accruals, 1)
+	require.Equal(t, "9278923470", resp.Accruals[0].Number)
+	require.Len(t, resp.Withdrawals, 1)
+
+	err := result.Body.Close()
+	require.NoError(t, err)
+}
+
+func Test_handler_AdminGetUserHandler_notFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	auth.EXPECT().GetUserByID("7").Return(nil, nil)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/users/7", nil)
+	req = withURLParams(req, map[string]string{"id": "7"})
+
+	handler := http.HandlerFunc(h.AdminGetUserHandler)
+	handler.ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusNotFound, result.StatusCode)
+
+	err := result.Body.Close()
+	require.NoError(t, err)
+}
+
+func Test_handler_AdminGetUserHandler_invalidID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h := NewHandler(mock_storage.NewMockOrderStorage(ctrl), mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/users/abc", nil)
+	req = withURLParams(req, map[string]string{"id": "abc"})
+
+	handler := http.HandlerFunc(h.AdminGetUserHandler)
+	handler.ServeHTTP(rec, req)
+
+	result := rec.Result()
+	body, _ := io.ReadAll(result.Body)
+	requireProblem(t, result, body, "user_not_found")
+
+	err := result.Body.Close()
+	require.NoError(t, err)
+}
+
+func Test_handler_AdminSetUserRoleHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+
+	tests := []struct {
+		name           string
+		reqBody        string
+		auth           func() *mock_authentication.MockAuth
+		wantStatusCode int
+	}{
+		{
+			name:    "ok",
+			reqBody: `{"role": "support"}`,
+			auth: func() *mock_authentication.MockAuth {
+				auth := mock_authentication.NewMockAuth(ctrl)
+				auth.EXPECT().GetUserByID("7").Return(&authentication.User{ID: "7", Role: authentication.RoleUser}, nil)
+				auth.EXPECT().SetUserRole("7", authentication.RoleSupport).Return(nil)
+				return auth
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:    "unknown role",
+			reqBody: `{"role": "owner"}`,
+			auth: func() *mock_authentication.MockAuth {
+				return mock_authentication.NewMockAuth(ctrl)
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:    "auth error",
+			reqBody: `{"role": "admin"}`,
+			auth: func() *mock_authentication.MockAuth {
+				auth := mock_authentication.NewMockAuth(ctrl)
+				auth.EXPECT().GetUserByID("7").Return(&authentication.User{ID: "7", Role: authentication.RoleUser}, nil)
+				auth.EXPECT().SetUserRole("7", authentication.RoleAdmin).Return(errors.New("some error"))
+				return auth
+			},
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(orderStg, historyStg, tt.auth())
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, "/api/admin/users/7/role", strings.NewReader(tt.reqBody))
+			req = withURLParams(req, map[string]string{"id": "7"})
+
+			handler := http.HandlerFunc(h.AdminSetUserRoleHandler)
+			handler.ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+
+			_, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			err = result.Body.Close()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_handler_AdminReprocessOrderHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	orderStg.EXPECT().ReprocessOrder(gomock.Any(), "9278923470").Return(nil)
+	orderStg.EXPECT().ReprocessOrder(gomock.Any(), "12345678903").Return(storage.ErrOrderNotFound)
+
+	for number, wantStatusCode := range map[string]int{
+		"9278923470":  http.StatusAccepted,
+		"12345678903": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/orders/"+number+"/reprocess", nil)
+		req = withURLParams(req, map[string]string{"number": number})
+
+		handler := http.HandlerFunc(h.AdminReprocessOrderHandler)
+		handler.ServeHTTP(rec, req)
+
+		result := rec.Result()
+		require.Equal(t, wantStatusCode, result.StatusCode)
+
+		err := result.Body.Close()
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const apiKeyPrefix = "gk_"
+
+type createAPIKeyReq struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type apiKeyResp struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Secret     string     `json:"secret,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	UsageCount int64      `json:"usage_count"`
+}
+
+type apiKeyGrantResp struct {
+	APIKeyID  string    `json:"api_key_id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+func newAPIKeyResp(k authentication.APIKey) apiKeyResp {
+	scopes := k.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return apiKeyResp{
+		ID:         k.ID,
+		Name:       k.Name,
+		Scopes:     scopes,
+		CreatedBy:  k.CreatedBy,
+		CreatedAt:  k.CreatedAt,
+		RevokedAt:  k.RevokedAt,
+		LastUsedAt: k.LastUsedAt,
+		UsageCount: k.UsageCount,
+	}
+}
+
+// CreateAPIKeyHandler returns the signing secret of the new key. It is the
+// only time the secret is shown.
+func (h *handler) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	req := createAPIKeyReq{}
+	errs := decodeStrict(body, &req)
+	if len(errs) == 0 {
+		errs = requiredField("name", req.Name)
+		if len(req.Scopes) == 0 {
+			errs = append(errs, validation.FieldError{Field: "scopes", Code: validation.CodeRequired, Message: "scopes is required"})
+		}
+		for _, scope := range req.Scopes {
+			if !authentication.ValidScope(scope) {
+				errs = append(errs, validation.FieldError{Field: "scopes", Code: "invalid", Message: "unknown scope " + scope})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	e := encryption.New()
+
+	id, err := e.GenerateRandom(12)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	secret, err := e.GenerateRandom(32)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	encodedSecret := hex.EncodeToString(secret)
+
+	encSecret, err := e.EncryptData([]byte(encodedSecret))
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	key := authentication.APIKey{
+		ID:        apiKeyPrefix + hex.EncodeToString(id),
+		Name:      req.Name,
+		Secret:    encSecret,
+		Scopes:    req.Scopes,
+		CreatedBy: principal.UserID,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	err = h.auth.CreateAPIKey(key)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	resp := newAPIKeyResp(key)
+	resp.Secret = encodedSecret
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (h *handler) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.auth.ListAPIKeys()
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	resp := []apiKeyResp{}
+	for _, k := range keys {
+		resp = append(resp, newAPIKeyResp(k))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	err := h.auth.RevokeAPIKey(chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, authentication.ErrAPIKeyNotFound) {
+			problem.Write(w, r, problem.APIKeyNotFound, "")
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) ListPartnerGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	grants, err := h.auth.ListAPIKeyGrants(principal.UserID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	resp := []apiKeyGrantResp{}
+	for _, g := range grants {
+		scopes := g.Scopes
+		if scopes == nil {
+			scopes = []string{}
+		}
+		resp = append(resp, apiKeyGrantResp{
+			APIKeyID:  g.APIKeyID,
+			Name:      g.Name,
+			Scopes:    scopes,
+			GrantedAt: g.CreatedAt,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GrantPartnerAccessHandler lets the partner holding the key act for the
+// user through /api/partner/users/{login}.
+func (h *handler) GrantPartnerAccessHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	err := h.auth.GrantAPIKeyAccess(chi.URLParam(r, "id"), principal.UserID)
+	if err != nil {
+		if errors.Is(err, authentication.ErrAPIKeyNotFound) {
+			problem.Write(w, r, problem.APIKeyNotFound, "")
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) RevokePartnerAccessHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	err := h.auth.RevokeAPIKeyAccess(chi.URLParam(r, "id"), principal.UserID)
+	if err != nil {
+		if errors.Is(err, authentication.ErrAPIKeyNotFound) {
+			problem.Write(w, r, problem.APIKeyNotFound, "")
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_handler_CreateAPIKeyHandler(t *testing.T) {
+	withTestEncryptionKey(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	var stored authentication.APIKey
+	auth.EXPECT().CreateAPIKey(gomock.Any()).DoAndReturn(func(key authentication.APIKey) error {
+		stored = key
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/api-keys", strings.NewReader(`{"name": "shop", "scopes": ["orders:write", "balance:read"]}`))
+	req = withPrincipal(req, "adminID")
+
+	http.HandlerFunc(h.CreateAPIKeyHandler).ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	resp := apiKeyResp{}
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+	require.NoError(t, result.Body.Close())
+
+	require.Equal(t, stored.ID, resp.ID)
+	require.Equal(t, "adminID", stored.CreatedBy)
+	require.Equal(t, []string{"orders:write", "balance:read"}, stored.Scopes)
+	require.NotEmpty(t, resp.Secret)
+	require.NotContains(t, stored.Secret, resp.Secret)
+
+	decrypted, err := encryption.New().DecryptData(stored.Secret)
+	require.NoError(t, err)
+	require.Equal(t, resp.Secret, string(decrypted))
+}
+
+func Test_handler_CreateAPIKeyHandler_invalidScope(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/api-keys", strings.NewReader(`{"name": "shop", "scopes": ["admin"]}`))
+	req = withPrincipal(req, "adminID")
+
+	http.HandlerFunc(h.CreateAPIKeyHandler).ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusBadRequest, result.StatusCode)
+	require.NoError(t, result.Body.Close())
+}
+
+func Test_handler_RevokeAPIKeyHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	auth.EXPECT().RevokeAPIKey("gk_1").Return(nil)
+	auth.EXPECT().RevokeAPIKey("gk_2").Return(authentication.ErrAPIKeyNotFound)
+
+	for id, wantStatusCode := range map[string]int{
+		"gk_1": http.StatusNoContent,
+		"gk_2": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/api/admin/api-keys/"+id, nil)
+		req = withURLParams(req, map[string]string{"id": id})
+
+		http.HandlerFunc(h.RevokeAPIKeyHandler).ServeHTTP(rec, req)
+
+		result := rec.Result()
+		require.Equal(t, wantStatusCode, result.StatusCode)
+		require.NoError(t, result.Body.Close())
+	}
+}
+
+func Test_handler_GrantPartnerAccessHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+
+	tests := []struct {
+		name           string
+		grantErr       error
+		wantStatusCode int
+	}{
+		{name: "granted", wantStatusCode: http.StatusNoContent},
+		{name: "unknown key", grantErr: authentication.ErrAPIKeyNotFound, wantStatusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := mock_authentication.NewMockAuth(ctrl)
+			auth.EXPECT().GrantAPIKeyAccess("gk_shop", "testUserID").Return(tt.grantErr)
+
+			h := NewHandler(orderStg, historyStg, auth)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, "/api/user/partners/gk_shop", nil)
+			req = withURLParams(withPrincipal(req, "testUserID"), map[string]string{"id": "gk_shop"})
+
+			http.HandlerFunc(h.GrantPartnerAccessHandler).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+			require.NoError(t, result.Body.Close())
+		})
+	}
+}
@@ -2,7 +2,8 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
 	"net/http"
 )
 
@@ -12,17 +13,18 @@ type balanceResp struct {
 }
 
 func (h *handler) GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
-	token, err := r.Cookie("session_token")
-	if err != nil || token == nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+	if h.notModified(w, r, principal.UserID, formatJSON) {
 		return
 	}
 
-	balance, withdrawn, err := h.orderStg.GetUserBalanceAndWithdrawn(token.Value)
+	balance, withdrawn, err := h.orderStg.GetUserBalanceAndWithdrawn(r.Context(), principal.UserID)
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
 
@@ -33,8 +35,7 @@ func (h *handler) GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
 
 	marshalResp, err := json.Marshal(resp)
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
 
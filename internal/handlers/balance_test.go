@@ -24,7 +24,9 @@ func Test_handler_GetBalanceHandler_ok(t *testing.T) {
 
 	h := NewHandler(orderStg, historyStg, auth)
 
-	orderStg.EXPECT().GetUserBalanceAndWithdrawn(gomock.Any()).Return(float32(500), float32(300), nil)
+	orderStg.EXPECT().GetUserDataVersion(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+
+	orderStg.EXPECT().GetUserBalanceAndWithdrawn(gomock.Any(), gomock.Any()).Return(float32(500), float32(300), nil)
 
 	wantResp, err := json.Marshal(&balanceResp{Current: 500, Withdrawn: 300})
 	if err != nil {
@@ -34,10 +36,7 @@ func Test_handler_GetBalanceHandler_ok(t *testing.T) {
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/user/balance", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "session_token",
-		Value: "testToken",
-	})
+	req = withPrincipal(req, "testUserID")
 
 	handler := http.HandlerFunc(h.GetBalanceHandler)
 	handler.ServeHTTP(rec, req)
@@ -63,14 +62,13 @@ func Test_handler_GetBalanceHandler_storageError(t *testing.T) {
 
 	h := NewHandler(orderStg, historyStg, auth)
 
-	orderStg.EXPECT().GetUserBalanceAndWithdrawn(gomock.Any()).Return(float32(0), float32(0), errors.New("some error"))
+	orderStg.EXPECT().GetUserDataVersion(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+
+	orderStg.EXPECT().GetUserBalanceAndWithdrawn(gomock.Any(), gomock.Any()).Return(float32(0), float32(0), errors.New("some error"))
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/user/balance", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "session_token",
-		Value: "testToken",
-	})
+	req = withPrincipal(req, "testUserID")
 
 	handler := http.HandlerFunc(h.GetBalanceHandler)
 	handler.ServeHTTP(rec, req)
@@ -80,7 +78,7 @@ func Test_handler_GetBalanceHandler_storageError(t *testing.T) {
 
 	body, err := io.ReadAll(result.Body)
 	require.NoError(t, err)
-	require.Empty(t, body)
+	requireProblem(t, result, body, "internal_error")
 
 	err = result.Body.Close()
 	require.NoError(t, err)
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"net/http"
+)
+
+type credentialsReq struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// decodeStrict parses a JSON object body into v, rejecting unknown fields
+// and trailing data.
+func decodeStrict(body []byte, v interface{}) validation.Errors {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return validation.Errors{{Field: "body", Code: "malformed", Message: err.Error()}}
+	}
+	if dec.More() {
+		return validation.Errors{{Field: "body", Code: "malformed", Message: "unexpected data after the JSON object"}}
+	}
+	return nil
+}
+
+func requiredField(field string, value string) validation.Errors {
+	if value == "" {
+		return validation.Errors{{Field: field, Code: validation.CodeRequired, Message: field + " is required"}}
+	}
+	return nil
+}
+
+// decodeCredentials strictly parses a login/password body and normalises
+// the login.
+func decodeCredentials(body []byte) (credentialsReq, validation.Errors) {
+	creds := credentialsReq{}
+
+	if errs := decodeStrict(body, &creds); len(errs) > 0 {
+		return creds, errs
+	}
+
+	creds.Login = validation.NormalizeLogin(creds.Login)
+
+	errs := append(requiredField("login", creds.Login), requiredField("password", creds.Password)...)
+
+	return creds, errs
+}
+
+func writeValidationErrors(w http.ResponseWriter, r *http.Request, errs validation.Errors) {
+	problem.WriteValidation(w, r, errs)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// notModified sets a strong ETag built from the user's data version and the
+// response format, then answers 304 when If-None-Match already holds it.
+// It returns true when the response has been written, either the 304 or a
+// problem, so that the caller skips the list queries.
+func (h *handler) notModified(w http.ResponseWriter, r *http.Request, userID string, format string) bool {
+	version, err := h.orderStg.GetUserDataVersion(r.Context(), userID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return true
+	}
+
+	etag := `"` + strconv.FormatInt(version, 10) + "-" + format + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches applies the weak comparison RFC 7232 prescribes for
+// If-None-Match to a comma separated list of tags.
+func etagMatches(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_handler_conditionalGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name           string
+		handler        func(h Handler) http.HandlerFunc
+		target         string
+		ifNoneMatch    string
+		versionErr     error
+		prepare        func(orderStg *mock_storage.MockOrderStorage, historyStg *mock_storage.MockHistoryStorage)
+		wantStatusCode int
+		wantETag       string
+	}{
+		{
+			name:           "orders not modified",
+			handler:        func(h Handler) http.HandlerFunc { return h.GetOrderHandler },
+			target:         "/user/orders",
+			ifNoneMatch:    `"7-json"`,
+			prepare:        func(*mock_storage.MockOrderStorage, *mock_storage.MockHistoryStorage) {},
+			wantStatusCode: http.StatusNotModified,
+			wantETag:       `"7-json"`,
+		},
+		{
+			name:        "orders changed",
+			handler:     func(h Handler) http.HandlerFunc { return h.GetOrderHandler },
+			target:      "/user/orders",
+			ifNoneMatch: `"6-json"`,
+			prepare: func(orderStg *mock_storage.MockOrderStorage, _ *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().GetUserOrders(gomock.Any(), "testUserID").Return(nil, nil)
+			},
+			wantStatusCode: http.StatusNoContent,
+			wantETag:       `"7-json"`,
+		},
+		{
+			name:        "orders in another format",
+			handler:     func(h Handler) http.HandlerFunc { return h.GetOrderHandler },
+			target:      "/user/orders?format=ndjson",
+			ifNoneMatch: `"7-json"`,
+			prepare: func(orderStg *mock_storage.MockOrderStorage, _ *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().StreamUserOrders(gomock.Any(), "testUserID", gomock.Any()).Return(nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantETag:       `"7-ndjson"`,
+		},
+		{
+			name:           "balance weak tag in a list",
+			handler:        func(h Handler) http.HandlerFunc { return h.GetBalanceHandler },
+			target:         "/user/balance",
+			ifNoneMatch:    `"5-json", W/"7-json"`,
+			prepare:        func(*mock_storage.MockOrderStorage, *mock_storage.MockHistoryStorage) {},
+			wantStatusCode: http.StatusNotModified,
+			wantETag:       `"7-json"`,
+		},
+		{
+			name:        "balance without If-None-Match",
+			handler:     func(h Handler) http.HandlerFunc { return h.GetBalanceHandler },
+			target:      "/user/balance",
+			ifNoneMatch: "",
+			prepare: func(orderStg *mock_storage.MockOrderStorage, _ *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().GetUserBalanceAndWithdrawn(gomock.Any(), "testUserID").Return(float32(500), float32(300), nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantETag:       `"7-json"`,
+		},
+		{
+			name:           "withdrawals any",
+			handler:        func(h Handler) http.HandlerFunc { return h.GetWithdrawalsHistoryHandler },
+			target:         "/user/balance/withdrawals",
+			ifNoneMatch:    "*",
+			prepare:        func(*mock_storage.MockOrderStorage, *mock_storage.MockHistoryStorage) {},
+			wantStatusCode: http.StatusNotModified,
+			wantETag:       `"7-json"`,
+		},
+		{
+			name:           "version error",
+			handler:        func(h Handler) http.HandlerFunc { return h.GetWithdrawalsHistoryHandler },
+			target:         "/user/balance/withdrawals",
+			ifNoneMatch:    `"7-json"`,
+			versionErr:     errors.New("some error"),
+			prepare:        func(*mock_storage.MockOrderStorage, *mock_storage.MockHistoryStorage) {},
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderStg := mock_storage.NewMockOrderStorage(ctrl)
+			historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+			orderStg.EXPECT().GetUserDataVersion(gomock.Any(), "testUserID").Return(int64(7), tt.versionErr)
+			tt.prepare(orderStg, historyStg)
+			h := NewHandler(orderStg, historyStg, mock_authentication.NewMockAuth(ctrl))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			req = withPrincipal(req, "testUserID")
+
+			tt.handler(h).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+			require.Equal(t, tt.wantETag, result.Header.Get("ETag"))
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			if tt.wantStatusCode == http.StatusNotModified {
+				require.Empty(t, body)
+			}
+
+			err = result.Body.Close()
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"github.com/spf13/viper"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultEventsHeartbeat = 15 * time.Second
+	eventsPageSize         = 100
+	// eventsRetry is the reconnection delay suggested to EventSource.
+	eventsRetry = 3 * time.Second
+)
+
+func eventsHeartbeat() time.Duration {
+	if interval := viper.GetDuration("EVENTS_HEARTBEAT_INTERVAL"); interval > 0 {
+		return interval
+	}
+	return defaultEventsHeartbeat
+}
+
+// EventsHandler streams the order and balance events of the user as
+// Server-Sent Events. A client resuming with Last-Event-ID (or the
+// last_event_id query parameter) first gets everything it has missed;
+// without it the stream starts with the next event. A comment line is
+// sent every EVENTS_HEARTBEAT_INTERVAL to keep proxies from closing an
+// idle connection.
+func (h *handler) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		problem.Write(w, r, problem.Internal, "streaming is not supported")
+		return
+	}
+
+	lastID, resume, errs := lastEventID(r)
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	// subscribe before reading the storage, so that nothing written in
+	// between is missed
+	signal, unsubscribe := h.broker.Subscribe(principal.UserID)
+	defer unsubscribe()
+
+	if !resume {
+		var err error
+		lastID, err = h.orderStg.GetLastUserEventID(r.Context(), principal.UserID)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+	flusher.Flush()
+
+	send := func() error {
+		for {
+			events, err := h.orderStg.GetUserEvents(r.Context(), principal.UserID, lastID, eventsPageSize)
+			if err != nil {
+				return err
+			}
+			for _, e := range events {
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data); err != nil {
+					return err
+				}
+				lastID = e.ID
+			}
+			flusher.Flush()
+			if len(events) < eventsPageSize {
+				return nil
+			}
+		}
+	}
+
+	if resume {
+		if err := send(); err != nil {
+			slog.DebugContext(r.Context(), "events stream closed", "error", err)
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.broker.Closed():
+			return
+		case <-signal:
+			if err := send(); err != nil {
+				slog.DebugContext(r.Context(), "events stream closed", "error", err)
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *handler) CloseStreams() {
+	h.broker.Close()
+}
+
+// lastEventID reads the ID the client has seen last. resume is false when
+// the client has not seen any.
+func lastEventID(r *http.Request) (int64, bool, validation.Errors) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, validation.Errors{{Field: "Last-Event-ID", Code: "invalid", Message: "Last-Event-ID must be an event id"}}
+	}
+	return id, true, nil
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_handler_EventsHandler_resume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	h := NewHandler(orderStg, mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+
+	orderStg.EXPECT().GetUserEvents(gomock.Any(), "testUserID", int64(5), eventsPageSize).Return([]storage.UserEvent{
+		{ID: 6, Type: storage.EventOrder, Data: json.RawMessage(`{"number":"12345678903","status":"PROCESSED","accrual":500}`)},
+		{ID: 7, Type: storage.EventBalance, Data: json.RawMessage(`{"current":500,"withdrawn":0}`)},
+	}, nil)
+
+	// the client is gone right after the missed events are sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/user/events", nil).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", "5")
+	req = withPrincipal(req, "testUserID")
+
+	http.HandlerFunc(h.EventsHandler).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	require.Equal(t, "retry: 3000\n\n"+
+		"id: 6\nevent: order\ndata: {\"number\":\"12345678903\",\"status\":\"PROCESSED\",\"accrual\":500}\n\n"+
+		"id: 7\nevent: balance\ndata: {\"current\":500,\"withdrawn\":0}\n\n",
+		rec.Body.String())
+}
+
+func Test_handler_EventsHandler_live(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	h := NewHandler(orderStg, mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+	broker := h.(*handler).broker
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gomock.InOrder(
+		orderStg.EXPECT().GetLastUserEventID(gomock.Any(), "testUserID").DoAndReturn(func(_ context.Context, userID string) (int64, error) {
+			// an event written by another replica right after the subscription
+			broker.Publish(userID)
+			return 9, nil
+		}),
+		orderStg.EXPECT().GetUserEvents(gomock.Any(), "testUserID", int64(9), eventsPageSize).DoAndReturn(
+			func(context.Context, string, int64, int) ([]storage.UserEvent, error) {
+				cancel()
+				return []storage.UserEvent{{ID: 10, Type: storage.EventBalance, Data: json.RawMessage(`{"current":10,"withdrawn":0}`)}}, nil
+			}),
+	)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/user/events", nil).WithContext(ctx)
+	req = withPrincipal(req, "testUserID")
+
+	http.HandlerFunc(h.EventsHandler).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "retry: 3000\n\nid: 10\nevent: balance\ndata: {\"current\":10,\"withdrawn\":0}\n\n", rec.Body.String())
+}
+
+func Test_handler_EventsHandler_closeStreams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	h := NewHandler(orderStg, mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+
+	// the server shuts down while the client is still connected
+	orderStg.EXPECT().GetLastUserEventID(gomock.Any(), "testUserID").DoAndReturn(func(context.Context, string) (int64, error) {
+		h.CloseStreams()
+		return 9, nil
+	})
+
+	rec := httptest.NewRecorder()
+	req := withPrincipal(httptest.NewRequest(http.MethodGet, "/api/user/events", nil), "testUserID")
+
+	http.HandlerFunc(h.EventsHandler).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "retry: 3000\n\n", rec.Body.String())
+}
+
+func Test_handler_EventsHandler_invalidLastEventID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h := NewHandler(mock_storage.NewMockOrderStorage(ctrl), mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/user/events?last_event_id=abc", nil)
+	req = withPrincipal(req, "testUserID")
+
+	http.HandlerFunc(h.EventsHandler).ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusBadRequest, result.StatusCode)
+	requireProblem(t, result, rec.Body.Bytes(), "validation_failed")
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"net/http"
+	"strings"
+)
+
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// exportFormat picks the response format from the format query parameter
+// or, without it, from the Accept header. JSON is the default.
+func exportFormat(r *http.Request, allowed ...string) (string, validation.Errors) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		accept := r.Header.Get("Accept")
+		switch {
+		case strings.Contains(accept, "text/csv"):
+			format = formatCSV
+		case strings.Contains(accept, ndjsonContentType):
+			format = formatNDJSON
+		default:
+			format = formatJSON
+		}
+	}
+
+	for _, a := range allowed {
+		if format == a {
+			return format, nil
+		}
+	}
+	return "", validation.Errors{{
+		Field:   "format",
+		Code:    "invalid",
+		Message: "format must be one of " + strings.Join(allowed, ", "),
+	}}
+}
+
+// rowStream writes an export row by row as CSV or NDJSON. Nothing is sent
+// before the first row, so a failure up to that point can still be
+// answered with a problem; Started tells whether that is the case. A later
+// failure can only cut the export short: rows still buffered are dropped.
+type rowStream struct {
+	w       http.ResponseWriter
+	format  string
+	header  []string
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	started bool
+}
+
+func newRowStream(w http.ResponseWriter, format string, header []string) *rowStream {
+	return &rowStream{w: w, format: format, header: header}
+}
+
+func (s *rowStream) Started() bool {
+	return s.started
+}
+
+func (s *rowStream) start() error {
+	s.started = true
+
+	if s.format == formatCSV {
+		s.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		s.w.Header().Set("Content-Type", ndjsonContentType)
+	}
+	s.w.WriteHeader(http.StatusOK)
+
+	s.buf = bufio.NewWriter(s.w)
+	if s.format == formatCSV {
+		s.csv = csv.NewWriter(s.buf)
+		return s.csv.Write(s.header)
+	}
+	return nil
+}
+
+// Write adds a row: record for CSV, v encoded as one JSON line for NDJSON.
+func (s *rowStream) Write(record []string, v interface{}) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	if s.format == formatCSV {
+		return s.csv.Write(record)
+	}
+	return json.NewEncoder(s.buf).Encode(v)
+}
+
+// Close sends the rest of the buffered rows, or just the CSV header when
+// there were no rows at all.
+func (s *rowStream) Close() error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	if s.csv != nil {
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return s.buf.Flush()
+}
@@ -2,6 +2,9 @@ package handlers
 
 import (
 	authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/events"
+	"github.com/mkarulina/loyalty-system-service.git/internal/notification"
+	"github.com/mkarulina/loyalty-system-service.git/internal/oidc"
 	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
 	"net/http"
 )
@@ -10,16 +13,60 @@ type Handler interface {
 	RegisterHandler(w http.ResponseWriter, r *http.Request)
 	LoginHandler(w http.ResponseWriter, r *http.Request)
 	SendOrderHandler(w http.ResponseWriter, r *http.Request)
+	SendOrdersBatchHandler(w http.ResponseWriter, r *http.Request)
 	GetOrderHandler(w http.ResponseWriter, r *http.Request)
+	GetOrderDetailHandler(w http.ResponseWriter, r *http.Request)
 	GetBalanceHandler(w http.ResponseWriter, r *http.Request)
+	GetStatementHandler(w http.ResponseWriter, r *http.Request)
 	WithdrawHandler(w http.ResponseWriter, r *http.Request)
 	GetWithdrawalsHistoryHandler(w http.ResponseWriter, r *http.Request)
+	CancelWithdrawalHandler(w http.ResponseWriter, r *http.Request)
+	TransferHandler(w http.ResponseWriter, r *http.Request)
+	EventsHandler(w http.ResponseWriter, r *http.Request)
+	ChangePasswordHandler(w http.ResponseWriter, r *http.Request)
+	PasswordResetRequestHandler(w http.ResponseWriter, r *http.Request)
+	PasswordResetHandler(w http.ResponseWriter, r *http.Request)
+	EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request)
+	ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request)
+	LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request)
+	AdminFindUserHandler(w http.ResponseWriter, r *http.Request)
+	AdminGetUserHandler(w http.ResponseWriter, r *http.Request)
+	AdminGetUserOrdersHandler(w http.ResponseWriter, r *http.Request)
+	AdminGetUserLedgerHandler(w http.ResponseWriter, r *http.Request)
+	AdminSetUserRoleHandler(w http.ResponseWriter, r *http.Request)
+	AdminReprocessOrderHandler(w http.ResponseWriter, r *http.Request)
+	AdminReverseWithdrawalHandler(w http.ResponseWriter, r *http.Request)
+	AdminListTransfersHandler(w http.ResponseWriter, r *http.Request)
+	CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request)
+	ListAPIKeysHandler(w http.ResponseWriter, r *http.Request)
+	RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request)
+	ListPartnerGrantsHandler(w http.ResponseWriter, r *http.Request)
+	GrantPartnerAccessHandler(w http.ResponseWriter, r *http.Request)
+	RevokePartnerAccessHandler(w http.ResponseWriter, r *http.Request)
+	OIDCLoginHandler(w http.ResponseWriter, r *http.Request)
+	OIDCCallbackHandler(w http.ResponseWriter, r *http.Request)
+	ExportHandler(w http.ResponseWriter, r *http.Request)
+	DeleteAccountHandler(w http.ResponseWriter, r *http.Request)
+	SendOrderV2Handler(w http.ResponseWriter, r *http.Request)
+	GetOrdersV2Handler(w http.ResponseWriter, r *http.Request)
+	GetBalanceV2Handler(w http.ResponseWriter, r *http.Request)
+	WithdrawV2Handler(w http.ResponseWriter, r *http.Request)
+	GetWithdrawalsHistoryV2Handler(w http.ResponseWriter, r *http.Request)
+	NotFoundV2Handler(w http.ResponseWriter, r *http.Request)
+	MethodNotAllowedV2Handler(w http.ResponseWriter, r *http.Request)
+	// CloseStreams ends the open event streams, for
+	// http.Server.RegisterOnShutdown.
+	CloseStreams()
 }
 
 type handler struct {
 	orderStg   storage.OrderStorage
 	historyStg storage.HistoryStorage
 	auth       authentication.Auth
+	notifier   notification.Notifier
+	broker     *events.Broker
+	// provider is nil when OIDC login is not configured.
+	provider *oidc.Client
 }
 
 func NewHandler(
@@ -31,6 +78,11 @@ func NewHandler(
 		orderStg:   orderStg,
 		historyStg: historyStg,
 		auth:       auth,
+		notifier:   notification.New(),
+		broker:     events.New(),
+	}
+	if config, ok := oidc.ConfigFromViper(); ok {
+		h.provider = oidc.New(config)
 	}
 	return h
 }
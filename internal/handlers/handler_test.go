@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func withPrincipal(req *http.Request, userID string) *http.Request {
+	ctx := authentication.ContextWithPrincipal(req.Context(), authentication.Principal{
+		UserID: userID,
+		Roles:  []string{authentication.RoleUser},
+	})
+	return req.WithContext(ctx)
+}
+
+// requireProblem checks that the body is problem details with the code.
+func requireProblem(t *testing.T, result *http.Response, body []byte, code string) {
+	t.Helper()
+
+	require.Equal(t, problem.ContentType, result.Header.Get("Content-Type"))
+
+	details := problem.Details{}
+	require.NoError(t, json.Unmarshal(body, &details))
+	require.Equal(t, code, details.Code)
+	require.Equal(t, result.StatusCode, details.Status)
+}
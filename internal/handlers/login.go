@@ -1,54 +1,90 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
 	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 )
 
-type loginReq struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
-}
-
 func (h *handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	token, err := r.Cookie("session_token")
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
+		problem.Write(w, r, problem.MalformedRequest, "session cookie is missing")
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Println("can't read body", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
 		return
 	}
 
-	unmarshalBody := loginReq{}
-	if err := json.Unmarshal(body, &unmarshalBody); err != nil {
-		log.Println("can't unmarshal request body", err)
-		w.WriteHeader(http.StatusBadRequest)
+	creds, errs := decodeCredentials(body)
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
 		return
 	}
 
 	e := encryption.New()
-	encLogin := e.EncodeData(unmarshalBody.Login)
-	encPassword := e.EncodeData(unmarshalBody.Password)
+	encLogin := e.EncodeData(creds.Login)
 
-	err = h.auth.CheckUserData(authentication.User{
-		Token:    token.Value,
+	user, err := h.auth.CheckUserData(authentication.User{
 		Login:    encLogin,
-		Password: encPassword,
+		Password: creds.Password,
 	})
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
+		if errors.Is(err, authentication.ErrInvalidCredentials) {
+			problem.Write(w, r, problem.InvalidCredentials, "")
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	if user.TwoFactor {
+		h.startLoginChallenge(w, r, user.ID, token.Value)
+		return
+	}
+
+	err = h.startSession(w, user.ID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// startSession logs the user in with a fresh session token and sets it as
+// the cookie. The token the client came with is never bound to the
+// account, so a cookie planted before login can't be used to ride the
+// session.
+func (h *handler) startSession(w http.ResponseWriter, userID string) error {
+	token, err := authentication.NewSessionToken()
+	if err != nil {
+		return err
+	}
+
+	if err := h.auth.CreateSession(userID, token); err != nil {
+		return err
+	}
+
+	setSessionCookie(w, token)
+	return nil
+}
+
+func setSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:    "session_token",
+		Value:   token,
+		Path:    "/",
+		Expires: time.Now().Add(3 * time.Hour),
+		Secure:  false,
+	})
+}
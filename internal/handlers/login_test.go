@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/golang/mock/gomock"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
 	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
 	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
 	"github.com/stretchr/testify/require"
@@ -12,9 +13,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func Test_handler_LoginHandler_ok(t *testing.T) {
+	withTestEncryptionKey(t)
+
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -24,11 +28,16 @@ func Test_handler_LoginHandler_ok(t *testing.T) {
 
 	h := NewHandler(orderStg, historyStg, auth)
 
-	auth.EXPECT().CheckUserData(gomock.Any()).Return(nil)
+	auth.EXPECT().CheckUserData(gomock.Any()).Return(&authentication.User{ID: "7"}, nil)
+	var session string
+	auth.EXPECT().CreateSession("7", gomock.Not("testToken")).DoAndReturn(func(userID string, token string) error {
+		session = token
+		return nil
+	})
 
-	reqBody, _ := json.Marshal(loginReq{
+	reqBody, _ := json.Marshal(credentialsReq{
 		Login:    "testLogin",
-		Password: "testPassword",
+		Password: "testPassword1",
 	})
 
 	r := bytes.NewReader(reqBody)
@@ -45,6 +54,9 @@ func Test_handler_LoginHandler_ok(t *testing.T) {
 
 	result := rec.Result()
 	require.Equal(t, http.StatusOK, result.StatusCode)
+	require.Len(t, result.Cookies(), 1)
+	require.Equal(t, "session_token", result.Cookies()[0].Name)
+	require.Equal(t, session, result.Cookies()[0].Value)
 
 	body, err := io.ReadAll(result.Body)
 	require.NoError(t, err)
@@ -64,11 +76,11 @@ func Test_handler_LoginHandler_authError(t *testing.T) {
 
 	h := NewHandler(orderStg, historyStg, auth)
 
-	auth.EXPECT().CheckUserData(gomock.Any()).Return(errors.New("some error"))
+	auth.EXPECT().CheckUserData(gomock.Any()).Return(nil, errors.New("some error"))
 
-	reqBody, _ := json.Marshal(loginReq{
+	reqBody, _ := json.Marshal(credentialsReq{
 		Login:    "testLogin",
-		Password: "testPassword",
+		Password: "testPassword1",
 	})
 
 	r := bytes.NewReader(reqBody)
@@ -84,12 +96,96 @@ func Test_handler_LoginHandler_authError(t *testing.T) {
 	handler.ServeHTTP(rec, req)
 
 	result := rec.Result()
-	require.Equal(t, http.StatusBadRequest, result.StatusCode)
+	require.Equal(t, http.StatusInternalServerError, result.StatusCode)
 
 	body, err := io.ReadAll(result.Body)
 	require.NoError(t, err)
-	require.Empty(t, body)
+	requireProblem(t, result, body, "internal_error")
 
 	err = result.Body.Close()
 	require.NoError(t, err)
 }
+
+func Test_handler_LoginHandler_notRegistered(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	auth.EXPECT().CheckUserData(gomock.Any()).Return(nil, authentication.ErrInvalidCredentials)
+
+	reqBody, _ := json.Marshal(credentialsReq{
+		Login:    "testLogin",
+		Password: "testPassword1",
+	})
+
+	r := bytes.NewReader(reqBody)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/user/login", r)
+	req.AddCookie(&http.Cookie{
+		Name:  "session_token",
+		Value: "testToken",
+	})
+
+	handler := http.HandlerFunc(h.LoginHandler)
+	handler.ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusUnauthorized, result.StatusCode)
+
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	requireProblem(t, result, body, "invalid_credentials")
+
+	err = result.Body.Close()
+	require.NoError(t, err)
+}
+
+func Test_handler_LoginHandler_twoFactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	var challengeHash string
+	auth.EXPECT().CheckUserData(gomock.Any()).Return(&authentication.User{ID: "7", TwoFactor: true}, nil)
+	auth.EXPECT().CreateLoginChallenge("7", gomock.Any(), "testToken", authentication.LoginChallengeTTL()).
+		DoAndReturn(func(userID string, hash string, token string, ttl time.Duration) error {
+			challengeHash = hash
+			return nil
+		})
+
+	reqBody, _ := json.Marshal(credentialsReq{
+		Login:    "testLogin",
+		Password: "testPassword1",
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/user/login", bytes.NewReader(reqBody))
+	req.AddCookie(&http.Cookie{
+		Name:  "session_token",
+		Value: "testToken",
+	})
+
+	handler := http.HandlerFunc(h.LoginHandler)
+	handler.ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusAccepted, result.StatusCode)
+
+	resp := loginChallengeResp{}
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+	require.Equal(t, authentication.HashToken(resp.Challenge), challengeHash)
+
+	err := result.Body.Close()
+	require.NoError(t, err)
+}
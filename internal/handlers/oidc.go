@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/oidc"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"github.com/spf13/viper"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	oidcFlowCookie = "oidc_flow"
+	oidcFlowTTL    = 10 * time.Minute
+)
+
+// oidcFlow is kept in an encrypted cookie between the redirect to the
+// provider and the callback, so no server-side state is needed.
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+func (h *handler) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if h.provider == nil {
+		problem.Write(w, r, problem.OIDCDisabled, "")
+		return
+	}
+
+	flow := oidcFlow{}
+	for _, v := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		random, err := oidc.NewVerifier()
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		*v = random
+	}
+
+	authURL, err := h.provider.AuthCodeURL(r.Context(), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't build oidc auth url", "error", err)
+		problem.Write(w, r, problem.BadGateway, "identity provider is unavailable")
+		return
+	}
+
+	data, err := json.Marshal(flow)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	value, err := encryption.New().EncryptData(data)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     "/api/user/oidc",
+		Expires:  time.Now().Add(oidcFlowTTL),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler finishes the flow. The identity is looked up first;
+// an unknown identity is linked to the user already signed in with the
+// session cookie, or else a new user is created for it. Existing accounts
+// are never linked by matching e-mail, since the provider does not prove
+// ownership of a gophermart login.
+func (h *handler) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if h.provider == nil {
+		problem.Write(w, r, problem.OIDCDisabled, "")
+		return
+	}
+
+	token, err := r.Cookie("session_token")
+	if err != nil {
+		problem.Write(w, r, problem.MalformedRequest, "session cookie is missing")
+		return
+	}
+
+	flow, ok := readOIDCFlow(r)
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Path: "/api/user/oidc", MaxAge: -1})
+	if !ok {
+		problem.Write(w, r, problem.OIDCFlowError, "login flow is missing or expired")
+		return
+	}
+
+	q := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(flow.State)) != 1 {
+		problem.Write(w, r, problem.OIDCFlowError, "state mismatch")
+		return
+	}
+	if providerErr := q.Get("error"); providerErr != "" {
+		problem.Write(w, r, problem.OIDCDenied, "provider returned "+providerErr)
+		return
+	}
+
+	claims, err := h.provider.Exchange(r.Context(), q.Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		slog.WarnContext(r.Context(), "oidc code exchange failed", "error", err)
+		if errors.Is(err, oidc.ErrInvalidToken) {
+			problem.Write(w, r, problem.OIDCDenied, "id token was rejected")
+			return
+		}
+		problem.Write(w, r, problem.BadGateway, "identity provider is unavailable")
+		return
+	}
+
+	user, err := h.oidcUser(claims, token.Value)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	if user.TwoFactor {
+		h.startLoginChallenge(w, r, user.ID, token.Value)
+		return
+	}
+
+	err = h.startSession(w, user.ID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	if redirect := viper.GetString("OIDC_POST_LOGIN_REDIRECT"); redirect != "" {
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func readOIDCFlow(r *http.Request) (oidcFlow, bool) {
+	flow := oidcFlow{}
+
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		return flow, false
+	}
+	data, err := encryption.New().DecryptData(cookie.Value)
+	if err != nil {
+		return flow, false
+	}
+	if err := json.Unmarshal(data, &flow); err != nil || flow.State == "" {
+		return flow, false
+	}
+
+	return flow, true
+}
+
+// oidcUser returns the user for the identity in claims, linking or
+// creating it when needed.
+func (h *handler) oidcUser(claims *oidc.Claims, token string) (*authentication.User, error) {
+	issuer := h.provider.Issuer()
+
+	user, err := h.auth.GetUserByIdentity(issuer, claims.Subject)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	current, err := h.auth.GetUserByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		if err := h.auth.LinkIdentity(current.ID, issuer, claims.Subject); err != nil {
+			return nil, err
+		}
+		return current, nil
+	}
+
+	e := encryption.New()
+
+	// The password is random and never shown: the user signs in through the
+	// provider or sets one with a password reset.
+	random, err := e.GenerateRandom(32)
+	if err != nil {
+		return nil, err
+	}
+	password := hex.EncodeToString(random)
+
+	for _, login := range oidcLogins(issuer, claims) {
+		id, err := h.auth.CreateUserWithIdentity(authentication.User{
+			Login:    e.EncodeData(login),
+			Password: password,
+		}, issuer, claims.Subject)
+		if err != nil {
+			if errors.Is(err, authentication.ErrLoginTaken) {
+				continue
+			}
+			return nil, err
+		}
+		return &authentication.User{ID: id, Login: e.EncodeData(login), Role: authentication.RoleUser}, nil
+	}
+
+	return nil, errors.New("no free login for oidc user")
+}
+
+// oidcLogins lists logins to try for a new user, from the most readable to
+// one derived from the identity that is practically always free.
+func oidcLogins(issuer string, claims *oidc.Claims) []string {
+	sum := sha256.Sum256([]byte(issuer + "\n" + claims.Subject))
+	suffix := hex.EncodeToString(sum[:])
+
+	names := []string{claims.PreferredUsername}
+	if claims.EmailVerified {
+		names = append(names, claims.Email)
+	}
+
+	logins := []string{}
+	for _, name := range names {
+		login := validation.NormalizeLogin(name)
+		if login == "" || len(validation.ValidateLogin(login)) > 0 {
+			continue
+		}
+		logins = append(logins, login)
+		if len(login)+7 <= 64 {
+			logins = append(logins, login+"-"+suffix[:6])
+		}
+	}
+
+	return append(logins, "oidc-"+suffix[:16])
+}
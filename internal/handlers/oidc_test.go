@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"github.com/golang/mock/gomock"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/oidc/oidctest"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testSessionToken = "testSessionToken1234"
+
+func withTestOIDCProvider(t *testing.T) *oidctest.Provider {
+	withTestEncryptionKey(t)
+
+	provider, err := oidctest.NewProvider("gophermart")
+	require.NoError(t, err)
+	t.Cleanup(provider.Close)
+
+	viper.Set("OIDC_ISSUER", provider.Issuer())
+	viper.Set("OIDC_CLIENT_ID", "gophermart")
+	viper.Set("OIDC_REDIRECT_URL", "http://localhost:8080/api/user/oidc/callback")
+
+	return provider
+}
+
+// oidcCallbackRequest runs the login handler and the provider and returns
+// the request the browser would send to the callback.
+func oidcCallbackRequest(t *testing.T, h Handler, provider *oidctest.Provider, user oidctest.User) *http.Request {
+	rec := httptest.NewRecorder()
+	http.HandlerFunc(h.OIDCLoginHandler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/user/oidc/login", nil))
+
+	result := rec.Result()
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusFound, result.StatusCode)
+
+	callback, err := provider.Authorize(result.Header.Get("Location"), user)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	for _, c := range result.Cookies() {
+		req.AddCookie(c)
+	}
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: testSessionToken})
+	return req
+}
+
+func Test_handler_OIDCCallback(t *testing.T) {
+	e := encryption.New()
+	alice := oidctest.User{Subject: "sub-alice", Email: "alice@example.com", PreferredUsername: "Alice"}
+
+	tests := []struct {
+		name           string
+		user           oidctest.User
+		prepare        func(auth *mock_authentication.MockAuth, issuer string)
+		wantStatusCode int
+	}{
+		{
+			name: "linked identity",
+			user: alice,
+			prepare: func(auth *mock_authentication.MockAuth, issuer string) {
+				auth.EXPECT().GetUserByIdentity(issuer, "sub-alice").Return(&authentication.User{ID: "7"}, nil)
+				auth.EXPECT().CreateSession("7", gomock.Not(testSessionToken)).Return(nil)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "link to signed in user",
+			user: alice,
+			prepare: func(auth *mock_authentication.MockAuth, issuer string) {
+				auth.EXPECT().GetUserByIdentity(issuer, "sub-alice").Return(nil, nil)
+				auth.EXPECT().GetUserByToken(testSessionToken).Return(&authentication.User{ID: "3"}, nil)
+				auth.EXPECT().LinkIdentity("3", issuer, "sub-alice").Return(nil)
+				auth.EXPECT().CreateSession("3", gomock.Not(testSessionToken)).Return(nil)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "new user",
+			user: alice,
+			prepare: func(auth *mock_authentication.MockAuth, issuer string) {
+				auth.EXPECT().GetUserByIdentity(issuer, "sub-alice").Return(nil, nil)
+				auth.EXPECT().GetUserByToken(testSessionToken).Return(nil, nil)
+				gomock.InOrder(
+					auth.EXPECT().CreateUserWithIdentity(
+						userWithLogin(e.EncodeData("alice")), issuer, "sub-alice",
+					).Return("", authentication.ErrLoginTaken),
+					auth.EXPECT().CreateUserWithIdentity(gomock.Any(), issuer, "sub-alice").Return("12", nil),
+				)
+				auth.EXPECT().CreateSession("12", gomock.Not(testSessionToken)).Return(nil)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "two factor",
+			user: alice,
+			prepare: func(auth *mock_authentication.MockAuth, issuer string) {
+				auth.EXPECT().GetUserByIdentity(issuer, "sub-alice").Return(&authentication.User{ID: "7", TwoFactor: true}, nil)
+				auth.EXPECT().CreateLoginChallenge("7", gomock.Any(), testSessionToken, gomock.Any()).Return(nil)
+			},
+			wantStatusCode: http.StatusAccepted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := withTestOIDCProvider(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			orderStg := mock_storage.NewMockOrderStorage(ctrl)
+			historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+			auth := mock_authentication.NewMockAuth(ctrl)
+
+			h := NewHandler(orderStg, historyStg, auth)
+			tt.prepare(auth, provider.Issuer())
+
+			rec := httptest.NewRecorder()
+			http.HandlerFunc(h.OIDCCallbackHandler).ServeHTTP(rec, oidcCallbackRequest(t, h, provider, tt.user))
+
+			result := rec.Result()
+			require.NoError(t, result.Body.Close())
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+		})
+	}
+}
+
+func Test_handler_OIDCCallback_rejected(t *testing.T) {
+	provider := withTestOIDCProvider(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h := NewHandler(mock_storage.NewMockOrderStorage(ctrl), mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+
+	t.Run("state mismatch", func(t *testing.T) {
+		req := oidcCallbackRequest(t, h, provider, oidctest.User{Subject: "sub"})
+		q := req.URL.Query()
+		q.Set("state", "forged")
+		req.URL.RawQuery = q.Encode()
+
+		rec := httptest.NewRecorder()
+		http.HandlerFunc(h.OIDCCallbackHandler).ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("no flow cookie", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/oidc/callback?code=x&state=y", nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: testSessionToken})
+
+		rec := httptest.NewRecorder()
+		http.HandlerFunc(h.OIDCCallbackHandler).ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("replayed nonce", func(t *testing.T) {
+		req := oidcCallbackRequest(t, h, provider, oidctest.User{Subject: "sub"})
+		provider.Nonce = "other"
+		defer func() { provider.Nonce = "" }()
+
+		rec := httptest.NewRecorder()
+		http.HandlerFunc(h.OIDCCallbackHandler).ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func Test_handler_OIDCLogin_notConfigured(t *testing.T) {
+	withTestEncryptionKey(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h := NewHandler(mock_storage.NewMockOrderStorage(ctrl), mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+
+	rec := httptest.NewRecorder()
+	http.HandlerFunc(h.OIDCLoginHandler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/user/oidc/login", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+type userLoginMatcher string
+
+func userWithLogin(login string) gomock.Matcher {
+	return userLoginMatcher(login)
+}
+
+func (m userLoginMatcher) Matches(x interface{}) bool {
+	user, ok := x.(authentication.User)
+	return ok && user.Login == string(m)
+}
+
+func (m userLoginMatcher) String() string {
+	return "user with login " + string(m)
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"github.com/spf13/viper"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Results of a single order in a batch upload.
+const (
+	batchAccepted        = "accepted"
+	batchAlreadyUploaded = "already_uploaded"
+	batchOwnedByAnother  = "owned_by_another_user"
+	batchInvalid         = "invalid"
+)
+
+const defaultOrderBatchLimit = 100
+
+type batchOrderResult struct {
+	Number string `json:"number"`
+	Status int    `json:"status"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type batchOrdersResp struct {
+	Results []batchOrderResult `json:"results"`
+}
+
+// SendOrdersBatchHandler uploads many order numbers at once. The body is a
+// JSON array, CSV or one number per line. Every number gets its own result
+// with the status code the single upload would have answered, so the
+// response itself is always 207 Multi-Status.
+func (h *handler) SendOrdersBatchHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	numbers, err := parseOrderBatch(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		if errors.Is(err, errUnsupportedBatchType) {
+			problem.Write(w, r, problem.MalformedRequest, "orders must be sent as application/json, text/csv or text/plain")
+			return
+		}
+		writeValidationErrors(w, r, validation.Errors{{Field: "body", Code: "malformed", Message: err.Error()}})
+		return
+	}
+
+	limit := viper.GetInt("ORDER_BATCH_LIMIT")
+	if limit <= 0 {
+		limit = defaultOrderBatchLimit
+	}
+	if len(numbers) == 0 {
+		writeValidationErrors(w, r, validation.Errors{{Field: "orders", Code: validation.CodeRequired, Message: "at least one order number is required"}})
+		return
+	}
+	if len(numbers) > limit {
+		writeValidationErrors(w, r, validation.Errors{{
+			Field:   "orders",
+			Code:    "too_many",
+			Message: fmt.Sprintf("at most %d order numbers are accepted in one batch", limit),
+		}})
+		return
+	}
+
+	resp := batchOrdersResp{Results: make([]batchOrderResult, len(numbers))}
+	var valid []string
+	var validIdx []int
+
+	for i, number := range numbers {
+		resp.Results[i].Number = number
+
+		if detail := checkOrderNumber(number); detail != "" {
+			resp.Results[i].Status = http.StatusUnprocessableEntity
+			resp.Results[i].Result = batchInvalid
+			resp.Results[i].Detail = detail
+			continue
+		}
+		valid = append(valid, number)
+		validIdx = append(validIdx, i)
+	}
+
+	if len(valid) > 0 {
+		added, err := h.orderStg.AddOrderNumbers(r.Context(), valid, principal.UserID)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+
+		for j, added := range added {
+			res := &resp.Results[validIdx[j]]
+			switch added {
+			case storage.OrderAdded:
+				res.Status = http.StatusAccepted
+				res.Result = batchAccepted
+			case storage.OrderAlreadyUploaded:
+				res.Status = http.StatusOK
+				res.Result = batchAlreadyUploaded
+			case storage.OrderOfAnotherUser:
+				res.Status = http.StatusConflict
+				res.Result = batchOwnedByAnother
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusMultiStatus, resp)
+}
+
+var errUnsupportedBatchType = errors.New("unsupported content type")
+
+// parseOrderBatch extracts the order numbers from the body. Blank entries
+// are skipped; a CSV header row without digits is skipped as well.
+func parseOrderBatch(contentType string, body []byte) ([]string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errUnsupportedBatchType
+	}
+
+	var numbers []string
+	add := func(value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			numbers = append(numbers, value)
+		}
+	}
+
+	switch mediaType {
+	case "application/json":
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, errors.New("body must be a JSON array of order numbers")
+		}
+		for _, item := range items {
+			var number string
+			if err := json.Unmarshal(item, &number); err != nil {
+				// numbers are accepted as JSON numbers too; the raw text
+				// keeps all digits of long ones
+				number = string(item)
+			}
+			add(number)
+		}
+
+	case "text/csv":
+		reader := csv.NewReader(bytes.NewReader(body))
+		reader.FieldsPerRecord = -1
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, record := range records {
+			if i == 0 && !strings.ContainsAny(strings.Join(record, ""), "0123456789") {
+				continue
+			}
+			for _, field := range record {
+				add(field)
+			}
+		}
+
+	case "text/plain":
+		for _, line := range strings.Split(string(body), "\n") {
+			add(line)
+		}
+
+	default:
+		return nil, errUnsupportedBatchType
+	}
+
+	return numbers, nil
+}
+
+// checkOrderNumber returns why the number can not be an order, or an empty
+// string for a valid one.
+func checkOrderNumber(number string) string {
+	if !validation.OrderDigits(number) {
+		return "order number must contain digits only"
+	}
+	if !validation.Luhn(number) {
+		return "order number fails the Luhn check"
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_handler_SendOrdersBatchHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	mixedResults := func(orderStg *mock_storage.MockOrderStorage) {
+		orderStg.EXPECT().
+			AddOrderNumbers(gomock.Any(), []string{"9278923470", "12345678903", "79927398713"}, "testUserID").
+			Return([]storage.AddResult{storage.OrderAdded, storage.OrderAlreadyUploaded, storage.OrderOfAnotherUser}, nil)
+	}
+	mixedResp := []batchOrderResult{
+		{Number: "9278923470", Status: http.StatusAccepted, Result: batchAccepted},
+		{Number: "12345", Status: http.StatusUnprocessableEntity, Result: batchInvalid, Detail: "order number fails the Luhn check"},
+		{Number: "12345678903", Status: http.StatusOK, Result: batchAlreadyUploaded},
+		{Number: "79927398713", Status: http.StatusConflict, Result: batchOwnedByAnother},
+	}
+
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		limit          int
+		prepare        func(orderStg *mock_storage.MockOrderStorage)
+		wantStatusCode int
+		wantResp       []batchOrderResult
+		wantProblem    string
+	}{
+		{
+			name:           "json array",
+			contentType:    "application/json",
+			body:           `["9278923470", "12345", 12345678903, "79927398713"]`,
+			prepare:        mixedResults,
+			wantStatusCode: http.StatusMultiStatus,
+			wantResp:       mixedResp,
+		},
+		{
+			name:           "plain text lines",
+			contentType:    "text/plain; charset=utf-8",
+			body:           "9278923470\r\n12345\n\n12345678903\n79927398713\n",
+			prepare:        mixedResults,
+			wantStatusCode: http.StatusMultiStatus,
+			wantResp:       mixedResp,
+		},
+		{
+			name:           "csv with header",
+			contentType:    "text/csv",
+			body:           "number\n9278923470\n12345\n12345678903\n79927398713\n",
+			prepare:        mixedResults,
+			wantStatusCode: http.StatusMultiStatus,
+			wantResp:       mixedResp,
+		},
+		{
+			name:           "only invalid numbers",
+			contentType:    "text/plain",
+			body:           "12345\n12a45",
+			prepare:        func(orderStg *mock_storage.MockOrderStorage) {},
+			wantStatusCode: http.StatusMultiStatus,
+			wantResp: []batchOrderResult{
+				{Number: "12345", Status: http.StatusUnprocessableEntity, Result: batchInvalid, Detail: "order number fails the Luhn check"},
+				{Number: "12a45", Status: http.StatusUnprocessableEntity, Result: batchInvalid, Detail: "order number must contain digits only"},
+			},
+		},
+		{
+			name:           "over the limit",
+			contentType:    "text/plain",
+			body:           "9278923470\n12345678903\n79927398713",
+			limit:          2,
+			prepare:        func(orderStg *mock_storage.MockOrderStorage) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "validation_failed",
+		},
+		{
+			name:           "empty batch",
+			contentType:    "application/json",
+			body:           `[]`,
+			prepare:        func(orderStg *mock_storage.MockOrderStorage) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "validation_failed",
+		},
+		{
+			name:           "not an array",
+			contentType:    "application/json",
+			body:           `{"orders": ["9278923470"]}`,
+			prepare:        func(orderStg *mock_storage.MockOrderStorage) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "validation_failed",
+		},
+		{
+			name:           "unsupported content type",
+			contentType:    "application/xml",
+			body:           `<orders/>`,
+			prepare:        func(orderStg *mock_storage.MockOrderStorage) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "malformed_request",
+		},
+		{
+			name:        "number longer than an int",
+			contentType: "text/plain",
+			body:        "123456789012345678901234567891\n123456789012345678901234567890",
+			prepare: func(orderStg *mock_storage.MockOrderStorage) {
+				orderStg.EXPECT().AddOrderNumbers(gomock.Any(), []string{"123456789012345678901234567891"}, "testUserID").Return([]storage.AddResult{storage.OrderAdded}, nil)
+			},
+			wantStatusCode: http.StatusMultiStatus,
+			wantResp: []batchOrderResult{
+				{Number: "123456789012345678901234567891", Status: http.StatusAccepted, Result: batchAccepted},
+				{Number: "123456789012345678901234567890", Status: http.StatusUnprocessableEntity, Result: batchInvalid, Detail: "order number fails the Luhn check"},
+			},
+		},
+		{
+			name:        "storage error",
+			contentType: "text/plain",
+			body:        "9278923470",
+			prepare: func(orderStg *mock_storage.MockOrderStorage) {
+				orderStg.EXPECT().AddOrderNumbers(gomock.Any(), []string{"9278923470"}, "testUserID").Return(nil, errors.New("some error"))
+			},
+			wantStatusCode: http.StatusInternalServerError,
+			wantProblem:    "internal_error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("ORDER_BATCH_LIMIT", tt.limit)
+			defer viper.Set("ORDER_BATCH_LIMIT", 0)
+
+			orderStg := mock_storage.NewMockOrderStorage(ctrl)
+			tt.prepare(orderStg)
+			h := NewHandler(orderStg, historyStg, auth)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req = withPrincipal(req, "testUserID")
+
+			http.HandlerFunc(h.SendOrdersBatchHandler).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			if tt.wantProblem != "" {
+				requireProblem(t, result, body, tt.wantProblem)
+				return
+			}
+
+			resp := batchOrdersResp{}
+			require.NoError(t, json.Unmarshal(body, &resp))
+			require.Equal(t, tt.wantResp, resp.Results)
+		})
+	}
+}
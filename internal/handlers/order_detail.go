@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"net/http"
+	"time"
+)
+
+type orderDetailResp struct {
+	Number          string                   `json:"number"`
+	Status          string                   `json:"status"`
+	Accrual         float32                  `json:"accrual"`
+	Withdrawn       float32                  `json:"withdrawn"`
+	UploadedAt      string                   `json:"uploaded_at"`
+	StatusChangedAt string                   `json:"status_changed_at"`
+	Withdrawals     []withdrawalsHistoryResp `json:"withdrawals"`
+}
+
+// GetOrderDetailHandler answers an order of another user exactly like an
+// unknown one, so the endpoint can not be used to probe order numbers.
+func (h *handler) GetOrderDetailHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	number := chi.URLParam(r, "number")
+
+	order, err := h.orderStg.GetUserOrder(r.Context(), principal.UserID, number)
+	if err != nil {
+		if errors.Is(err, storage.ErrOrderNotFound) || errors.Is(err, storage.ErrOrderOwnedByAnotherUser) {
+			problem.Write(w, r, problem.OrderNotFound, "")
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	withdrawals, err := h.historyStg.GetOrderWithdrawals(r.Context(), principal.UserID, number)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	resp := orderDetailResp{
+		Number:          order.Number,
+		Status:          order.Status,
+		Accrual:         order.Accrual,
+		UploadedAt:      order.UploadedAt.Format(time.RFC3339),
+		StatusChangedAt: order.StatusChangedAt.Format(time.RFC3339),
+		Withdrawals:     []withdrawalsHistoryResp{},
+	}
+	for _, wd := range withdrawals {
+		if wd.ReversedAt == nil {
+			resp.Withdrawn += wd.Sum
+		}
+		resp.Withdrawals = append(resp.Withdrawals, newWithdrawalResp(wd))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_handler_GetOrderDetailHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	uploadedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	changedAt := uploadedAt.Add(time.Hour)
+	withdrawnAt := uploadedAt.Add(2 * time.Hour)
+
+	tests := []struct {
+		name           string
+		prepare        func(orderStg *mock_storage.MockOrderStorage, historyStg *mock_storage.MockHistoryStorage)
+		wantStatusCode int
+		wantResp       *orderDetailResp
+		wantProblem    string
+	}{
+		{
+			name: "ok",
+			prepare: func(orderStg *mock_storage.MockOrderStorage, historyStg *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().GetUserOrder(gomock.Any(), "testUserID", "9278923470").Return(&storage.Order{
+					UserID:          "testUserID",
+					Number:          "9278923470",
+					Status:          "PROCESSED",
+					Accrual:         500,
+					UploadedAt:      uploadedAt,
+					StatusChangedAt: changedAt,
+				}, nil)
+				historyStg.EXPECT().GetOrderWithdrawals(gomock.Any(), "testUserID", "9278923470").Return([]storage.Withdrawn{
+					{UserID: "testUserID", OrderNumber: "9278923470", Sum: 100, ProcessedAt: withdrawnAt},
+					{UserID: "testUserID", OrderNumber: "9278923470", Sum: 50, ProcessedAt: withdrawnAt},
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantResp: &orderDetailResp{
+				Number:          "9278923470",
+				Status:          "PROCESSED",
+				Accrual:         500,
+				Withdrawn:       150,
+				UploadedAt:      "2022-05-01T10:00:00Z",
+				StatusChangedAt: "2022-05-01T11:00:00Z",
+				Withdrawals: []withdrawalsHistoryResp{
+					{Order: "9278923470", Sum: 100, ProcessedAt: withdrawnAt},
+					{Order: "9278923470", Sum: 50, ProcessedAt: withdrawnAt},
+				},
+			},
+		},
+		{
+			name: "without withdrawals",
+			prepare: func(orderStg *mock_storage.MockOrderStorage, historyStg *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().GetUserOrder(gomock.Any(), "testUserID", "9278923470").Return(&storage.Order{
+					Number:          "9278923470",
+					Status:          "NEW",
+					UploadedAt:      uploadedAt,
+					StatusChangedAt: uploadedAt,
+				}, nil)
+				historyStg.EXPECT().GetOrderWithdrawals(gomock.Any(), "testUserID", "9278923470").Return(nil, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantResp: &orderDetailResp{
+				Number:          "9278923470",
+				Status:          "NEW",
+				UploadedAt:      "2022-05-01T10:00:00Z",
+				StatusChangedAt: "2022-05-01T10:00:00Z",
+				Withdrawals:     []withdrawalsHistoryResp{},
+			},
+		},
+		{
+			name: "unknown order",
+			prepare: func(orderStg *mock_storage.MockOrderStorage, historyStg *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().GetUserOrder(gomock.Any(), "testUserID", "9278923470").Return(nil, storage.ErrOrderNotFound)
+			},
+			wantStatusCode: http.StatusNotFound,
+			wantProblem:    "order_not_found",
+		},
+		{
+			name: "order of another user",
+			prepare: func(orderStg *mock_storage.MockOrderStorage, historyStg *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().GetUserOrder(gomock.Any(), "testUserID", "9278923470").Return(nil, storage.ErrOrderOwnedByAnotherUser)
+			},
+			wantStatusCode: http.StatusNotFound,
+			wantProblem:    "order_not_found",
+		},
+		{
+			name: "history storage error",
+			prepare: func(orderStg *mock_storage.MockOrderStorage, historyStg *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().GetUserOrder(gomock.Any(), "testUserID", "9278923470").Return(&storage.Order{Number: "9278923470"}, nil)
+				historyStg.EXPECT().GetOrderWithdrawals(gomock.Any(), "testUserID", "9278923470").Return(nil, errors.New("some error"))
+			},
+			wantStatusCode: http.StatusInternalServerError,
+			wantProblem:    "internal_error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderStg := mock_storage.NewMockOrderStorage(ctrl)
+			historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+			tt.prepare(orderStg, historyStg)
+			h := NewHandler(orderStg, historyStg, auth)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/user/orders/9278923470", nil)
+			req = withURLParams(withPrincipal(req, "testUserID"), map[string]string{"number": "9278923470"})
+
+			http.HandlerFunc(h.GetOrderDetailHandler).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			if tt.wantProblem != "" {
+				requireProblem(t, result, body, tt.wantProblem)
+				return
+			}
+
+			resp := orderDetailResp{}
+			require.NoError(t, json.Unmarshal(body, &resp))
+			require.Equal(t, *tt.wantResp, resp)
+		})
+	}
+}
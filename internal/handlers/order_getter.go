@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -14,20 +18,40 @@ type orderResp struct {
 	UploadedAt string  `json:"uploaded_at"`
 }
 
+func newOrderResp(o storage.Order) orderResp {
+	return orderResp{
+		Number:     o.Number,
+		Status:     o.Status,
+		Accrual:    o.Accrual,
+		UploadedAt: o.UploadedAt.Format(time.RFC3339),
+	}
+}
+
 func (h *handler) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
 	var resp []orderResp
 
-	token, err := r.Cookie("session_token")
-	if err != nil || token == nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	format, errs := exportFormat(r, formatJSON, formatCSV, formatNDJSON)
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	if h.notModified(w, r, principal.UserID, format) {
+		return
+	}
+	if format != formatJSON {
+		h.streamOrders(w, r, principal.UserID, format)
 		return
 	}
 
-	orders, err := h.orderStg.GetUserOrders(token.Value)
+	orders, err := h.orderStg.GetUserOrders(r.Context(), principal.UserID)
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
 	if len(orders) == 0 {
@@ -36,17 +60,11 @@ func (h *handler) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, o := range orders {
-		resp = append(resp, orderResp{
-			Number:     o.Number,
-			Status:     o.Status,
-			Accrual:    o.Accrual,
-			UploadedAt: o.UploadedAt.Format(time.RFC3339),
-		})
+		resp = append(resp, newOrderResp(o))
 	}
 	marshalResp, err := json.Marshal(resp)
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
 
@@ -54,3 +72,29 @@ func (h *handler) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(marshalResp)
 }
+
+// streamOrders sends the orders as CSV or NDJSON straight from the database
+// cursor. An empty export is still 200 with the CSV header only.
+func (h *handler) streamOrders(w http.ResponseWriter, r *http.Request, userID string, format string) {
+	stream := newRowStream(w, format, []string{"number", "status", "accrual", "uploaded_at"})
+
+	err := h.orderStg.StreamUserOrders(r.Context(), userID, func(o storage.Order) error {
+		resp := newOrderResp(o)
+		return stream.Write([]string{
+			resp.Number,
+			resp.Status,
+			strconv.FormatFloat(float64(resp.Accrual), 'f', -1, 32),
+			resp.UploadedAt,
+		}, resp)
+	})
+	if err == nil {
+		err = stream.Close()
+	}
+	if err != nil {
+		if !stream.Started() {
+			problem.WriteError(w, r, err)
+			return
+		}
+		slog.WarnContext(r.Context(), "orders export aborted", "error", err)
+	}
+}
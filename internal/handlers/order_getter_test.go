@@ -60,14 +60,13 @@ func Test_handler_GetOrderHandler_ok(t *testing.T) {
 
 	h := NewHandler(orderStg, historyStg, auth)
 
-	orderStg.EXPECT().GetUserOrders(gomock.Any()).Return(stgResp, nil)
+	orderStg.EXPECT().GetUserDataVersion(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+
+	orderStg.EXPECT().GetUserOrders(gomock.Any(), gomock.Any()).Return(stgResp, nil)
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/user/orders", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "session_token",
-		Value: "testToken",
-	})
+	req = withPrincipal(req, "testUserID")
 
 	handler := http.HandlerFunc(h.GetOrderHandler)
 	handler.ServeHTTP(rec, req)
@@ -93,14 +92,13 @@ func Test_handler_GetOrderHandler_storageError(t *testing.T) {
 
 	h := NewHandler(orderStg, historyStg, auth)
 
-	orderStg.EXPECT().GetUserOrders(gomock.Any()).Return(nil, errors.New("some error"))
+	orderStg.EXPECT().GetUserDataVersion(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+
+	orderStg.EXPECT().GetUserOrders(gomock.Any(), gomock.Any()).Return(nil, errors.New("some error"))
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/user/orders", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "session_token",
-		Value: "testToken",
-	})
+	req = withPrincipal(req, "testUserID")
 
 	handler := http.HandlerFunc(h.GetOrderHandler)
 	handler.ServeHTTP(rec, req)
@@ -110,7 +108,7 @@ func Test_handler_GetOrderHandler_storageError(t *testing.T) {
 
 	body, err := io.ReadAll(result.Body)
 	require.NoError(t, err)
-	require.Empty(t, body)
+	requireProblem(t, result, body, "internal_error")
 
 	err = result.Body.Close()
 	require.NoError(t, err)
@@ -126,14 +124,13 @@ func Test_handler_GetOrderHandler_noContent(t *testing.T) {
 
 	h := NewHandler(orderStg, historyStg, auth)
 
-	orderStg.EXPECT().GetUserOrders(gomock.Any()).Return([]storage.Order{}, nil)
+	orderStg.EXPECT().GetUserDataVersion(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+
+	orderStg.EXPECT().GetUserOrders(gomock.Any(), gomock.Any()).Return([]storage.Order{}, nil)
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/user/orders", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "session_token",
-		Value: "testToken",
-	})
+	req = withPrincipal(req, "testUserID")
 
 	handler := http.HandlerFunc(h.GetOrderHandler)
 	handler.ServeHTTP(rec, req)
@@ -148,3 +145,122 @@ func Test_handler_GetOrderHandler_noContent(t *testing.T) {
 	err = result.Body.Close()
 	require.NoError(t, err)
 }
+
+func Test_handler_GetOrderHandler_export(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uploadedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	orders := []storage.Order{
+		{Number: "12345", Status: "PROCESSED", Accrual: 100.5, UploadedAt: uploadedAt},
+		{Number: "67890", Status: "NEW", UploadedAt: uploadedAt},
+	}
+	streamOrders := func(orders []storage.Order, err error) func(orderStg *mock_storage.MockOrderStorage) {
+		return func(orderStg *mock_storage.MockOrderStorage) {
+			orderStg.EXPECT().StreamUserOrders(gomock.Any(), "testUserID", gomock.Any()).DoAndReturn(
+				func(_ interface{}, _ string, fn func(storage.Order) error) error {
+					for _, o := range orders {
+						if err := fn(o); err != nil {
+							return err
+						}
+					}
+					return err
+				})
+		}
+	}
+
+	tests := []struct {
+		name            string
+		target          string
+		accept          string
+		prepare         func(orderStg *mock_storage.MockOrderStorage)
+		wantStatusCode  int
+		wantContentType string
+		wantBody        string
+		wantProblem     string
+	}{
+		{
+			name:            "csv by accept header",
+			target:          "/api/user/orders",
+			accept:          "text/csv",
+			prepare:         streamOrders(orders, nil),
+			wantStatusCode:  http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody: "number,status,accrual,uploaded_at\n" +
+				"12345,PROCESSED,100.5,2022-05-01T10:00:00Z\n" +
+				"67890,NEW,0,2022-05-01T10:00:00Z\n",
+		},
+		{
+			name:            "ndjson by format",
+			target:          "/api/user/orders?format=ndjson",
+			accept:          "application/json",
+			prepare:         streamOrders(orders, nil),
+			wantStatusCode:  http.StatusOK,
+			wantContentType: "application/x-ndjson",
+			wantBody: `{"number":"12345","status":"PROCESSED","accrual":100.5,"uploaded_at":"2022-05-01T10:00:00Z"}` + "\n" +
+				`{"number":"67890","status":"NEW","uploaded_at":"2022-05-01T10:00:00Z"}` + "\n",
+		},
+		{
+			name:            "empty csv",
+			target:          "/api/user/orders?format=csv",
+			prepare:         streamOrders(nil, nil),
+			wantStatusCode:  http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "number,status,accrual,uploaded_at\n",
+		},
+		{
+			name:           "error before the first row",
+			target:         "/api/user/orders?format=csv",
+			prepare:        streamOrders(nil, errors.New("some error")),
+			wantStatusCode: http.StatusInternalServerError,
+			wantProblem:    "internal_error",
+		},
+		{
+			// the status is already sent, the buffered rows are dropped
+			name:            "error after the first row",
+			target:          "/api/user/orders?format=csv",
+			prepare:         streamOrders(orders[:1], errors.New("some error")),
+			wantStatusCode:  http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "",
+		},
+		{
+			name:           "unknown format",
+			target:         "/api/user/orders?format=xlsx",
+			prepare:        func(orderStg *mock_storage.MockOrderStorage) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "validation_failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderStg := mock_storage.NewMockOrderStorage(ctrl)
+			orderStg.EXPECT().GetUserDataVersion(gomock.Any(), "testUserID").Return(int64(1), nil).AnyTimes()
+			tt.prepare(orderStg)
+			h := NewHandler(orderStg, mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			req = withPrincipal(req, "testUserID")
+
+			http.HandlerFunc(h.GetOrderHandler).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			if tt.wantProblem != "" {
+				requireProblem(t, result, body, tt.wantProblem)
+				return
+			}
+			require.Equal(t, tt.wantContentType, result.Header.Get("Content-Type"))
+			require.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
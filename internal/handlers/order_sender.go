@@ -1,68 +1,75 @@
 package handlers
 
 import (
-	"github.com/jackc/pgerrcode"
-	"github.com/theplant/luhn"
+	"errors"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
 	"io"
-	"log"
 	"net/http"
-	"strconv"
 	"strings"
 )
 
 func (h *handler) SendOrderHandler(w http.ResponseWriter, r *http.Request) {
 	if !strings.Contains(r.Header.Get(`Content-Type`), `text/plain`) {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Invalid request format"))
+		problem.Write(w, r, problem.MalformedRequest, "order number must be sent as text/plain")
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
 
-	token, err := r.Cookie("session_token")
-	if err != nil || token == nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
 		return
 	}
 
-	reqValue := string(body)
-	reqValueInt, err := strconv.Atoi(reqValue)
-	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
+	existed, ok := h.addOrder(w, r, principal.UserID, string(body))
+	if !ok {
 		return
 	}
-
-	if !luhn.Valid(reqValueInt) {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		w.Write([]byte("Проверьте формат номера заказа"))
+	if existed {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("the order has already been created by the current user"))
 		return
 	}
 
-	err = h.orderStg.AddOrderNumber(reqValue, token.Value)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// addOrder checks the order number and adds it for the user; existed
+// reports that the user had already uploaded it. On failure the problem is
+// written and ok is false.
+func (h *handler) addOrder(w http.ResponseWriter, r *http.Request, userID string, number string) (existed bool, ok bool) {
+	if !validation.OrderDigits(number) {
+		problem.Write(w, r, problem.MalformedRequest, "order number must contain digits only")
+		return false, false
+	}
+
+	if !validation.Luhn(number) {
+		problem.Write(w, r, problem.InvalidOrder, "")
+		return false, false
+	}
+
+	err := h.orderStg.AddOrderNumber(r.Context(), number, userID)
 	if err != nil {
-		if err.Error() == "duplicate" {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("the order has already been created by the current user"))
-			return
+		if errors.Is(err, storage.ErrOrderExists) {
+			return true, true
 		}
 
-		if err.Error() == pgerrcode.UniqueViolation {
-			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte("the order has already been created by the another user"))
-			return
+		if errors.Is(err, storage.ErrOrderOwnedByAnotherUser) {
+			problem.Write(w, r, problem.OrderOfOtherUser, "")
+			return false, false
 		}
 
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		problem.WriteError(w, r, err)
+		return false, false
 	}
 
-	w.WriteHeader(http.StatusAccepted)
+	return false, true
 }
@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"errors"
 	"github.com/golang/mock/gomock"
-	"github.com/jackc/pgerrcode"
 	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
 	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
 	"github.com/stretchr/testify/require"
 	"io"
@@ -27,13 +27,14 @@ func Test_handler_SendOrderHandler(t *testing.T) {
 		orderStg       func() *mock_storage.MockOrderStorage
 		wantStatusCode int
 		wantResp       []byte
+		wantProblem    string
 	}{
 		{
 			name:     "ok",
 			orderNum: "9278923470",
 			orderStg: func() *mock_storage.MockOrderStorage {
 				orderStg := mock_storage.NewMockOrderStorage(ctrl)
-				orderStg.EXPECT().AddOrderNumber("9278923470", "testToken").Return(nil)
+				orderStg.EXPECT().AddOrderNumber(gomock.Any(), "9278923470", "testUserID").Return(nil)
 				return orderStg
 			},
 			wantStatusCode: http.StatusAccepted,
@@ -46,25 +47,25 @@ func Test_handler_SendOrderHandler(t *testing.T) {
 				return mock_storage.NewMockOrderStorage(ctrl)
 			},
 			wantStatusCode: http.StatusUnprocessableEntity,
-			wantResp:       []byte("Проверьте формат номера заказа"),
+			wantProblem:    "invalid_order_number",
 		},
 		{
 			name:     "order storage error",
 			orderNum: "12345678903",
 			orderStg: func() *mock_storage.MockOrderStorage {
 				orderStg := mock_storage.NewMockOrderStorage(ctrl)
-				orderStg.EXPECT().AddOrderNumber("12345678903", "testToken").Return(errors.New("some error"))
+				orderStg.EXPECT().AddOrderNumber(gomock.Any(), "12345678903", "testUserID").Return(errors.New("some error"))
 				return orderStg
 			},
 			wantStatusCode: http.StatusInternalServerError,
-			wantResp:       []byte{},
+			wantProblem:    "internal_error",
 		},
 		{
 			name:     "order storage duplicate error",
 			orderNum: "12345678903",
 			orderStg: func() *mock_storage.MockOrderStorage {
 				orderStg := mock_storage.NewMockOrderStorage(ctrl)
-				orderStg.EXPECT().AddOrderNumber("12345678903", "testToken").Return(errors.New("duplicate"))
+				orderStg.EXPECT().AddOrderNumber(gomock.Any(), "12345678903", "testUserID").Return(storage.ErrOrderExists)
 				return orderStg
 			},
 			wantStatusCode: http.StatusOK,
@@ -75,11 +76,11 @@ func Test_handler_SendOrderHandler(t *testing.T) {
 			orderNum: "12345678903",
 			orderStg: func() *mock_storage.MockOrderStorage {
 				orderStg := mock_storage.NewMockOrderStorage(ctrl)
-				orderStg.EXPECT().AddOrderNumber("12345678903", "testToken").Return(errors.New(pgerrcode.UniqueViolation))
+				orderStg.EXPECT().AddOrderNumber(gomock.Any(), "12345678903", "testUserID").Return(storage.ErrOrderOwnedByAnotherUser)
 				return orderStg
 			},
 			wantStatusCode: http.StatusConflict,
-			wantResp:       []byte("the order has already been created by the another user"),
+			wantProblem:    "order_owned_by_another_user",
 		},
 	}
 	for _, tt := range tests {
@@ -90,10 +91,7 @@ func Test_handler_SendOrderHandler(t *testing.T) {
 			rec := httptest.NewRecorder()
 			req := httptest.NewRequest(http.MethodPost, "/user/orders", bytes.NewReader([]byte(tt.orderNum)))
 			req.Header.Add(`Content-Type`, `text/plain`)
-			req.AddCookie(&http.Cookie{
-				Name:  "session_token",
-				Value: "testToken",
-			})
+			req = withPrincipal(req, "testUserID")
 
 			handler := http.HandlerFunc(h.SendOrderHandler)
 			handler.ServeHTTP(rec, req)
@@ -103,7 +101,11 @@ func Test_handler_SendOrderHandler(t *testing.T) {
 
 			body, err := io.ReadAll(result.Body)
 			require.NoError(t, err)
-			require.Equal(t, tt.wantResp, body)
+			if tt.wantProblem != "" {
+				requireProblem(t, result, body, tt.wantProblem)
+			} else {
+				require.Equal(t, tt.wantResp, body)
+			}
 
 			err = result.Body.Close()
 			require.NoError(t, err)
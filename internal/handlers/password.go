@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type passwordResetRequestReq struct {
+	Login string `json:"login"`
+}
+
+type passwordResetReq struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// validateNewPassword checks the password policy and reports the errors
+// against the new_password field of the request.
+func validateNewPassword(password string, login string) validation.Errors {
+	errs := validation.PasswordPolicyFromConfig().Validate(password, login)
+	for i := range errs {
+		errs[i].Field = "new_password"
+	}
+	return errs
+}
+
+func (h *handler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	e := encryption.New()
+
+	req := changePasswordReq{}
+	errs := decodeStrict(body, &req)
+	if len(errs) == 0 {
+		errs = append(requiredField("current_password", req.CurrentPassword), requiredField("new_password", req.NewPassword)...)
+	}
+	if len(errs) == 0 {
+		login, _ := e.DecodeData(principal.Login)
+		errs = validateNewPassword(req.NewPassword, login)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	err = h.auth.ChangePassword(principal.UserID, req.CurrentPassword, req.NewPassword, principal.SessionID)
+	if err != nil {
+		if errors.Is(err, authentication.ErrWrongPassword) {
+			problem.Write(w, r, problem.WrongPassword, "")
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// PasswordResetRequestHandler answers 202 whether or not the login exists,
+// so that it cannot be used to find out registered logins.
+func (h *handler) PasswordResetRequestHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	req := passwordResetRequestReq{}
+	errs := decodeStrict(body, &req)
+	req.Login = validation.NormalizeLogin(req.Login)
+	if len(errs) == 0 {
+		errs = requiredField("login", req.Login)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	e := encryption.New()
+
+	user, err := h.auth.GetUserByLogin(e.EncodeData(req.Login))
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	if user == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, tokenHash, err := authentication.NewResetToken()
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	ttl := authentication.PasswordResetTTL()
+
+	err = h.auth.CreatePasswordReset(user.ID, tokenHash, ttl)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	err = h.notifier.PasswordReset(req.Login, token, time.Now().Add(ttl))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't send password reset", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *handler) PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	req := passwordResetReq{}
+	errs := decodeStrict(body, &req)
+	if len(errs) == 0 {
+		errs = append(requiredField("token", req.Token), requiredField("new_password", req.NewPassword)...)
+	}
+	if len(errs) == 0 {
+		errs = validateNewPassword(req.NewPassword, "")
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	err = h.auth.ResetPassword(authentication.HashToken(req.Token), req.NewPassword)
+	if err != nil {
+		if errors.Is(err, authentication.ErrInvalidResetToken) {
+			writeValidationErrors(w, r, validation.Errors{{Field: "token", Code: "invalid", Message: "reset token is invalid, used or expired"}})
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
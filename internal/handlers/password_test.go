@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"github.com/golang/mock/gomock"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeNotifier struct {
+	login string
+	token string
+}
+
+func (n *fakeNotifier) PasswordReset(login string, token string, expiresAt time.Time) error {
+	n.login = login
+	n.token = token
+	return nil
+}
+
+func Test_handler_ChangePasswordHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+
+	e := encryption.New()
+
+	tests := []struct {
+		name           string
+		reqBody        string
+		auth           func() *mock_authentication.MockAuth
+		wantStatusCode int
+	}{
+		{
+			name:    "ok",
+			reqBody: `{"current_password": "oldPassword1", "new_password": "newPassword1"}`,
+			auth: func() *mock_authentication.MockAuth {
+				auth := mock_authentication.NewMockAuth(ctrl)
+				auth.EXPECT().ChangePassword("testUserID", "oldPassword1", "newPassword1", "testSessionID").Return(nil)
+				return auth
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:    "wrong current password",
+			reqBody: `{"current_password": "oldPassword2", "new_password": "newPassword1"}`,
+			auth: func() *mock_authentication.MockAuth {
+				auth := mock_authentication.NewMockAuth(ctrl)
+				auth.EXPECT().ChangePassword(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(authentication.ErrWrongPassword)
+				return auth
+			},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			name:    "weak new password",
+			reqBody: `{"current_password": "oldPassword1", "new_password": "qwerty"}`,
+			auth: func() *mock_authentication.MockAuth {
+				return mock_authentication.NewMockAuth(ctrl)
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(orderStg, historyStg, tt.auth())
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/password", strings.NewReader(tt.reqBody))
+			req = req.WithContext(authentication.ContextWithPrincipal(req.Context(), authentication.Principal{
+				UserID:    "testUserID",
+				Login:     e.EncodeData("testlogin"),
+				SessionID: "testSessionID",
+			}))
+
+			handler := http.HandlerFunc(h.ChangePasswordHandler)
+			handler.ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+
+			err := result.Body.Close()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_handler_PasswordResetRequestHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	e := encryption.New()
+	notifier := &fakeNotifier{}
+
+	h := NewHandler(orderStg, historyStg, auth).(*handler)
+	h.notifier = notifier
+
+	var storedHash string
+	auth.EXPECT().GetUserByLogin(e.EncodeData("testlogin")).Return(&authentication.User{ID: "7"}, nil)
+	auth.EXPECT().GetUserByLogin(e.EncodeData("unknown")).Return(nil, nil)
+	auth.EXPECT().CreatePasswordReset("7", gomock.Any(), authentication.PasswordResetTTL()).
+		DoAndReturn(func(userID string, tokenHash string, ttl time.Duration) error {
+			storedHash = tokenHash
+			return nil
+		})
+
+	for _, login := range []string{"TestLogin", "unknown"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/user/password/reset-request", strings.NewReader(`{"login": "`+login+`"}`))
+
+		handler := http.HandlerFunc(h.PasswordResetRequestHandler)
+		handler.ServeHTTP(rec, req)
+
+		result := rec.Result()
+		require.Equal(t, http.StatusAccepted, result.StatusCode)
+
+		err := result.Body.Close()
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, "testlogin", notifier.login)
+	require.NotEmpty(t, notifier.token)
+	require.NotEqual(t, notifier.token, storedHash)
+	require.Equal(t, authentication.HashToken(notifier.token), storedHash)
+}
+
+func Test_handler_PasswordResetHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	auth.EXPECT().ResetPassword(authentication.HashToken("goodToken"), "newPassword1").Return(nil)
+	auth.EXPECT().ResetPassword(authentication.HashToken("usedToken"), "newPassword1").Return(authentication.ErrInvalidResetToken)
+
+	for token, wantStatusCode := range map[string]int{
+		"goodToken": http.StatusOK,
+		"usedToken": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/user/password/reset", strings.NewReader(`{"token": "`+token+`", "new_password": "newPassword1"}`))
+
+		handler := http.HandlerFunc(h.PasswordResetHandler)
+		handler.ServeHTTP(rec, req)
+
+		result := rec.Result()
+		require.Equal(t, wantStatusCode, result.StatusCode)
+
+		err := result.Body.Close()
+		require.NoError(t, err)
+	}
+}
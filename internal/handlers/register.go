@@ -1,61 +1,57 @@
 package handlers
 
 import (
-	"encoding/json"
-	"github.com/jackc/pgerrcode"
+	"errors"
 	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
 	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
-type registerReq struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
-}
-
 func (h *handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	token, err := r.Cookie("session_token")
-	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Println("can't read body", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
 		return
 	}
 
-	unmarshalBody := registerReq{}
-	if err := json.Unmarshal(body, &unmarshalBody); err != nil {
-		log.Println("can't unmarshal request body", err)
-		w.WriteHeader(http.StatusBadRequest)
+	creds, errs := decodeCredentials(body)
+	if len(errs) == 0 {
+		errs = append(validation.ValidateLogin(creds.Login), validation.PasswordPolicyFromConfig().Validate(creds.Password, creds.Login)...)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
 		return
 	}
 
 	e := encryption.New()
-	encLogin := e.EncodeData(unmarshalBody.Login)
-	encPassword := e.EncodeData(unmarshalBody.Password)
+	encLogin := e.EncodeData(creds.Login)
+
+	// the new account gets a fresh session, like a login does
+	token, err := authentication.NewSessionToken()
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
 
 	err = h.auth.AddUserInfoToTable(authentication.User{
-		Token:    token.Value,
+		Token:    token,
 		Login:    encLogin,
-		Password: encPassword,
+		Password: creds.Password,
 	})
 	if err != nil {
-		if err.Error() == pgerrcode.UniqueViolation {
-			w.WriteHeader(http.StatusConflict)
-			w.Write([]byte("username already exists"))
+		if errors.Is(err, authentication.ErrLoginTaken) {
+			problem.Write(w, r, problem.LoginTaken, "")
 			return
 		}
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
 
+	setSessionCookie(w, token)
 	w.WriteHeader(http.StatusOK)
 }
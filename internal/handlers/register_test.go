@@ -5,8 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/golang/mock/gomock"
-	"github.com/jackc/pgerrcode"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
 	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
 	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
 	"github.com/stretchr/testify/require"
 	"io"
@@ -16,6 +17,8 @@ import (
 )
 
 func Test_handler_RegisterHandler_ok(t *testing.T) {
+	withTestEncryptionKey(t)
+
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -27,9 +30,9 @@ func Test_handler_RegisterHandler_ok(t *testing.T) {
 
 	auth.EXPECT().AddUserInfoToTable(gomock.Any()).Return(nil)
 
-	reqBody, _ := json.Marshal(registerReq{
+	reqBody, _ := json.Marshal(credentialsReq{
 		Login:    "testLogin",
-		Password: "testPassword",
+		Password: "testPassword1",
 	})
 
 	r := bytes.NewReader(reqBody)
@@ -55,7 +58,39 @@ func Test_handler_RegisterHandler_ok(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func Test_handler_RegisterHandler_shortLogin(t *testing.T) {
+	withTestEncryptionKey(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	auth := mock_authentication.NewMockAuth(ctrl)
+	h := NewHandler(mock_storage.NewMockOrderStorage(ctrl), mock_storage.NewMockHistoryStorage(ctrl), auth)
+
+	// every byte of the login is kept, so "alice" and "alicX" are
+	// different users; the password is hashed by the storage
+	auth.EXPECT().AddUserInfoToTable(gomock.Any()).DoAndReturn(func(user authentication.User) error {
+		require.Equal(t, "YWxpY2U=", user.Login)
+		require.Equal(t, "testPassword1", user.Password)
+		return nil
+	})
+
+	reqBody, _ := json.Marshal(credentialsReq{
+		Login:    "alice",
+		Password: "testPassword1",
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/user/register", bytes.NewReader(reqBody))
+
+	http.HandlerFunc(h.RegisterHandler).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
 func Test_handler_RegisterHandler_uniqueError(t *testing.T) {
+	withTestEncryptionKey(t)
+
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -65,11 +100,11 @@ func Test_handler_RegisterHandler_uniqueError(t *testing.T) {
 
 	h := NewHandler(orderStg, historyStg, auth)
 
-	auth.EXPECT().AddUserInfoToTable(gomock.Any()).Return(errors.New(pgerrcode.UniqueViolation))
+	auth.EXPECT().AddUserInfoToTable(gomock.Any()).Return(authentication.ErrLoginTaken)
 
-	reqBody, _ := json.Marshal(loginReq{
+	reqBody, _ := json.Marshal(credentialsReq{
 		Login:    "testLogin",
-		Password: "testPassword",
+		Password: "testPassword1",
 	})
 
 	r := bytes.NewReader(reqBody)
@@ -89,13 +124,15 @@ func Test_handler_RegisterHandler_uniqueError(t *testing.T) {
 
 	body, err := io.ReadAll(result.Body)
 	require.NoError(t, err)
-	require.Equal(t, []byte("username already exists"), body)
+	requireProblem(t, result, body, "login_taken")
 
 	err = result.Body.Close()
 	require.NoError(t, err)
 }
 
 func Test_handler_RegisterHandler_authError(t *testing.T) {
+	withTestEncryptionKey(t)
+
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -107,9 +144,9 @@ func Test_handler_RegisterHandler_authError(t *testing.T) {
 
 	auth.EXPECT().AddUserInfoToTable(gomock.Any()).Return(errors.New("some error"))
 
-	reqBody, _ := json.Marshal(loginReq{
+	reqBody, _ := json.Marshal(credentialsReq{
 		Login:    "testLogin",
-		Password: "testPassword",
+		Password: "testPassword1",
 	})
 
 	r := bytes.NewReader(reqBody)
@@ -129,8 +166,85 @@ func Test_handler_RegisterHandler_authError(t *testing.T) {
 
 	body, err := io.ReadAll(result.Body)
 	require.NoError(t, err)
-	require.Empty(t, body)
+	requireProblem(t, result, body, "internal_error")
 
 	err = result.Body.Close()
 	require.NoError(t, err)
 }
+
+func Test_handler_RegisterHandler_validation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	tests := []struct {
+		name      string
+		reqBody   string
+		wantCodes []string
+	}{
+		{
+			name:      "empty credentials",
+			reqBody:   `{"login": "  ", "password": ""}`,
+			wantCodes: []string{"login:required", "password:required"},
+		},
+		{
+			name:      "malformed body",
+			reqBody:   `{"login": "testLogin"`,
+			wantCodes: []string{"body:malformed"},
+		},
+		{
+			name:      "unknown field",
+			reqBody:   `{"login": "testLogin", "password": "testPassword1", "role": "admin"}`,
+			wantCodes: []string{"body:malformed"},
+		},
+		{
+			name:      "invalid login",
+			reqBody:   `{"login": "test login", "password": "testPassword1"}`,
+			wantCodes: []string{"login:invalid_characters"},
+		},
+		{
+			name:      "weak password",
+			reqBody:   `{"login": "testLogin", "password": "short"}`,
+			wantCodes: []string{"password:too_short", "password:missing_digit"},
+		},
+		{
+			name:      "common password",
+			reqBody:   `{"login": "testLogin", "password": "password123"}`,
+			wantCodes: []string{"password:common_password"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/register", bytes.NewReader([]byte(tt.reqBody)))
+			req.AddCookie(&http.Cookie{
+				Name:  "session_token",
+				Value: "testToken",
+			})
+
+			handler := http.HandlerFunc(h.RegisterHandler)
+			handler.ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, http.StatusBadRequest, result.StatusCode)
+			require.Equal(t, problem.ContentType, result.Header.Get("Content-Type"))
+
+			resp := problem.Details{}
+			require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+
+			var codes []string
+			for _, e := range resp.Errors {
+				codes = append(codes, e.Field+":"+e.Code)
+			}
+			require.Equal(t, tt.wantCodes, codes)
+
+			err := result.Body.Close()
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"net/http"
+	"strconv"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	marshalResp, err := json.Marshal(v)
+	if err != nil {
+		problem.WriteError(w, nil, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(marshalResp)
+}
+
+// validID reports whether a URL parameter can be a database id, so that
+// garbage is answered with 404 before it reaches a bigint comparison.
+func validID(id string) bool {
+	n, err := strconv.ParseInt(id, 10, 64)
+	return err == nil && n > 0
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+type statementLineResp struct {
+	Date    time.Time `json:"date"`
+	Type    string    `json:"type"`
+	Order   string    `json:"order"`
+	Amount  float64   `json:"amount"`
+	Balance float64   `json:"balance"`
+}
+
+type statementResp struct {
+	From           *time.Time          `json:"from,omitempty"`
+	To             *time.Time          `json:"to,omitempty"`
+	OpeningBalance float64             `json:"opening_balance"`
+	ClosingBalance float64             `json:"closing_balance"`
+	Lines          []statementLineResp `json:"lines"`
+}
+
+// GetStatementHandler returns the accruals and withdrawals of a period with
+// the balance after each of them. from and to take a date or an RFC 3339
+// time; a date in to includes the whole day. The statement is CSV when
+// asked for with format=csv or an Accept header of text/csv.
+func (h *handler) GetStatementHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	query := r.URL.Query()
+
+	var errs validation.Errors
+	from, fromErrs := parseStatementBound("from", query.Get("from"), false)
+	to, toErrs := parseStatementBound("to", query.Get("to"), true)
+	errs = append(errs, fromErrs...)
+	errs = append(errs, toErrs...)
+	if len(errs) == 0 && from != nil && to != nil && !from.Before(*to) {
+		errs = append(errs, validation.FieldError{Field: "to", Code: "invalid", Message: "to must be later than from"})
+	}
+
+	format, formatErrs := exportFormat(r, formatJSON, formatCSV)
+	errs = append(errs, formatErrs...)
+
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	statement, err := h.orderStg.GetStatement(r.Context(), principal.UserID, from, to)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	resp := statementResp{
+		From:           from,
+		To:             to,
+		OpeningBalance: statement.OpeningBalance,
+		ClosingBalance: statement.ClosingBalance,
+		Lines:          []statementLineResp{},
+	}
+	for _, line := range statement.Lines {
+		resp.Lines = append(resp.Lines, statementLineResp{
+			Date:    line.At,
+			Type:    line.Kind,
+			Order:   line.OrderNumber,
+			Amount:  line.Amount,
+			Balance: line.Balance,
+		})
+	}
+
+	if format == formatCSV {
+		writeStatementCSV(w, r, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func parseStatementBound(field string, value string, endOfDay bool) (*time.Time, validation.Errors) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		t = t.UTC()
+		return &t, nil
+	}
+
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return nil, validation.Errors{{Field: field, Code: "invalid", Message: field + " must be a date (YYYY-MM-DD) or an RFC 3339 time"}}
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// writeStatementCSV puts the opening and closing balances in rows of their
+// own around the lines, so the file reads like a bank statement.
+func writeStatementCSV(w http.ResponseWriter, r *http.Request, resp statementResp) {
+	amount := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+
+	buf := &bytes.Buffer{}
+	out := csv.NewWriter(buf)
+	out.Write([]string{"date", "type", "order", "amount", "balance"})
+
+	opening := ""
+	if resp.From != nil {
+		opening = resp.From.Format(time.RFC3339)
+	}
+	out.Write([]string{opening, "opening_balance", "", "", amount(resp.OpeningBalance)})
+
+	for _, line := range resp.Lines {
+		out.Write([]string{line.Date.Format(time.RFC3339), line.Type, line.Order, amount(line.Amount), amount(line.Balance)})
+	}
+
+	closing := ""
+	if resp.To != nil {
+		closing = resp.To.Format(time.RFC3339)
+	}
+	out.Write([]string{closing, "closing_balance", "", "", amount(resp.ClosingBalance)})
+
+	out.Flush()
+	if err := out.Error(); err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="statement.csv"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_handler_GetStatementHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	from := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	accruedAt := time.Date(2022, 5, 3, 12, 0, 0, 0, time.UTC)
+	withdrawnAt := time.Date(2022, 5, 10, 9, 30, 0, 0, time.UTC)
+
+	statement := &storage.Statement{
+		OpeningBalance: 100,
+		Lines: []storage.StatementLine{
+			{At: accruedAt, Kind: storage.StatementAccrual, OrderNumber: "9278923470", Amount: 500, Balance: 600},
+			{At: withdrawnAt, Kind: storage.StatementWithdrawal, OrderNumber: "2377225624", Amount: -250.5, Balance: 349.5},
+		},
+		ClosingBalance: 349.5,
+	}
+
+	tests := []struct {
+		name           string
+		target         string
+		accept         string
+		prepare        func(orderStg *mock_storage.MockOrderStorage)
+		wantStatusCode int
+		wantResp       *statementResp
+		wantCSV        string
+		wantProblem    string
+	}{
+		{
+			name:   "json",
+			target: "/api/user/balance/statement?from=2022-05-01&to=2022-05-31",
+			prepare: func(orderStg *mock_storage.MockOrderStorage) {
+				orderStg.EXPECT().GetStatement(gomock.Any(), "testUserID", &from, &to).Return(statement, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantResp: &statementResp{
+				From:           &from,
+				To:             &to,
+				OpeningBalance: 100,
+				ClosingBalance: 349.5,
+				Lines: []statementLineResp{
+					{Date: accruedAt, Type: "accrual", Order: "9278923470", Amount: 500, Balance: 600},
+					{Date: withdrawnAt, Type: "withdrawal", Order: "2377225624", Amount: -250.5, Balance: 349.5},
+				},
+			},
+		},
+		{
+			name:   "open period",
+			target: "/api/user/balance/statement",
+			prepare: func(orderStg *mock_storage.MockOrderStorage) {
+				orderStg.EXPECT().GetStatement(gomock.Any(), "testUserID", nil, nil).Return(&storage.Statement{}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantResp:       &statementResp{Lines: []statementLineResp{}},
+		},
+		{
+			name:   "csv by accept header",
+			target: "/api/user/balance/statement?from=2022-05-01T00:00:00Z&to=2022-06-01T00:00:00Z",
+			accept: "text/csv",
+			prepare: func(orderStg *mock_storage.MockOrderStorage) {
+				orderStg.EXPECT().GetStatement(gomock.Any(), "testUserID", &from, &to).Return(statement, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantCSV: "date,type,order,amount,balance\n" +
+				"2022-05-01T00:00:00Z,opening_balance,,,100.00\n" +
+				"2022-05-03T12:00:00Z,accrual,9278923470,500.00,600.00\n" +
+				"2022-05-10T09:30:00Z,withdrawal,2377225624,-250.50,349.50\n" +
+				"2022-06-01T00:00:00Z,closing_balance,,,349.50\n",
+		},
+		{
+			name:   "csv by format",
+			target: "/api/user/balance/statement?format=csv",
+			prepare: func(orderStg *mock_storage.MockOrderStorage) {
+				orderStg.EXPECT().GetStatement(gomock.Any(), "testUserID", nil, nil).Return(&storage.Statement{OpeningBalance: 0, ClosingBalance: 0}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantCSV:        "date,type,order,amount,balance\n,opening_balance,,,0.00\n,closing_balance,,,0.00\n",
+		},
+		{
+			name:   "csv keeps large balances to the cent",
+			target: "/api/user/balance/statement?format=csv",
+			prepare: func(orderStg *mock_storage.MockOrderStorage) {
+				orderStg.EXPECT().GetStatement(gomock.Any(), "testUserID", nil, nil).Return(&storage.Statement{
+					OpeningBalance: 16777216.01,
+					Lines: []storage.StatementLine{
+						{At: accruedAt, Kind: storage.StatementAccrual, OrderNumber: "9278923470", Amount: 0.01, Balance: 16777216.02},
+					},
+					ClosingBalance: 16777216.02,
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantCSV: "date,type,order,amount,balance\n" +
+				",opening_balance,,,16777216.01\n" +
+				"2022-05-03T12:00:00Z,accrual,9278923470,0.01,16777216.02\n" +
+				",closing_balance,,,16777216.02\n",
+		},
+		{
+			name:           "bad date",
+			target:         "/api/user/balance/statement?from=01.05.2022",
+			prepare:        func(orderStg *mock_storage.MockOrderStorage) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "validation_failed",
+		},
+		{
+			name:           "empty period",
+			target:         "/api/user/balance/statement?from=2022-06-01&to=2022-05-01",
+			prepare:        func(orderStg *mock_storage.MockOrderStorage) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "validation_failed",
+		},
+		{
+			name:           "unknown format",
+			target:         "/api/user/balance/statement?format=xml",
+			prepare:        func(orderStg *mock_storage.MockOrderStorage) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "validation_failed",
+		},
+		{
+			name:   "storage error",
+			target: "/api/user/balance/statement",
+			prepare: func(orderStg *mock_storage.MockOrderStorage) {
+				orderStg.EXPECT().GetStatement(gomock.Any(), "testUserID", nil, nil).Return(nil, errors.New("some error"))
+			},
+			wantStatusCode: http.StatusInternalServerError,
+			wantProblem:    "internal_error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderStg := mock_storage.NewMockOrderStorage(ctrl)
+			tt.prepare(orderStg)
+			h := NewHandler(orderStg, historyStg, auth)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			req = withPrincipal(req, "testUserID")
+
+			http.HandlerFunc(h.GetStatementHandler).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			switch {
+			case tt.wantProblem != "":
+				requireProblem(t, result, body, tt.wantProblem)
+			case tt.wantCSV != "":
+				require.Equal(t, "text/csv; charset=utf-8", result.Header.Get("Content-Type"))
+				require.Equal(t, tt.wantCSV, string(body))
+			default:
+				resp := statementResp{}
+				require.NoError(t, json.Unmarshal(body, &resp))
+				require.Equal(t, *tt.wantResp, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"github.com/spf13/viper"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultTransferMaxSum        = 1000
+	defaultTransferDailyLimit    = 5000
+	defaultTransferMinAccountAge = 7 * 24 * time.Hour
+)
+
+type transferReq struct {
+	Recipient string  `json:"recipient"`
+	Sum       float64 `json:"sum"`
+}
+
+type transferResp struct {
+	ID        string    `json:"id"`
+	Recipient string    `json:"recipient"`
+	Sum       float64   `json:"sum"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type adminTransferResp struct {
+	ID             string    `json:"id"`
+	SenderID       string    `json:"sender_id"`
+	SenderLogin    string    `json:"sender_login"`
+	RecipientID    string    `json:"recipient_id"`
+	RecipientLogin string    `json:"recipient_login"`
+	Sum            float64   `json:"sum"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func transferMaxSum() float64 {
+	if limit := viper.GetFloat64("TRANSFER_MAX_SUM"); limit > 0 {
+		return limit
+	}
+	return defaultTransferMaxSum
+}
+
+func transferLimits() storage.TransferLimits {
+	limits := storage.TransferLimits{
+		Daily:         defaultTransferDailyLimit,
+		MinAccountAge: defaultTransferMinAccountAge,
+	}
+	if limit := viper.GetFloat64("TRANSFER_DAILY_LIMIT"); limit > 0 {
+		limits.Daily = limit
+	}
+	if age := viper.GetDuration("TRANSFER_MIN_ACCOUNT_AGE"); age > 0 {
+		limits.MinAccountAge = age
+	}
+	return limits
+}
+
+// TransferHandler moves points to another user named by login. The limits
+// are TRANSFER_MAX_SUM per transfer, TRANSFER_DAILY_LIMIT per sender and day,
+// and the sender must be registered for TRANSFER_MIN_ACCOUNT_AGE.
+func (h *handler) TransferHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	req := transferReq{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		problem.Write(w, r, problem.MalformedRequest, "body must be a JSON object with recipient and sum")
+		return
+	}
+
+	login := validation.NormalizeLogin(req.Recipient)
+	errs := requiredField("recipient", login)
+	if req.Sum <= 0 {
+		errs = append(errs, validation.FieldError{Field: "sum", Code: "invalid", Message: "sum must be positive"})
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	if maxSum := transferMaxSum(); req.Sum > maxSum {
+		problem.Write(w, r, problem.TransferLimitExceeded, fmt.Sprintf("at most %g points can be transferred at once", maxSum))
+		return
+	}
+
+	recipient, err := h.auth.GetUserByLogin(encryption.New().EncodeData(login))
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	if recipient == nil {
+		problem.Write(w, r, problem.RecipientNotFound, "")
+		return
+	}
+
+	limits := transferLimits()
+	transfer, err := h.orderStg.TransferPoints(r.Context(), principal.UserID, recipient.ID, req.Sum, limits)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrRecipientNotFound):
+			problem.Write(w, r, problem.RecipientNotFound, "")
+		case errors.Is(err, storage.ErrSelfTransfer):
+			writeValidationErrors(w, r, validation.Errors{{Field: "recipient", Code: "invalid", Message: "points can not be transferred to oneself"}})
+		case errors.Is(err, storage.ErrInsufficientFunds):
+			problem.Write(w, r, problem.InsufficientFunds, "")
+		case errors.Is(err, storage.ErrDailyTransferLimit):
+			problem.Write(w, r, problem.DailyTransferLimit, fmt.Sprintf("at most %g points can be transferred a day", limits.Daily))
+		case errors.Is(err, storage.ErrAccountTooNew):
+			problem.Write(w, r, problem.AccountTooNew, "transfers are allowed "+limits.MinAccountAge.String()+" after registration")
+		default:
+			problem.WriteError(w, r, err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, transferResp{
+		ID:        transfer.ID,
+		Recipient: login,
+		Sum:       transfer.Sum,
+		CreatedAt: transfer.CreatedAt,
+	})
+}
+
+// AdminListTransfersHandler lists the transfers of the user_id given in the
+// query, or the latest transfers of everybody, for fraud review.
+func (h *handler) AdminListTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	transfers, err := h.orderStg.ListTransfers(r.Context(), r.URL.Query().Get("user_id"))
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	e := encryption.New()
+	decode := func(login string) string {
+		if decoded, err := e.DecodeData(login); err == nil {
+			return decoded
+		}
+		return login
+	}
+
+	resp := []adminTransferResp{}
+	for _, t := range transfers {
+		resp = append(resp, adminTransferResp{
+			ID:             t.ID,
+			SenderID:       t.SenderID,
+			SenderLogin:    decode(t.SenderLogin),
+			RecipientID:    t.RecipientID,
+			RecipientLogin: decode(t.RecipientLogin),
+			Sum:            t.Sum,
+			CreatedAt:      t.CreatedAt,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_handler_TransferHandler(t *testing.T) {
+	withTestEncryptionKey(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	recipient := &authentication.User{ID: "42", Login: encryption.New().EncodeData("alice1")}
+
+	findRecipient := func(auth *mock_authentication.MockAuth) {
+		auth.EXPECT().GetUserByLogin(encryption.New().EncodeData("alice1")).Return(recipient, nil)
+	}
+	transferPoints := func(transfer *storage.Transfer, err error) func(*mock_storage.MockOrderStorage) {
+		return func(orderStg *mock_storage.MockOrderStorage) {
+			orderStg.EXPECT().TransferPoints(gomock.Any(), "testUserID", "42", float64(100), transferLimits()).Return(transfer, err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		prepareAuth    func(auth *mock_authentication.MockAuth)
+		prepareStg     func(orderStg *mock_storage.MockOrderStorage)
+		wantStatusCode int
+		wantSum        float64
+		wantProblem    string
+	}{
+		{
+			name:        "ok",
+			body:        `{"recipient":" Alice1 ","sum":100}`,
+			prepareAuth: findRecipient,
+			prepareStg: transferPoints(&storage.Transfer{
+				ID: "7", SenderID: "testUserID", RecipientID: "42", Sum: 100, CreatedAt: createdAt,
+			}, nil),
+			wantStatusCode: http.StatusOK,
+			wantSum:        100,
+		},
+		{
+			name:        "fractional sum keeps its precision",
+			body:        `{"recipient":"alice1","sum":999.99}`,
+			prepareAuth: findRecipient,
+			prepareStg: func(orderStg *mock_storage.MockOrderStorage) {
+				orderStg.EXPECT().TransferPoints(gomock.Any(), "testUserID", "42", 999.99, transferLimits()).Return(&storage.Transfer{
+					ID: "7", SenderID: "testUserID", RecipientID: "42", Sum: 999.99, CreatedAt: createdAt,
+				}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantSum:        999.99,
+		},
+		{
+			name:           "malformed body",
+			body:           `{"recipient":`,
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "malformed_request",
+		},
+		{
+			name:           "missing recipient and negative sum",
+			body:           `{"sum":-5}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "validation_failed",
+		},
+		{
+			name:           "over the per-transfer limit",
+			body:           `{"recipient":"alice1","sum":1000.5}`,
+			wantStatusCode: http.StatusUnprocessableEntity,
+			wantProblem:    "transfer_limit_exceeded",
+		},
+		{
+			name: "unknown recipient",
+			body: `{"recipient":"alice1","sum":100}`,
+			prepareAuth: func(auth *mock_authentication.MockAuth) {
+				auth.EXPECT().GetUserByLogin(gomock.Any()).Return(nil, nil)
+			},
+			wantStatusCode: http.StatusNotFound,
+			wantProblem:    "recipient_not_found",
+		},
+		{
+			name:           "deleted recipient",
+			body:           `{"recipient":"alice1","sum":100}`,
+			prepareAuth:    findRecipient,
+			prepareStg:     transferPoints(nil, storage.ErrRecipientNotFound),
+			wantStatusCode: http.StatusNotFound,
+			wantProblem:    "recipient_not_found",
+		},
+		{
+			name:           "to oneself",
+			body:           `{"recipient":"alice1","sum":100}`,
+			prepareAuth:    findRecipient,
+			prepareStg:     transferPoints(nil, storage.ErrSelfTransfer),
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "validation_failed",
+		},
+		{
+			name:           "not enough points",
+			body:           `{"recipient":"alice1","sum":100}`,
+			prepareAuth:    findRecipient,
+			prepareStg:     transferPoints(nil, storage.ErrInsufficientFunds),
+			wantStatusCode: http.StatusPaymentRequired,
+			wantProblem:    "insufficient_funds",
+		},
+		{
+			name:           "daily limit",
+			body:           `{"recipient":"alice1","sum":100}`,
+			prepareAuth:    findRecipient,
+			prepareStg:     transferPoints(nil, storage.ErrDailyTransferLimit),
+			wantStatusCode: http.StatusUnprocessableEntity,
+			wantProblem:    "daily_transfer_limit_exceeded",
+		},
+		{
+			name:           "new account",
+			body:           `{"recipient":"alice1","sum":100}`,
+			prepareAuth:    findRecipient,
+			prepareStg:     transferPoints(nil, storage.ErrAccountTooNew),
+			wantStatusCode: http.StatusForbidden,
+			wantProblem:    "account_too_new",
+		},
+		{
+			name:           "storage error",
+			body:           `{"recipient":"alice1","sum":100}`,
+			prepareAuth:    findRecipient,
+			prepareStg:     transferPoints(nil, errors.New("some error")),
+			wantStatusCode: http.StatusInternalServerError,
+			wantProblem:    "internal_error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderStg := mock_storage.NewMockOrderStorage(ctrl)
+			auth := mock_authentication.NewMockAuth(ctrl)
+			if tt.prepareAuth != nil {
+				tt.prepareAuth(auth)
+			}
+			if tt.prepareStg != nil {
+				tt.prepareStg(orderStg)
+			}
+			h := NewHandler(orderStg, mock_storage.NewMockHistoryStorage(ctrl), auth)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/transfer", strings.NewReader(tt.body))
+			req = withPrincipal(req, "testUserID")
+
+			http.HandlerFunc(h.TransferHandler).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			if tt.wantProblem != "" {
+				requireProblem(t, result, body, tt.wantProblem)
+				return
+			}
+
+			resp := transferResp{}
+			require.NoError(t, json.Unmarshal(body, &resp))
+			require.Equal(t, transferResp{ID: "7", Recipient: "alice1", Sum: tt.wantSum, CreatedAt: createdAt}, resp)
+		})
+	}
+}
+
+func Test_handler_AdminListTransfersHandler(t *testing.T) {
+	withTestEncryptionKey(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	h := NewHandler(orderStg, mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	e := encryption.New()
+
+	orderStg.EXPECT().ListTransfers(gomock.Any(), "42").Return([]storage.Transfer{{
+		ID:             "7",
+		SenderID:       "41",
+		SenderLogin:    e.EncodeData("bobbob"),
+		RecipientID:    "42",
+		RecipientLogin: e.EncodeData("alice1"),
+		Sum:            100,
+		CreatedAt:      createdAt,
+	}}, nil)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/transfers?user_id=42", nil)
+
+	http.HandlerFunc(h.AdminListTransfersHandler).ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+
+	var resp []adminTransferResp
+	require.NoError(t, json.Unmarshal(body, &resp))
+	require.Equal(t, []adminTransferResp{{
+		ID:             "7",
+		SenderID:       "41",
+		SenderLogin:    "bobbob",
+		RecipientID:    "42",
+		RecipientLogin: "alice1",
+		Sum:            100,
+		CreatedAt:      createdAt,
+	}}, resp)
+}
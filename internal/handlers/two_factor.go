@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/totp"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"github.com/spf13/viper"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const defaultTOTPIssuer = "Gophermart"
+
+type twoFactorEnrollResp struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type twoFactorCodeReq struct {
+	Code string `json:"code"`
+}
+
+type twoFactorConfirmResp struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type loginChallengeResp struct {
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type loginTwoFactorReq struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// startLoginChallenge answers a successful password check of a user with
+// two-factor authentication: instead of a session, the client gets a
+// challenge to complete at /api/user/login/2fa.
+func (h *handler) startLoginChallenge(w http.ResponseWriter, r *http.Request, userID string, token string) {
+	e := encryption.New()
+
+	random, err := e.GenerateRandom(16)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	challenge := hex.EncodeToString(random)
+	ttl := authentication.LoginChallengeTTL()
+
+	err = h.auth.CreateLoginChallenge(userID, authentication.HashToken(challenge), token, ttl)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, loginChallengeResp{
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	})
+}
+
+func (h *handler) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	e := encryption.New()
+
+	encSecret, err := e.EncryptData([]byte(secret))
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	err = h.auth.EnrollTOTP(principal.UserID, encSecret)
+	if err != nil {
+		if errors.Is(err, authentication.ErrTwoFactorEnabled) {
+			problem.Write(w, r, problem.TwoFactorEnabled, "")
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	issuer := viper.GetString("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	account, err := e.DecodeData(principal.Login)
+	if err != nil {
+		account = principal.UserID
+	}
+
+	writeJSON(w, http.StatusOK, twoFactorEnrollResp{
+		Secret: secret,
+		URI:    totp.URI(issuer, account, secret),
+	})
+}
+
+func (h *handler) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	req := twoFactorCodeReq{}
+	errs := decodeStrict(body, &req)
+	if len(errs) == 0 {
+		errs = requiredField("code", req.Code)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	encSecret, enabled, err := h.auth.GetTOTP(principal.UserID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	if enabled {
+		problem.Write(w, r, problem.TwoFactorEnabled, "")
+		return
+	}
+	if encSecret == "" {
+		problem.Write(w, r, problem.TwoFactorNotEnrolled, "")
+		return
+	}
+
+	secret, err := encryption.New().DecryptData(encSecret)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	counter, ok := totp.Match(string(secret), req.Code, time.Now())
+	if !ok {
+		writeValidationErrors(w, r, validation.Errors{{Field: "code", Code: "invalid", Message: "code is invalid or expired"}})
+		return
+	}
+
+	codes, hashes, err := authentication.NewRecoveryCodes()
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	err = h.auth.ConfirmTOTP(principal.UserID, counter, hashes)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, twoFactorConfirmResp{RecoveryCodes: codes})
+}
+
+func (h *handler) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := r.Cookie("session_token")
+	if err != nil {
+		problem.Write(w, r, problem.MalformedRequest, "session cookie is missing")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	req := loginTwoFactorReq{}
+	errs := decodeStrict(body, &req)
+	if len(errs) == 0 {
+		errs = append(requiredField("challenge", req.Challenge), requiredField("code", req.Code)...)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	challengeHash := authentication.HashToken(req.Challenge)
+
+	userID, err := h.auth.AttemptLoginChallenge(challengeHash, token.Value)
+	if err != nil {
+		if errors.Is(err, authentication.ErrInvalidChallenge) {
+			problem.Write(w, r, problem.InvalidChallenge, "")
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	valid, err := authentication.VerifySecondFactor(h.auth, userID, req.Code)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	if !valid {
+		problem.Write(w, r, problem.InvalidSecondFactor, "")
+		return
+	}
+
+	newToken, err := authentication.NewSessionToken()
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	err = h.auth.CompleteLoginChallenge(challengeHash, newToken)
+	if err != nil {
+		if errors.Is(err, authentication.ErrInvalidChallenge) {
+			problem.Write(w, r, problem.InvalidChallenge, "")
+			return
+		}
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	setSessionCookie(w, newToken)
+
+	w.WriteHeader(http.StatusOK)
+}
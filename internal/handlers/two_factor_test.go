@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/totp"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withTestEncryptionKey(t *testing.T) {
+	viper.Set("ENCRYPTION_KEY", "test:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	t.Cleanup(viper.Reset)
+}
+
+func Test_handler_EnrollAndConfirmTwoFactor(t *testing.T) {
+	withTestEncryptionKey(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+	auth := mock_authentication.NewMockAuth(ctrl)
+
+	h := NewHandler(orderStg, historyStg, auth)
+
+	var storedSecret string
+	auth.EXPECT().EnrollTOTP("testUserID", gomock.Any()).DoAndReturn(func(userID string, encSecret string) error {
+		storedSecret = encSecret
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	req := withPrincipal(httptest.NewRequest(http.MethodPost, "/api/user/2fa/enroll", nil), "testUserID")
+
+	http.HandlerFunc(h.EnrollTwoFactorHandler).ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+
+	enrollResp := twoFactorEnrollResp{}
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&enrollResp))
+	require.NoError(t, result.Body.Close())
+	require.True(t, strings.HasPrefix(enrollResp.URI, "otpauth://totp/"))
+	require.NotContains(t, storedSecret, enrollResp.Secret)
+
+	decrypted, err := encryption.New().DecryptData(storedSecret)
+	require.NoError(t, err)
+	require.Equal(t, enrollResp.Secret, string(decrypted))
+
+	code, err := totp.Code(enrollResp.Secret, time.Now())
+	require.NoError(t, err)
+
+	auth.EXPECT().GetTOTP("testUserID").Return(storedSecret, false, nil).Times(2)
+	auth.EXPECT().ConfirmTOTP("testUserID", gomock.Any(), gomock.Len(10)).Return(nil)
+
+	wrongCode := "000000"
+	if code == wrongCode {
+		wrongCode = "000001"
+	}
+
+	for _, step := range []struct {
+		code           string
+		wantStatusCode int
+	}{
+		{code: wrongCode, wantStatusCode: http.StatusBadRequest},
+		{code: code, wantStatusCode: http.StatusOK},
+	} {
+		rec = httptest.NewRecorder()
+		req = withPrincipal(httptest.NewRequest(http.MethodPost, "/api/user/2fa/confirm", strings.NewReader(`{"code": "`+step.code+`"}`)), "testUserID")
+
+		http.HandlerFunc(h.ConfirmTwoFactorHandler).ServeHTTP(rec, req)
+
+		result = rec.Result()
+		require.Equal(t, step.wantStatusCode, result.StatusCode)
+
+		if step.wantStatusCode == http.StatusOK {
+			confirmResp := twoFactorConfirmResp{}
+			require.NoError(t, json.NewDecoder(result.Body).Decode(&confirmResp))
+			require.Len(t, confirmResp.RecoveryCodes, 10)
+		}
+		require.NoError(t, result.Body.Close())
+	}
+}
+
+func Test_handler_LoginTwoFactorHandler(t *testing.T) {
+	withTestEncryptionKey(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	encSecret, err := encryption.New().EncryptData([]byte(secret))
+	require.NoError(t, err)
+	now := time.Now()
+	code, err := totp.Code(secret, now)
+	require.NoError(t, err)
+
+	challengeHash := authentication.HashToken("testChallenge")
+
+	tests := []struct {
+		name           string
+		code           string
+		auth           func() *mock_authentication.MockAuth
+		wantStatusCode int
+	}{
+		{
+			name: "totp code",
+			code: code,
+			auth: func() *mock_authentication.MockAuth {
+				auth := mock_authentication.NewMockAuth(ctrl)
+				auth.EXPECT().AttemptLoginChallenge(challengeHash, "testToken").Return("7", nil)
+				auth.EXPECT().GetTOTP("7").Return(encSecret, true, nil)
+				auth.EXPECT().AcceptTOTPCounter("7", now.Unix()/30).Return(true, nil)
+				auth.EXPECT().CompleteLoginChallenge(challengeHash, gomock.Any()).Return(nil)
+				return auth
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "replayed totp code",
+			code: code,
+			auth: func() *mock_authentication.MockAuth {
+				auth := mock_authentication.NewMockAuth(ctrl)
+				auth.EXPECT().AttemptLoginChallenge(challengeHash, "testToken").Return("7", nil)
+				auth.EXPECT().GetTOTP("7").Return(encSecret, true, nil)
+				auth.EXPECT().AcceptTOTPCounter("7", gomock.Any()).Return(false, nil)
+				return auth
+			},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "recovery code",
+			code: "ABCDE-12345",
+			auth: func() *mock_authentication.MockAuth {
+				auth := mock_authentication.NewMockAuth(ctrl)
+				auth.EXPECT().AttemptLoginChallenge(challengeHash, "testToken").Return("7", nil)
+				auth.EXPECT().GetTOTP("7").Return(encSecret, true, nil)
+				auth.EXPECT().UseRecoveryCode("7", authentication.HashRecoveryCode("abcde12345")).Return(true, nil)
+				auth.EXPECT().CompleteLoginChallenge(challengeHash, gomock.Any()).Return(nil)
+				return auth
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "wrong code",
+			code: "ABCDE-12345",
+			auth: func() *mock_authentication.MockAuth {
+				auth := mock_authentication.NewMockAuth(ctrl)
+				auth.EXPECT().AttemptLoginChallenge(challengeHash, "testToken").Return("7", nil)
+				auth.EXPECT().GetTOTP("7").Return(encSecret, true, nil)
+				auth.EXPECT().UseRecoveryCode("7", gomock.Any()).Return(false, nil)
+				return auth
+			},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(orderStg, historyStg, tt.auth())
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/login/2fa", strings.NewReader(`{"challenge": "testChallenge", "code": "`+tt.code+`"}`))
+			req.AddCookie(&http.Cookie{
+				Name:  "session_token",
+				Value: "testToken",
+			})
+
+			http.HandlerFunc(h.LoginTwoFactorHandler).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+
+			err := result.Body.Close()
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+)
+
+// The /api/v2 handlers share the storage calls and checks of v1 but fix its
+// contract: bodies are JSON both ways, lists are empty arrays instead of
+// 204 and amounts are integers in minor units, hundredths of a point.
+
+type orderV2Req struct {
+	Number string `json:"number"`
+}
+
+type withdrawV2Req struct {
+	Order string `json:"order"`
+	Sum   int64  `json:"sum"`
+}
+
+type orderV2Resp struct {
+	Number     string    `json:"number"`
+	Status     string    `json:"status"`
+	Accrual    int64     `json:"accrual"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type balanceV2Resp struct {
+	Current   int64 `json:"current"`
+	Withdrawn int64 `json:"withdrawn"`
+}
+
+type withdrawalV2Resp struct {
+	ID          string     `json:"id"`
+	Order       string     `json:"order"`
+	Sum         int64      `json:"sum"`
+	ProcessedAt time.Time  `json:"processed_at"`
+	ReversedAt  *time.Time `json:"reversed_at,omitempty"`
+}
+
+func toMinorUnits(points float32) int64 {
+	return int64(math.Round(float64(points) * 100))
+}
+
+// fromMinorUnits keeps the precision of float64, which the withdrawal
+// path uses down to the database: float32 would turn 12345 into 123.44999.
+func fromMinorUnits(amount int64) float64 {
+	return float64(amount) / 100
+}
+
+func newOrderV2Resp(o storage.Order) orderV2Resp {
+	return orderV2Resp{
+		Number:     o.Number,
+		Status:     o.Status,
+		Accrual:    toMinorUnits(o.Accrual),
+		UploadedAt: o.UploadedAt,
+	}
+}
+
+func newWithdrawalV2Resp(w storage.Withdrawn) withdrawalV2Resp {
+	return withdrawalV2Resp{
+		ID:          w.ID,
+		Order:       w.OrderNumber,
+		Sum:         toMinorUnits(w.Sum),
+		ProcessedAt: w.ProcessedAt,
+		ReversedAt:  w.ReversedAt,
+	}
+}
+
+// SendOrderV2Handler answers with the order: 202 when it has just been
+// added, 200 when the user had already uploaded it.
+func (h *handler) SendOrderV2Handler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	req := orderV2Req{}
+	errs := decodeStrict(body, &req)
+	if len(errs) == 0 {
+		errs = requiredField("number", req.Number)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	existed, ok := h.addOrder(w, r, principal.UserID, req.Number)
+	if !ok {
+		return
+	}
+
+	order, err := h.orderStg.GetUserOrder(r.Context(), principal.UserID, req.Number)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	status := http.StatusAccepted
+	if existed {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, newOrderV2Resp(*order))
+}
+
+func (h *handler) GetOrdersV2Handler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+	if h.notModified(w, r, principal.UserID, formatJSON) {
+		return
+	}
+
+	orders, err := h.orderStg.GetUserOrders(r.Context(), principal.UserID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	resp := []orderV2Resp{}
+	for _, o := range orders {
+		resp = append(resp, newOrderV2Resp(o))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) GetBalanceV2Handler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+	if h.notModified(w, r, principal.UserID, formatJSON) {
+		return
+	}
+
+	h.writeBalanceV2(w, r, principal.UserID)
+}
+
+// WithdrawV2Handler answers with the balance after the withdrawal.
+func (h *handler) WithdrawV2Handler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
+		return
+	}
+
+	req := withdrawV2Req{}
+	errs := decodeStrict(body, &req)
+	if len(errs) == 0 {
+		errs = requiredField("order", req.Order)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+
+	if !h.withdraw(w, r, principal.UserID, req.Order, fromMinorUnits(req.Sum)) {
+		return
+	}
+
+	h.writeBalanceV2(w, r, principal.UserID)
+}
+
+func (h *handler) writeBalanceV2(w http.ResponseWriter, r *http.Request, userID string) {
+	balance, withdrawn, err := h.orderStg.GetUserBalanceAndWithdrawn(r.Context(), userID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, balanceV2Resp{
+		Current:   toMinorUnits(balance),
+		Withdrawn: toMinorUnits(withdrawn),
+	})
+}
+
+func (h *handler) GetWithdrawalsHistoryV2Handler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+	if h.notModified(w, r, principal.UserID, formatJSON) {
+		return
+	}
+
+	withdrawals, err := h.historyStg.GetWithdrawalsHistory(r.Context(), principal.UserID)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	resp := []withdrawalV2Resp{}
+	for _, wd := range withdrawals {
+		resp = append(resp, newWithdrawalV2Resp(wd))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// NotFoundV2Handler and MethodNotAllowedV2Handler replace the plain text
+// answers of the router under /api/v2.
+func (h *handler) NotFoundV2Handler(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, problem.NotFound, "")
+}
+
+func (h *handler) MethodNotAllowedV2Handler(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, problem.MethodNotAllowed, "")
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"github.com/golang/mock/gomock"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_minorUnits(t *testing.T) {
+	require.Equal(t, int64(75125), toMinorUnits(751.25))
+	require.Equal(t, int64(10), toMinorUnits(0.1))
+	require.Equal(t, 123.45, fromMinorUnits(12345))
+	// beyond the precision of float32
+	require.Equal(t, 16777216.01, fromMinorUnits(1677721601))
+}
+
+func Test_handler_v2(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uploadedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		handler        func(h Handler) http.HandlerFunc
+		method         string
+		body           string
+		prepare        func(orderStg *mock_storage.MockOrderStorage, historyStg *mock_storage.MockHistoryStorage)
+		wantStatusCode int
+		wantBody       string
+		wantProblem    string
+	}{
+		{
+			name:    "upload order",
+			handler: func(h Handler) http.HandlerFunc { return h.SendOrderV2Handler },
+			method:  http.MethodPost,
+			body:    `{"number":"12345678903"}`,
+			prepare: func(orderStg *mock_storage.MockOrderStorage, _ *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().AddOrderNumber(gomock.Any(), "12345678903", "testUserID").Return(nil)
+				orderStg.EXPECT().GetUserOrder(gomock.Any(), "testUserID", "12345678903").Return(&storage.Order{Number: "12345678903", Status: "NEW", UploadedAt: uploadedAt}, nil)
+			},
+			wantStatusCode: http.StatusAccepted,
+			wantBody:       `{"number":"12345678903","status":"NEW","accrual":0,"uploaded_at":"2022-05-01T10:00:00Z"}`,
+		},
+		{
+			name:    "upload order again",
+			handler: func(h Handler) http.HandlerFunc { return h.SendOrderV2Handler },
+			method:  http.MethodPost,
+			body:    `{"number":"12345678903"}`,
+			prepare: func(orderStg *mock_storage.MockOrderStorage, _ *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().AddOrderNumber(gomock.Any(), "12345678903", "testUserID").Return(storage.ErrOrderExists)
+				orderStg.EXPECT().GetUserOrder(gomock.Any(), "testUserID", "12345678903").Return(&storage.Order{Number: "12345678903", Status: "PROCESSED", Accrual: 500.5, UploadedAt: uploadedAt}, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"number":"12345678903","status":"PROCESSED","accrual":50050,"uploaded_at":"2022-05-01T10:00:00Z"}`,
+		},
+		{
+			name:           "upload order as text",
+			handler:        func(h Handler) http.HandlerFunc { return h.SendOrderV2Handler },
+			method:         http.MethodPost,
+			body:           "12345678903",
+			prepare:        func(*mock_storage.MockOrderStorage, *mock_storage.MockHistoryStorage) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "validation_failed",
+		},
+		{
+			name:    "no orders",
+			handler: func(h Handler) http.HandlerFunc { return h.GetOrdersV2Handler },
+			method:  http.MethodGet,
+			prepare: func(orderStg *mock_storage.MockOrderStorage, _ *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().GetUserDataVersion(gomock.Any(), "testUserID").Return(int64(1), nil)
+				orderStg.EXPECT().GetUserOrders(gomock.Any(), "testUserID").Return(nil, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `[]`,
+		},
+		{
+			name:    "balance",
+			handler: func(h Handler) http.HandlerFunc { return h.GetBalanceV2Handler },
+			method:  http.MethodGet,
+			prepare: func(orderStg *mock_storage.MockOrderStorage, _ *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().GetUserDataVersion(gomock.Any(), "testUserID").Return(int64(1), nil)
+				orderStg.EXPECT().GetUserBalanceAndWithdrawn(gomock.Any(), "testUserID").Return(float32(500.5), float32(42), nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"current":50050,"withdrawn":4200}`,
+		},
+		{
+			name:    "withdraw",
+			handler: func(h Handler) http.HandlerFunc { return h.WithdrawV2Handler },
+			method:  http.MethodPost,
+			body:    `{"order":"2377225624","sum":12345}`,
+			prepare: func(orderStg *mock_storage.MockOrderStorage, historyStg *mock_storage.MockHistoryStorage) {
+				gomock.InOrder(
+					orderStg.EXPECT().Withdraw(gomock.Any(), "testUserID", "2377225624", float64(123.45), gomock.Any()).Return(nil),
+					orderStg.EXPECT().GetUserBalanceAndWithdrawn(gomock.Any(), "testUserID").Return(float32(376.55), float32(123.45), nil),
+				)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `{"current":37655,"withdrawn":12345}`,
+		},
+		{
+			name:           "withdraw fractional sum",
+			handler:        func(h Handler) http.HandlerFunc { return h.WithdrawV2Handler },
+			method:         http.MethodPost,
+			body:           `{"order":"2377225624","sum":123.45}`,
+			prepare:        func(*mock_storage.MockOrderStorage, *mock_storage.MockHistoryStorage) {},
+			wantStatusCode: http.StatusBadRequest,
+			wantProblem:    "validation_failed",
+		},
+		{
+			name:    "no withdrawals",
+			handler: func(h Handler) http.HandlerFunc { return h.GetWithdrawalsHistoryV2Handler },
+			method:  http.MethodGet,
+			prepare: func(orderStg *mock_storage.MockOrderStorage, historyStg *mock_storage.MockHistoryStorage) {
+				orderStg.EXPECT().GetUserDataVersion(gomock.Any(), "testUserID").Return(int64(1), nil)
+				historyStg.EXPECT().GetWithdrawalsHistory(gomock.Any(), "testUserID").Return(nil, nil)
+			},
+			wantStatusCode: http.StatusOK,
+			wantBody:       `[]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderStg := mock_storage.NewMockOrderStorage(ctrl)
+			historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+			tt.prepare(orderStg, historyStg)
+			h := NewHandler(orderStg, historyStg, mock_authentication.NewMockAuth(ctrl))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "/api/v2/user", strings.NewReader(tt.body))
+			req = withPrincipal(req, "testUserID")
+
+			tt.handler(h).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			if tt.wantProblem != "" {
+				requireProblem(t, result, body, tt.wantProblem)
+			} else {
+				require.JSONEq(t, tt.wantBody, string(body))
+			}
+
+			err = result.Body.Close()
+			require.NoError(t, err)
+		})
+	}
+}
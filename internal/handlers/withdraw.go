@@ -2,67 +2,78 @@ package handlers
 
 import (
 	"encoding/json"
-	"github.com/jackc/pgerrcode"
+	"errors"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"github.com/mkarulina/loyalty-system-service.git/internal/withdrawal"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
 type withdrawReq struct {
 	Order string  `json:"order"`
-	Sum   float32 `json:"sum"`
+	Sum   float64 `json:"sum"`
 }
 
 func (h *handler) WithdrawHandler(w http.ResponseWriter, r *http.Request) {
-	token, err := r.Cookie("session_token")
-	if err != nil || token == nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Println("can't read body", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "can't read body", "error", err)
+		problem.Write(w, r, problem.Internal, "")
 		return
 	}
 
 	unmarshalBody := withdrawReq{}
 	if err := json.Unmarshal(body, &unmarshalBody); err != nil {
-		log.Println("can't unmarshal request body", err)
-		w.WriteHeader(http.StatusBadRequest)
+		problem.Write(w, r, problem.MalformedRequest, "body must be a JSON object with order and sum")
 		return
 	}
 
-	balance, withdrawn, err := h.orderStg.GetUserBalanceAndWithdrawn(token.Value)
-	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+	if !h.withdraw(w, r, principal.UserID, unmarshalBody.Order, unmarshalBody.Sum) {
 		return
 	}
 
-	if balance-withdrawn < unmarshalBody.Sum {
-		w.WriteHeader(http.StatusPaymentRequired)
-		w.Write([]byte("insufficient funds to write off"))
-		return
+	w.WriteHeader(http.StatusOK)
+}
+
+// withdraw refuses malformed requests, then withdraws sum points against
+// the order. The usage rules and the balance are checked by the storage in
+// the same transaction as the withdrawal. On failure the problem is
+// written and the result is false.
+func (h *handler) withdraw(w http.ResponseWriter, r *http.Request, userID string, order string, sum float64) bool {
+	rules := withdrawal.RulesFromConfig()
+	if rejection := rules.CheckRequest(order, sum); rejection != nil {
+		writeRejection(w, r, rejection)
+		return false
 	}
 
-	err = h.orderStg.AddOrderNumber(unmarshalBody.Order, token.Value)
+	err := h.orderStg.Withdraw(r.Context(), userID, order, sum, rules)
 	if err != nil {
-		if err.Error() != pgerrcode.UniqueViolation && err.Error() != "duplicate" {
-			log.Println(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		var rejection *withdrawal.Rejection
+		switch {
+		case errors.As(err, &rejection):
+			writeRejection(w, r, rejection)
+		case errors.Is(err, storage.ErrInsufficientFunds):
+			problem.Write(w, r, problem.InsufficientFunds, "")
+		case errors.Is(err, storage.ErrOrderOwnedByAnotherUser):
+			problem.Write(w, r, problem.OrderOfOtherUser, "")
+		default:
+			problem.WriteError(w, r, err)
 		}
+		return false
 	}
 
-	err = h.orderStg.WithdrawUserPoints(token.Value, unmarshalBody.Order, unmarshalBody.Sum)
-	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	return true
+}
 
-	w.WriteHeader(http.StatusOK)
+func writeRejection(w http.ResponseWriter, r *http.Request, rejection *withdrawal.Rejection) {
+	problem.Write(w, r, rejection.Problem(), rejection.Message)
 }
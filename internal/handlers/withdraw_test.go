@@ -2,16 +2,21 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/golang/mock/gomock"
 	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
 	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/withdrawal"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func Test_handler_WithdrawHandler(t *testing.T) {
@@ -21,12 +26,32 @@ func Test_handler_WithdrawHandler(t *testing.T) {
 	historyStg := mock_storage.NewMockHistoryStorage(ctrl)
 	auth := mock_authentication.NewMockAuth(ctrl)
 
+	// applyRules stands in for the storage, which checks the rules it is
+	// given against the usage read in the withdrawal transaction
+	usage := withdrawal.Usage{
+		RegisteredAt:   time.Now().Add(-30 * 24 * time.Hour),
+		WithdrawnToday: 150,
+	}
+	applyRules := func() *mock_storage.MockOrderStorage {
+		orderStg := mock_storage.NewMockOrderStorage(ctrl)
+		orderStg.EXPECT().Withdraw(gomock.Any(), "testUserID", "12345678903", float64(100), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ string, order string, sum float64, rules withdrawal.Rules) error {
+				if rejection := rules.Check(order, sum, usage, time.Now()); rejection != nil {
+					return rejection
+				}
+				return nil
+			})
+		return orderStg
+	}
+
 	tests := []struct {
 		name           string
+		config         map[string]interface{}
 		reqBody        withdrawReq
 		orderStg       func() *mock_storage.MockOrderStorage
 		wantStatusCode int
 		wantResp       []byte
+		wantProblem    string
 	}{
 		{
 			name: "ok",
@@ -34,13 +59,7 @@ func Test_handler_WithdrawHandler(t *testing.T) {
 				Order: "12345678903",
 				Sum:   100,
 			},
-			orderStg: func() *mock_storage.MockOrderStorage {
-				orderStg := mock_storage.NewMockOrderStorage(ctrl)
-				orderStg.EXPECT().GetUserBalanceAndWithdrawn("testToken").Return(float32(500), float32(200), nil)
-				orderStg.EXPECT().AddOrderNumber("12345678903", "testToken").Return(nil)
-				orderStg.EXPECT().WithdrawUserPoints("testToken", "12345678903", float32(100)).Return(nil)
-				return orderStg
-			},
+			orderStg:       applyRules,
 			wantStatusCode: http.StatusOK,
 			wantResp:       []byte{},
 		},
@@ -52,60 +71,94 @@ func Test_handler_WithdrawHandler(t *testing.T) {
 			},
 			orderStg: func() *mock_storage.MockOrderStorage {
 				orderStg := mock_storage.NewMockOrderStorage(ctrl)
-				orderStg.EXPECT().GetUserBalanceAndWithdrawn("testToken").Return(float32(500), float32(500), nil)
+				orderStg.EXPECT().Withdraw(gomock.Any(), "testUserID", "12345678903", float64(100), gomock.Any()).Return(storage.ErrInsufficientFunds)
 				return orderStg
 			},
 			wantStatusCode: http.StatusPaymentRequired,
-			wantResp:       []byte("insufficient funds to write off"),
+			wantProblem:    "insufficient_funds",
 		},
 		{
-			name: "order storage GetUserBalanceAndWithdrawn error",
+			name: "order of another user",
 			reqBody: withdrawReq{
 				Order: "12345678903",
 				Sum:   100,
 			},
 			orderStg: func() *mock_storage.MockOrderStorage {
 				orderStg := mock_storage.NewMockOrderStorage(ctrl)
-				orderStg.EXPECT().GetUserBalanceAndWithdrawn(gomock.Any()).Return(float32(0), float32(0), errors.New("some error"))
+				orderStg.EXPECT().Withdraw(gomock.Any(), "testUserID", "12345678903", float64(100), gomock.Any()).Return(storage.ErrOrderOwnedByAnotherUser)
 				return orderStg
 			},
-			wantStatusCode: http.StatusInternalServerError,
-			wantResp:       []byte{},
+			wantStatusCode: http.StatusConflict,
+			wantProblem:    "order_owned_by_another_user",
 		},
 		{
-			name: "order storage AddOrderNumber error",
+			name: "order fails the Luhn check",
+			reqBody: withdrawReq{
+				Order: "12345678901",
+				Sum:   100,
+			},
+			orderStg:       func() *mock_storage.MockOrderStorage { return mock_storage.NewMockOrderStorage(ctrl) },
+			wantStatusCode: http.StatusUnprocessableEntity,
+			wantProblem:    "invalid_order_number",
+		},
+		{
+			name: "negative sum",
+			reqBody: withdrawReq{
+				Order: "12345678903",
+				Sum:   -100,
+			},
+			orderStg:       func() *mock_storage.MockOrderStorage { return mock_storage.NewMockOrderStorage(ctrl) },
+			wantStatusCode: http.StatusUnprocessableEntity,
+			wantProblem:    "invalid_withdrawal_sum",
+		},
+		{
+			name: "daily limit",
+			config: map[string]interface{}{
+				"WITHDRAWAL_DAILY_LIMIT": 200,
+			},
 			reqBody: withdrawReq{
 				Order: "12345678903",
 				Sum:   100,
 			},
-			orderStg: func() *mock_storage.MockOrderStorage {
-				orderStg := mock_storage.NewMockOrderStorage(ctrl)
-				orderStg.EXPECT().GetUserBalanceAndWithdrawn("testToken").Return(float32(500), float32(200), nil)
-				orderStg.EXPECT().AddOrderNumber("12345678903", "testToken").Return(errors.New("some error"))
-				return orderStg
+			orderStg:       applyRules,
+			wantStatusCode: http.StatusUnprocessableEntity,
+			wantProblem:    "daily_withdrawal_limit_exceeded",
+		},
+		{
+			name: "cooling-off",
+			config: map[string]interface{}{
+				"WITHDRAWAL_COOLING_OFF": "720h1m",
 			},
-			wantStatusCode: http.StatusInternalServerError,
-			wantResp:       []byte{},
+			reqBody: withdrawReq{
+				Order: "12345678903",
+				Sum:   100,
+			},
+			orderStg:       applyRules,
+			wantStatusCode: http.StatusForbidden,
+			wantProblem:    "withdrawal_cooling_off",
 		},
 		{
-			name: "order storage WithdrawUserPoints error",
+			name: "order storage Withdraw error",
 			reqBody: withdrawReq{
 				Order: "12345678903",
 				Sum:   100,
 			},
 			orderStg: func() *mock_storage.MockOrderStorage {
 				orderStg := mock_storage.NewMockOrderStorage(ctrl)
-				orderStg.EXPECT().GetUserBalanceAndWithdrawn("testToken").Return(float32(500), float32(200), nil)
-				orderStg.EXPECT().AddOrderNumber("12345678903", "testToken").Return(nil)
-				orderStg.EXPECT().WithdrawUserPoints("testToken", "12345678903", float32(100)).Return(errors.New("some error"))
+				orderStg.EXPECT().Withdraw(gomock.Any(), "testUserID", "12345678903", float64(100), gomock.Any()).Return(errors.New("some error"))
 				return orderStg
 			},
 			wantStatusCode: http.StatusInternalServerError,
-			wantResp:       []byte{},
+			wantProblem:    "internal_error",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.config {
+				viper.Set(k, v)
+			}
+			t.Cleanup(viper.Reset)
+
 			orderStg := tt.orderStg()
 			h := NewHandler(orderStg, historyStg, auth)
 
@@ -115,10 +168,7 @@ func Test_handler_WithdrawHandler(t *testing.T) {
 
 			rec := httptest.NewRecorder()
 			req := httptest.NewRequest(http.MethodPost, "/user/balance/withdraw", r)
-			req.AddCookie(&http.Cookie{
-				Name:  "session_token",
-				Value: "testToken",
-			})
+			req = withPrincipal(req, "testUserID")
 
 			handler := http.HandlerFunc(h.WithdrawHandler)
 			handler.ServeHTTP(rec, req)
@@ -128,7 +178,11 @@ func Test_handler_WithdrawHandler(t *testing.T) {
 
 			body, err := io.ReadAll(result.Body)
 			require.NoError(t, err)
-			require.Equal(t, tt.wantResp, body)
+			if tt.wantProblem != "" {
+				requireProblem(t, result, body, tt.wantProblem)
+			} else {
+				require.Equal(t, tt.wantResp, body)
+			}
 
 			err = result.Body.Close()
 			require.NoError(t, err)
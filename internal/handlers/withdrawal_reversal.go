@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"github.com/spf13/viper"
+	"net/http"
+	"time"
+)
+
+const defaultWithdrawalCancelWindow = 24 * time.Hour
+
+func withdrawalCancelWindow() time.Duration {
+	if window := viper.GetDuration("WITHDRAWAL_CANCEL_WINDOW"); window > 0 {
+		return window
+	}
+	return defaultWithdrawalCancelWindow
+}
+
+// CancelWithdrawalHandler lets the user take back a withdrawal of their own
+// within WITHDRAWAL_CANCEL_WINDOW, e.g. when the shop cancels the order the
+// points were spent on.
+func (h *handler) CancelWithdrawalHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	notBefore := time.Now().Add(-withdrawalCancelWindow())
+	h.reverseWithdrawal(w, r, principal.UserID, principal.UserID, notBefore)
+}
+
+// AdminReverseWithdrawalHandler reverses any withdrawal regardless of its age.
+func (h *handler) AdminReverseWithdrawalHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	h.reverseWithdrawal(w, r, "", principal.UserID, time.Time{})
+}
+
+func (h *handler) reverseWithdrawal(w http.ResponseWriter, r *http.Request, userID string, actor string, notBefore time.Time) {
+	id := chi.URLParam(r, "id")
+	if !validID(id) {
+		problem.Write(w, r, problem.WithdrawalNotFound, "")
+		return
+	}
+
+	withdrawn, err := h.orderStg.ReverseWithdrawal(r.Context(), id, userID, actor, notBefore)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrWithdrawalNotFound):
+			problem.Write(w, r, problem.WithdrawalNotFound, "")
+		case errors.Is(err, storage.ErrWithdrawalReversed):
+			problem.Write(w, r, problem.WithdrawalReversed, "")
+		case errors.Is(err, storage.ErrReversalWindowClosed):
+			problem.Write(w, r, problem.ReversalWindowClosed, "withdrawals can be cancelled within "+withdrawalCancelWindow().String())
+		default:
+			problem.WriteError(w, r, err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newWithdrawalResp(*withdrawn))
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	mock_storage "github.com/mkarulina/loyalty-system-service.git/internal/storage/mocks"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_handler_CancelWithdrawalHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	processedAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	reversedAt := time.Now().UTC().Truncate(time.Second)
+	reversed := &storage.Withdrawn{
+		ID:          "17",
+		UserID:      "testUserID",
+		OrderNumber: "2377225624",
+		Sum:         500,
+		ProcessedAt: processedAt,
+		ReversedAt:  &reversedAt,
+	}
+
+	tests := []struct {
+		name           string
+		stgResp        *storage.Withdrawn
+		stgErr         error
+		wantStatusCode int
+		wantProblem    string
+	}{
+		{
+			name:           "cancelled",
+			stgResp:        reversed,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "unknown withdrawal",
+			stgErr:         storage.ErrWithdrawalNotFound,
+			wantStatusCode: http.StatusNotFound,
+			wantProblem:    "withdrawal_not_found",
+		},
+		{
+			name:           "already reversed",
+			stgErr:         storage.ErrWithdrawalReversed,
+			wantStatusCode: http.StatusConflict,
+			wantProblem:    "withdrawal_already_reversed",
+		},
+		{
+			name:           "window closed",
+			stgErr:         storage.ErrReversalWindowClosed,
+			wantStatusCode: http.StatusConflict,
+			wantProblem:    "reversal_window_closed",
+		},
+		{
+			name:           "storage error",
+			stgErr:         errors.New("some error"),
+			wantStatusCode: http.StatusInternalServerError,
+			wantProblem:    "internal_error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderStg := mock_storage.NewMockOrderStorage(ctrl)
+			h := NewHandler(orderStg, mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+
+			before := time.Now()
+			orderStg.EXPECT().ReverseWithdrawal(gomock.Any(), "17", "testUserID", "testUserID", gomock.Any()).DoAndReturn(
+				func(_ context.Context, _, _, _ string, notBefore time.Time) (*storage.Withdrawn, error) {
+					require.WithinDuration(t, before.Add(-defaultWithdrawalCancelWindow), notBefore, time.Second)
+					return tt.stgResp, tt.stgErr
+				})
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdrawals/17/cancel", nil)
+			req = withURLParams(withPrincipal(req, "testUserID"), map[string]string{"id": "17"})
+
+			http.HandlerFunc(h.CancelWithdrawalHandler).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			if tt.wantProblem != "" {
+				requireProblem(t, result, body, tt.wantProblem)
+				return
+			}
+
+			resp := withdrawalsHistoryResp{}
+			require.NoError(t, json.Unmarshal(body, &resp))
+			require.Equal(t, newWithdrawalResp(*reversed), resp)
+		})
+	}
+}
+
+func Test_handler_CancelWithdrawalHandler_invalidID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h := NewHandler(mock_storage.NewMockOrderStorage(ctrl), mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdrawals/abc/cancel", nil)
+	req = withURLParams(withPrincipal(req, "testUserID"), map[string]string{"id": "abc"})
+
+	http.HandlerFunc(h.CancelWithdrawalHandler).ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusNotFound, result.StatusCode)
+
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+	requireProblem(t, result, body, "withdrawal_not_found")
+}
+
+func Test_handler_AdminReverseWithdrawalHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reversedAt := time.Now().UTC().Truncate(time.Second)
+
+	orderStg := mock_storage.NewMockOrderStorage(ctrl)
+	h := NewHandler(orderStg, mock_storage.NewMockHistoryStorage(ctrl), mock_authentication.NewMockAuth(ctrl))
+
+	// no owner and no window: admins reverse any withdrawal
+	orderStg.EXPECT().ReverseWithdrawal(gomock.Any(), "17", "", "adminID", time.Time{}).Return(&storage.Withdrawn{
+		ID:          "17",
+		UserID:      "testUserID",
+		OrderNumber: "2377225624",
+		Sum:         500,
+		ReversedAt:  &reversedAt,
+	}, nil)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/withdrawals/17/reverse", nil)
+	req = withURLParams(withPrincipal(req, "adminID"), map[string]string{"id": "17"})
+
+	http.HandlerFunc(h.AdminReverseWithdrawalHandler).ServeHTTP(rec, req)
+
+	result := rec.Result()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+
+	resp := withdrawalsHistoryResp{}
+	require.NoError(t, json.Unmarshal(body, &resp))
+	require.Equal(t, "17", resp.ID)
+	require.NotNil(t, resp.ReversedAt)
+}
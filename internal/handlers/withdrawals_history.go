@@ -2,31 +2,58 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 type withdrawalsHistoryResp struct {
-	Order       string    `json:"order"`
-	Sum         float32   `json:"sum"`
-	ProcessedAt time.Time `json:"processed_at"`
+	ID          string     `json:"id"`
+	Order       string     `json:"order"`
+	Sum         float32    `json:"sum"`
+	ProcessedAt time.Time  `json:"processed_at"`
+	ReversedAt  *time.Time `json:"reversed_at,omitempty"`
+}
+
+func newWithdrawalResp(w storage.Withdrawn) withdrawalsHistoryResp {
+	return withdrawalsHistoryResp{
+		ID:          w.ID,
+		Order:       w.OrderNumber,
+		Sum:         w.Sum,
+		ProcessedAt: w.ProcessedAt,
+		ReversedAt:  w.ReversedAt,
+	}
 }
 
 func (h *handler) GetWithdrawalsHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	var resp []withdrawalsHistoryResp
 
-	token, err := r.Cookie("session_token")
-	if err != nil || token == nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusBadRequest)
+	principal, ok := authentication.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, problem.Unauthorized, "")
+		return
+	}
+
+	format, errs := exportFormat(r, formatJSON, formatCSV, formatNDJSON)
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, errs)
+		return
+	}
+	if h.notModified(w, r, principal.UserID, format) {
+		return
+	}
+	if format != formatJSON {
+		h.streamWithdrawals(w, r, principal.UserID, format)
 		return
 	}
 
-	withdrawals, err := h.historyStg.GetWithdrawalsHistory(token.Value)
+	withdrawals, err := h.historyStg.GetWithdrawalsHistory(r.Context(), principal.UserID)
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
 	if len(withdrawals) == 0 {
@@ -35,17 +62,12 @@ func (h *handler) GetWithdrawalsHistoryHandler(w http.ResponseWriter, r *http.Re
 	}
 
 	for _, w := range withdrawals {
-		resp = append(resp, withdrawalsHistoryResp{
-			Order:       w.OrderNumber,
-			Sum:         w.Sum,
-			ProcessedAt: w.ProcessedAt,
-		})
+		resp = append(resp, newWithdrawalResp(w))
 	}
 
 	marshalResp, err := json.Marshal(resp)
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
 		return
 	}
 
@@ -53,3 +75,32 @@ func (h *handler) GetWithdrawalsHistoryHandler(w http.ResponseWriter, r *http.Re
 	w.WriteHeader(http.StatusOK)
 	w.Write(marshalResp)
 }
+
+func (h *handler) streamWithdrawals(w http.ResponseWriter, r *http.Request, userID string, format string) {
+	stream := newRowStream(w, format, []string{"id", "order", "sum", "processed_at", "reversed_at"})
+
+	err := h.historyStg.StreamWithdrawalsHistory(r.Context(), userID, func(wd storage.Withdrawn) error {
+		resp := newWithdrawalResp(wd)
+		reversedAt := ""
+		if resp.ReversedAt != nil {
+			reversedAt = resp.ReversedAt.Format(time.RFC3339)
+		}
+		return stream.Write([]string{
+			resp.ID,
+			resp.Order,
+			strconv.FormatFloat(float64(resp.Sum), 'f', -1, 32),
+			resp.ProcessedAt.Format(time.RFC3339),
+			reversedAt,
+		}, resp)
+	})
+	if err == nil {
+		err = stream.Close()
+	}
+	if err != nil {
+		if !stream.Started() {
+			problem.WriteError(w, r, err)
+			return
+		}
+		slog.WarnContext(r.Context(), "withdrawals export aborted", "error", err)
+	}
+}
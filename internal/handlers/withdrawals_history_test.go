@@ -27,7 +27,9 @@ func Test_handler_GetWithdrawalsHistoryHandler_ok(t *testing.T) {
 
 	h := NewHandler(orderStg, historyStg, auth)
 
-	historyStg.EXPECT().GetWithdrawalsHistory(gomock.Any()).Return([]storage.Withdrawn{
+	orderStg.EXPECT().GetUserDataVersion(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+
+	historyStg.EXPECT().GetWithdrawalsHistory(gomock.Any(), gomock.Any()).Return([]storage.Withdrawn{
 		{
 			UserID:      "1q2w3e4r",
 			OrderNumber: "12345",
@@ -57,10 +59,7 @@ func Test_handler_GetWithdrawalsHistoryHandler_ok(t *testing.T) {
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/user/balance/withdrawals", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "session_token",
-		Value: "testToken",
-	})
+	req = withPrincipal(req, "testUserID")
 
 	handler := http.HandlerFunc(h.GetWithdrawalsHistoryHandler)
 	handler.ServeHTTP(rec, req)
@@ -86,14 +85,13 @@ func Test_handler_GetWithdrawalsHistoryHandler_storageError(t *testing.T) {
 
 	h := NewHandler(orderStg, historyStg, auth)
 
-	historyStg.EXPECT().GetWithdrawalsHistory(gomock.Any()).Return(nil, errors.New("some error"))
+	orderStg.EXPECT().GetUserDataVersion(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+
+	historyStg.EXPECT().GetWithdrawalsHistory(gomock.Any(), gomock.Any()).Return(nil, errors.New("some error"))
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/user/balance/withdrawals", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "session_token",
-		Value: "testToken",
-	})
+	req = withPrincipal(req, "testUserID")
 
 	handler := http.HandlerFunc(h.GetWithdrawalsHistoryHandler)
 	handler.ServeHTTP(rec, req)
@@ -103,7 +101,7 @@ func Test_handler_GetWithdrawalsHistoryHandler_storageError(t *testing.T) {
 
 	body, err := io.ReadAll(result.Body)
 	require.NoError(t, err)
-	require.Empty(t, body)
+	requireProblem(t, result, body, "internal_error")
 
 	err = result.Body.Close()
 	require.NoError(t, err)
@@ -119,14 +117,13 @@ func Test_handler_GetWithdrawalsHistoryHandler_noContent(t *testing.T) {
 
 	h := NewHandler(orderStg, historyStg, auth)
 
-	historyStg.EXPECT().GetWithdrawalsHistory(gomock.Any()).Return([]storage.Withdrawn{}, nil)
+	orderStg.EXPECT().GetUserDataVersion(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+
+	historyStg.EXPECT().GetWithdrawalsHistory(gomock.Any(), gomock.Any()).Return([]storage.Withdrawn{}, nil)
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodGet, "/user/balance/withdrawals", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "session_token",
-		Value: "testToken",
-	})
+	req = withPrincipal(req, "testUserID")
 
 	handler := http.HandlerFunc(h.GetWithdrawalsHistoryHandler)
 	handler.ServeHTTP(rec, req)
@@ -141,3 +138,63 @@ func Test_handler_GetWithdrawalsHistoryHandler_noContent(t *testing.T) {
 	err = result.Body.Close()
 	require.NoError(t, err)
 }
+
+func Test_handler_GetWithdrawalsHistoryHandler_export(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	processedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		target          string
+		accept          string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "csv",
+			target:          "/api/user/balance/withdrawals?format=csv",
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "id,order,sum,processed_at,reversed_at\n17,2377225624,751.25,2022-05-01T10:00:00Z,\n",
+		},
+		{
+			name:            "ndjson",
+			target:          "/api/user/balance/withdrawals",
+			accept:          "application/x-ndjson",
+			wantContentType: "application/x-ndjson",
+			wantBody:        `{"id":"17","order":"2377225624","sum":751.25,"processed_at":"2022-05-01T10:00:00Z"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			historyStg := mock_storage.NewMockHistoryStorage(ctrl)
+			historyStg.EXPECT().StreamWithdrawalsHistory(gomock.Any(), "testUserID", gomock.Any()).DoAndReturn(
+				func(_ interface{}, _ string, fn func(storage.Withdrawn) error) error {
+					return fn(storage.Withdrawn{ID: "17", OrderNumber: "2377225624", Sum: 751.25, ProcessedAt: processedAt})
+				})
+			orderStg := mock_storage.NewMockOrderStorage(ctrl)
+			orderStg.EXPECT().GetUserDataVersion(gomock.Any(), "testUserID").Return(int64(1), nil)
+			h := NewHandler(orderStg, historyStg, mock_authentication.NewMockAuth(ctrl))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			req = withPrincipal(req, "testUserID")
+
+			http.HandlerFunc(h.GetWithdrawalsHistoryHandler).ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, http.StatusOK, result.StatusCode)
+
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			require.Equal(t, tt.wantContentType, result.Header.Get("Content-Type"))
+			require.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
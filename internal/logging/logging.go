@@ -0,0 +1,146 @@
+// Package logging configures the structured slog logger of the service and
+// carries the request information that every log line of a request gets.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/go-chi/chi"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeys are parts of attribute keys whose values never reach the log.
+var secretKeys = []string{"password", "token", "secret", "authorization", "cookie"}
+
+// Setup makes the logger described by LOG_LEVEL (debug, info, warn or
+// error; info by default) and LOG_FORMAT (json or text; json by default)
+// the default one, for the log package as well.
+func Setup() {
+	slog.SetDefault(New(os.Stderr, viper.GetString("LOG_LEVEL"), viper.GetString("LOG_FORMAT")))
+}
+
+// New returns a logger writing to w. Unknown levels and formats fall back to
+// info and json.
+func New(w io.Writer, level string, format string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redact}
+
+	var h slog.Handler
+	if format == "text" {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(contextHandler{Handler: h})
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if IsSecret(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+// IsSecret reports whether values under the key must not be logged.
+func IsSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestInfo identifies the request a log line belongs to. The user is
+// only known once authentication has run, so it is set later on the same
+// value.
+type RequestInfo struct {
+	ID string
+
+	mu     sync.Mutex
+	userID string
+}
+
+type requestInfoKey struct{}
+
+// ContextWithRequest starts the request information of a request.
+func ContextWithRequest(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, &RequestInfo{ID: id})
+}
+
+// RequestFromContext returns the request information, or nil outside of a
+// request.
+func RequestFromContext(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+// SetUserID records the authenticated user of the request in ctx.
+func SetUserID(ctx context.Context, userID string) {
+	if info := RequestFromContext(ctx); info != nil {
+		info.mu.Lock()
+		info.userID = userID
+		info.mu.Unlock()
+	}
+}
+
+func (i *RequestInfo) UserID() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.userID
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// contextHandler adds the request ID, the user ID, the chi route pattern
+// and the trace found in the context of the record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if info := RequestFromContext(ctx); info != nil {
+		r.AddAttrs(slog.String("request_id", info.ID))
+		if userID := info.UserID(); userID != "" {
+			r.AddAttrs(slog.String("user_id", userID))
+		}
+	}
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if route := rctx.RoutePattern(); route != "" {
+			r.AddAttrs(slog.String("route", route))
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
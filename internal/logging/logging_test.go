@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_New_redactsSecrets(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(buf, "info", "json")
+
+	logger.Info("login", "login", "alice", "password", "hunter2", "session_token", "abc", slog.Group("req", "Authorization", "Bearer abc"))
+
+	line := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "alice", line["login"])
+	require.Equal(t, redacted, line["password"])
+	require.Equal(t, redacted, line["session_token"])
+	require.Equal(t, map[string]interface{}{"Authorization": redacted}, line["req"])
+}
+
+func Test_New_level(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(buf, "warn", "text")
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+
+	require.NotContains(t, buf.String(), "hidden")
+	require.Contains(t, buf.String(), "msg=shown")
+}
+
+func Test_contextHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(buf, "info", "json")
+
+	r := chi.NewRouter()
+	r.Get("/api/user/orders/{number}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := ContextWithRequest(r.Context(), "req-1")
+		SetUserID(ctx, "42")
+		logger.ErrorContext(ctx, "internal error")
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/user/orders/79927398713", nil))
+
+	line := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "req-1", line["request_id"])
+	require.Equal(t, "42", line["user_id"])
+	require.Equal(t, "/api/user/orders/{number}", line["route"])
+
+	buf.Reset()
+	logger.InfoContext(context.Background(), "background")
+	line = map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.NotContains(t, line, "request_id")
+	require.NotContains(t, line, "user_id")
+}
+
+func Test_contextHandler_trace(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(buf, "info", "json")
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	logger.InfoContext(ctx, "traced")
+
+	line := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", line["trace_id"])
+	require.Equal(t, "00f067aa0ba902b7", line["span_id"])
+}
@@ -0,0 +1,110 @@
+// Package metrics defines the Prometheus metrics of the service and serves
+// them on a separate listener.
+package metrics
+
+import (
+	"database/sql"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "gophermart"
+
+var (
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by route pattern and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_query_duration_seconds",
+		Help:      "Duration of storage methods, including all their queries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	AccrualPollDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "accrual_poll_duration_seconds",
+		Help:      "Duration of one accrual polling cycle.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	})
+
+	AccrualResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "accrual_responses_total",
+		Help:      `Responses of the accrual system by status code, "error" when the request failed.`,
+	}, []string{"code"})
+
+	Orders = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "orders",
+		Help:      "Orders by status, updated after every accrual polling cycle.",
+	}, []string{"status"})
+
+	PointsAccrued = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_accrued_total",
+		Help:      "Points accrued to users for processed orders.",
+	})
+
+	PointsWithdrawn = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_withdrawn_total",
+		Help:      "Points withdrawn by users, reversals not subtracted.",
+	})
+)
+
+// RegisterDB exports the connection pool statistics of db.
+func RegisterDB(name string, db *sql.DB) {
+	if err := prometheus.Register(collectors.NewDBStatsCollector(db, name)); err != nil {
+		slog.Warn("can't register db stats", "error", err)
+	}
+}
+
+// ObserveQuery starts timing the storage method; call ObserveDuration on
+// the result when it returns.
+func ObserveQuery(method string) *prometheus.Timer {
+	return prometheus.NewTimer(QueryDuration.WithLabelValues(method))
+}
+
+// Middleware records the duration of each request under its chi route
+// pattern, so that path parameters do not multiply the series. Requests
+// that match no route share the "unmatched" pattern.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		HTTPRequestDuration.WithLabelValues(r.Method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ListenAndServe serves /metrics on address.
+func ListenAndServe(address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	slog.Info("metrics listening", "address", address)
+	return http.ListenAndServe(address, mux)
+}
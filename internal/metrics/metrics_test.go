@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// sampleCount returns the number of observations of the series of
+// HTTPRequestDuration with the labels.
+func sampleCount(t *testing.T, labels ...string) uint64 {
+	t.Helper()
+
+	metric := &dto.Metric{}
+	require.NoError(t, HTTPRequestDuration.WithLabelValues(labels...).(prometheus.Histogram).Write(metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Route("/api/", func(r chi.Router) {
+		r.Get("/orders/{number}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+		r.Get("/balance", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("{}"))
+		})
+	})
+
+	tests := []struct {
+		target string
+		labels []string
+	}{
+		{target: "/api/orders/12345678903", labels: []string{http.MethodGet, "/api/orders/{number}", "404"}},
+		{target: "/api/orders/2377225624", labels: []string{http.MethodGet, "/api/orders/{number}", "404"}},
+		{target: "/api/balance", labels: []string{http.MethodGet, "/api/balance", "200"}},
+		{target: "/nothing/here", labels: []string{http.MethodGet, "unmatched", "404"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			before := sampleCount(t, tt.labels...)
+
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			require.Equal(t, before+1, sampleCount(t, tt.labels...))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/mkarulina/loyalty-system-service.git/internal/logging"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	APIKeyHeader       = "X-Api-Key"
+	APITimestampHeader = "X-Api-Timestamp"
+	APISignatureHeader = "X-Api-Signature"
+
+	// maxSignedBodySize limits the body read into memory to check the
+	// signature.
+	maxSignedBodySize = 1 << 20
+)
+
+// APIKeyAuth authenticates partner requests signed with an API key. The
+// customer the partner acts for is taken from the {login} URL parameter and
+// becomes the principal of the request, limited to the scopes of the key.
+// The customer must have granted access to the key, and a signed request
+// is accepted only once.
+func APIKeyAuth(auth authentication.Auth) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keyID := r.Header.Get(APIKeyHeader)
+			timestamp := r.Header.Get(APITimestampHeader)
+			signature := r.Header.Get(APISignatureHeader)
+			if keyID == "" || timestamp == "" || signature == "" {
+				problem.Write(w, r, problem.Unauthorized, "request is not signed")
+				return
+			}
+
+			unix, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				problem.Write(w, r, problem.InvalidSignature, "invalid timestamp")
+				return
+			}
+			signedAt := time.Unix(unix, 0)
+			if skew := time.Since(signedAt); skew > authentication.APIKeyMaxSkew() || -skew > authentication.APIKeyMaxSkew() {
+				problem.Write(w, r, problem.InvalidSignature, "request timestamp is too far from server time")
+				return
+			}
+
+			key, err := auth.GetAPIKey(keyID)
+			if err != nil {
+				problem.WriteError(w, r, err)
+				return
+			}
+			if key == nil || key.RevokedAt != nil {
+				problem.Write(w, r, problem.InvalidSignature, "invalid api key")
+				return
+			}
+
+			secret, err := encryption.New().DecryptData(key.Secret)
+			if err != nil {
+				problem.WriteError(w, r, err)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodySize))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					problem.Write(w, r, problem.BodyTooLarge, "")
+					return
+				}
+				slog.ErrorContext(r.Context(), "can't read body", "error", err)
+				problem.Write(w, r, problem.Internal, "")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			expected := authentication.SignRequest(secret, r.Method, r.URL.RequestURI(), body, timestamp)
+			if !hmac.Equal([]byte(expected), []byte(signature)) {
+				problem.Write(w, r, problem.InvalidSignature, "")
+				return
+			}
+
+			fresh, err := auth.UseAPIKeySignature(key.ID, signature, signedAt.Add(authentication.APIKeyMaxSkew()))
+			if err != nil {
+				problem.WriteError(w, r, err)
+				return
+			}
+			if !fresh {
+				problem.Write(w, r, problem.SignatureReplayed, "")
+				return
+			}
+
+			if err := auth.TrackAPIKeyUsage(key.ID); err != nil {
+				slog.WarnContext(r.Context(), "can't track api key usage", "error", err)
+			}
+
+			login := validation.NormalizeLogin(chi.URLParam(r, "login"))
+			user, err := auth.GetUserByLogin(encryption.New().EncodeData(login))
+			if err != nil {
+				problem.WriteError(w, r, err)
+				return
+			}
+			if user == nil {
+				problem.Write(w, r, problem.UserNotFound, "")
+				return
+			}
+
+			granted, err := auth.HasAPIKeyAccess(key.ID, user.ID)
+			if err != nil {
+				problem.WriteError(w, r, err)
+				return
+			}
+			if !granted {
+				problem.Write(w, r, problem.AccessNotGranted, "")
+				return
+			}
+
+			logging.SetUserID(r.Context(), user.ID)
+			ctx := authentication.ContextWithPrincipal(r.Context(), authentication.Principal{
+				UserID:   user.ID,
+				Login:    user.Login,
+				APIKeyID: key.ID,
+				Scopes:   key.Scopes,
+			})
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScope lets through API key requests whose key has the scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := authentication.PrincipalFromContext(r.Context())
+			if !ok || principal.APIKeyID == "" {
+				problem.Write(w, r, problem.Unauthorized, "request is not signed")
+				return
+			}
+
+			for _, s := range principal.Scopes {
+				if s == scope {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			problem.Write(w, r, problem.MissingScope, "api key has no scope "+scope)
+		})
+	}
+}
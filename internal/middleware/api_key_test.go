@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/go-chi/chi"
+	"github.com/golang/mock/gomock"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	mock_authentication "github.com/mkarulina/loyalty-system-service.git/internal/authentication/mocks"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_APIKeyAuth(t *testing.T) {
+	viper.Set("ENCRYPTION_KEY", "test:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	defer viper.Reset()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	e := encryption.New()
+	secret := []byte("partnerSecret")
+	encSecret, err := e.EncryptData(secret)
+	require.NoError(t, err)
+
+	revokedAt := time.Now()
+	keys := map[string]*authentication.APIKey{
+		"gk_active":  {ID: "gk_active", Secret: encSecret, Scopes: []string{authentication.ScopeOrdersWrite}},
+		"gk_revoked": {ID: "gk_revoked", Secret: encSecret, Scopes: []string{authentication.ScopeOrdersWrite}, RevokedAt: &revokedAt},
+	}
+
+	auth := mock_authentication.NewMockAuth(ctrl)
+	auth.EXPECT().GetAPIKey(gomock.Any()).DoAndReturn(func(id string) (*authentication.APIKey, error) {
+		return keys[id], nil
+	}).AnyTimes()
+	auth.EXPECT().TrackAPIKeyUsage("gk_active").Return(nil).AnyTimes()
+	seen := map[string]bool{}
+	auth.EXPECT().UseAPIKeySignature("gk_active", gomock.Any(), gomock.Any()).DoAndReturn(func(id string, signature string, expiresAt time.Time) (bool, error) {
+		fresh := !seen[signature]
+		seen[signature] = true
+		return fresh, nil
+	}).AnyTimes()
+	auth.EXPECT().GetUserByLogin(e.EncodeData("alice")).Return(&authentication.User{ID: "7"}, nil).AnyTimes()
+	auth.EXPECT().GetUserByLogin(e.EncodeData("bob")).Return(&authentication.User{ID: "8"}, nil).AnyTimes()
+	auth.EXPECT().HasAPIKeyAccess("gk_active", gomock.Any()).DoAndReturn(func(id string, userID string) (bool, error) {
+		return userID == "7", nil
+	}).AnyTimes()
+
+	r := chi.NewRouter()
+	r.Route("/api/partner/users/{login}", func(r chi.Router) {
+		r.Use(APIKeyAuth(auth))
+		r.With(RequireScope(authentication.ScopeOrdersWrite)).Post("/orders", func(w http.ResponseWriter, r *http.Request) {
+			principal, _ := authentication.PrincipalFromContext(r.Context())
+			body, _ := io.ReadAll(r.Body)
+			w.Write([]byte(principal.UserID + ":" + string(body)))
+		})
+		r.With(RequireScope(authentication.ScopeBalanceRead)).Get("/balance", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		keyID          string
+		timestamp      string
+		signedBody     string
+		wantStatusCode int
+		wantResp       string
+	}{
+		{name: "ok", method: http.MethodPost, path: "/api/partner/users/alice/orders", keyID: "gk_active", timestamp: now, signedBody: "12345678903", wantStatusCode: http.StatusOK, wantResp: "7:12345678903"},
+		{name: "replayed", method: http.MethodPost, path: "/api/partner/users/alice/orders", keyID: "gk_active", timestamp: now, signedBody: "12345678903", wantStatusCode: http.StatusUnauthorized},
+		{name: "access not granted", method: http.MethodPost, path: "/api/partner/users/bob/orders", keyID: "gk_active", timestamp: now, signedBody: "12345678903", wantStatusCode: http.StatusForbidden},
+		{name: "tampered body", method: http.MethodPost, path: "/api/partner/users/alice/orders", keyID: "gk_active", timestamp: now, signedBody: "9278923470", wantStatusCode: http.StatusUnauthorized},
+		{name: "stale timestamp", method: http.MethodPost, path: "/api/partner/users/alice/orders", keyID: "gk_active", timestamp: old, signedBody: "12345678903", wantStatusCode: http.StatusUnauthorized},
+		{name: "revoked key", method: http.MethodPost, path: "/api/partner/users/alice/orders", keyID: "gk_revoked", timestamp: now, signedBody: "12345678903", wantStatusCode: http.StatusUnauthorized},
+		{name: "unknown key", method: http.MethodPost, path: "/api/partner/users/alice/orders", keyID: "gk_unknown", timestamp: now, signedBody: "12345678903", wantStatusCode: http.StatusUnauthorized},
+		{name: "missing scope", method: http.MethodGet, path: "/api/partner/users/alice/balance", keyID: "gk_active", timestamp: now, wantStatusCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := ""
+			if tt.method == http.MethodPost {
+				body = "12345678903"
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(body)))
+			req.Header.Set(APIKeyHeader, tt.keyID)
+			req.Header.Set(APITimestampHeader, tt.timestamp)
+			req.Header.Set(APISignatureHeader, authentication.SignRequest(secret, tt.method, tt.path, []byte(tt.signedBody), tt.timestamp))
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			result := rec.Result()
+			require.Equal(t, tt.wantStatusCode, result.StatusCode)
+
+			if tt.wantResp != "" {
+				resp, err := io.ReadAll(result.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.wantResp, string(resp))
+			}
+
+			err := result.Body.Close()
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("body too large", func(t *testing.T) {
+		body := bytes.Repeat([]byte("1"), maxSignedBodySize+1)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/partner/users/alice/orders", bytes.NewReader(body))
+		req.Header.Set(APIKeyHeader, "gk_active")
+		req.Header.Set(APITimestampHeader, now)
+		req.Header.Set(APISignatureHeader, authentication.SignRequest(secret, http.MethodPost, "/api/partner/users/alice/orders", body, now))
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		result := rec.Result()
+		require.Equal(t, http.StatusRequestEntityTooLarge, result.StatusCode)
+		require.NoError(t, result.Body.Close())
+	})
+}
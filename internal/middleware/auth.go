@@ -2,34 +2,68 @@ package middleware
 
 import (
 	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/logging"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/spf13/viper"
 	"net/http"
 )
 
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, err := r.Cookie("session_token")
-		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("user not authorized"))
+		if err != nil || token == nil || len(token.Value) < 16 {
+			problem.Write(w, r, problem.Unauthorized, "")
 			return
 		}
 
 		auth := authentication.New()
 
-		if token != nil && len(token.Value) >= 16 {
-			valid, err := auth.CheckTokenIsValid(token.Value)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+		user, err := auth.GetUserByToken(token.Value)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		if user == nil {
+			problem.Write(w, r, problem.Unauthorized, "")
+			return
+		}
+
+		logging.SetUserID(r.Context(), user.ID)
+		ctx := authentication.ContextWithPrincipal(r.Context(), authentication.Principal{
+			UserID:    user.ID,
+			Login:     user.Login,
+			Roles:     []string{user.Role},
+			SessionID: user.SessionID,
+			TwoFactor: user.TwoFactor,
+		})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireRole lets the request through only when the principal set by Auth
+// has one of the given roles. With REQUIRE_ADMIN_2FA enabled, admins are
+// also required to have two-factor authentication turned on.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := authentication.PrincipalFromContext(r.Context())
+			if !ok {
+				problem.Write(w, r, problem.Unauthorized, "")
 				return
 			}
-			if valid {
-				next.ServeHTTP(w, r)
+
+			if !principal.HasRole(roles...) {
+				problem.Write(w, r, problem.Forbidden, "")
 				return
 			}
 
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("user not authorized"))
-			return
-		}
-	})
+			if principal.HasRole(authentication.RoleAdmin) && !principal.TwoFactor && viper.GetBool("REQUIRE_ADMIN_2FA") {
+				problem.Write(w, r, problem.TwoFactorRequired, "")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
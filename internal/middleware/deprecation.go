@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Deprecated marks the responses of a v1 route that has a successor under
+// /api/v2 at the same path, with the Deprecation header and a
+// successor-version link.
+func Deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successor := "/api/v2" + strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api"), "/")
+
+		w.Header().Set("Deprecation", "true")
+		w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
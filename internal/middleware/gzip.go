@@ -2,27 +2,107 @@ package middleware
 
 import (
 	"compress/gzip"
-	"io"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
 	"net/http"
 	"strings"
 )
 
+// gzipETagSuffix marks the strong ETag of the gzip representation, which
+// RFC 7232 requires to differ from the one of the identity representation.
+const gzipETagSuffix = "-gzip"
+
+// gzipWriter compresses the body once the status is known. Responses that
+// have no body, 204 and 304, are passed through, so that no gzip header and
+// trailer end up in them.
 type gzipWriter struct {
 	http.ResponseWriter
-	Writer io.Writer
+	gz          *gzip.Writer
+	wroteHeader bool
+	compress    bool
+}
+
+func (gw *gzipWriter) WriteHeader(status int) {
+	if gw.wroteHeader {
+		gw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	gw.wroteHeader = true
+
+	header := gw.Header()
+	if etag := header.Get("ETag"); etag != "" {
+		header.Set("ETag", gzipETag(etag))
+	}
+	if status != http.StatusNoContent && status != http.StatusNotModified {
+		gw.compress = true
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+	}
+	gw.ResponseWriter.WriteHeader(status)
+}
+
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if !gw.compress {
+		return gw.ResponseWriter.Write(b)
+	}
+	return gw.gz.Write(b)
+}
+
+// Flush lets event streams through the compression.
+func (gw *gzipWriter) Flush() {
+	if gw.compress {
+		gw.gz.Flush()
+	}
+	if flusher, ok := gw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
 }
 
-func (gw gzipWriter) Write(b []byte) (int, error) {
-	return gw.Writer.Write(b)
+func (gw *gzipWriter) close() error {
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if !gw.compress {
+		return nil
+	}
+	return gw.gz.Close()
+}
+
+// gzipETag turns `"v"` into `"v-gzip"`, keeping a W/ prefix.
+func gzipETag(etag string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + gzipETagSuffix + `"`
+}
+
+// identityETags rewrites If-None-Match for the handler, which only knows
+// the tags of the identity representation: tags of the gzip one lose the
+// suffix, and the other ones are dropped, since the client would get gzip.
+func identityETags(header string) string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		switch {
+		case tag == "*":
+			tags = append(tags, tag)
+		case strings.HasSuffix(tag, gzipETagSuffix+`"`):
+			tags = append(tags, strings.TrimSuffix(tag, gzipETagSuffix+`"`)+`"`)
+		}
+	}
+	return strings.Join(tags, ", ")
 }
 
 func GzipHandle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
 
 		if strings.Contains(r.Header.Get(`Content-Encoding`), `gzip`) {
 			gz, err := gzip.NewReader(r.Body)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				problem.Write(w, r, problem.MalformedRequest, "body is not valid gzip")
 				return
 			}
 			r.Body = gz
@@ -37,12 +117,17 @@ func GzipHandle(next http.Handler) http.Handler {
 
 		gz, err := gzip.NewWriterLevel(w, gzip.BestCompression)
 		if err != nil {
-			http.Error(w, "", http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
-		defer gz.Close()
 
-		w.Header().Set("Content-Encoding", "gzip")
-		next.ServeHTTP(gzipWriter{ResponseWriter: w, Writer: gz}, r)
+		if inm := r.Header.Get("If-None-Match"); inm != "" {
+			r.Header.Set("If-None-Match", identityETags(inm))
+		}
+
+		gw := &gzipWriter{ResponseWriter: w, gz: gz}
+		defer gw.close()
+
+		next.ServeHTTP(gw, r)
 	})
 }
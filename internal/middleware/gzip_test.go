@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_GzipHandle(t *testing.T) {
+	h := GzipHandle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"3-json"`)
+		if r.Header.Get("If-None-Match") == `"3-json"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(`{"current":1}`))
+	}))
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		ifNoneMatch    string
+		wantStatus     int
+		wantETag       string
+		wantEncoding   string
+		wantBody       string
+	}{
+		{name: "identity", wantStatus: http.StatusOK, wantETag: `"3-json"`, wantBody: `{"current":1}`},
+		{name: "identity not modified", ifNoneMatch: `"3-json"`, wantStatus: http.StatusNotModified, wantETag: `"3-json"`},
+		{name: "gzip", acceptEncoding: "gzip", wantStatus: http.StatusOK, wantETag: `"3-json-gzip"`, wantEncoding: "gzip", wantBody: `{"current":1}`},
+		{name: "gzip not modified", acceptEncoding: "gzip", ifNoneMatch: `"3-json-gzip"`, wantStatus: http.StatusNotModified, wantETag: `"3-json-gzip"`},
+		{name: "identity etag does not match gzip", acceptEncoding: "gzip", ifNoneMatch: `"3-json"`, wantStatus: http.StatusOK, wantETag: `"3-json-gzip"`, wantEncoding: "gzip", wantBody: `{"current":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+			if tt.acceptEncoding != "" {
+				request.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			if tt.ifNoneMatch != "" {
+				request.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+			result := w.Result()
+			defer result.Body.Close()
+
+			require.Equal(t, tt.wantStatus, result.StatusCode)
+			require.Equal(t, tt.wantETag, result.Header.Get("ETag"))
+			require.Equal(t, "Accept-Encoding", result.Header.Get("Vary"))
+			require.Equal(t, tt.wantEncoding, result.Header.Get("Content-Encoding"))
+
+			body := result.Body
+			if tt.wantEncoding == "gzip" {
+				gz, err := gzip.NewReader(result.Body)
+				require.NoError(t, err)
+				body = gz
+			}
+			got, err := io.ReadAll(body)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantBody, string(got))
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"github.com/mkarulina/loyalty-system-service.git/internal/logging"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_RequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		echoed bool
+	}{
+		{name: "client id is kept", header: "abc-123", echoed: true},
+		{name: "missing id is generated", header: ""},
+		{name: "id with spaces is replaced", header: "abc 123"},
+		{name: "too long id is replaced", header: strings.Repeat("a", 129)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromContext string
+			h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = logging.RequestFromContext(r.Context()).ID
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(RequestIDHeader)
+			require.NotEmpty(t, id)
+			require.Equal(t, id, fromContext)
+			if tt.echoed {
+				require.Equal(t, tt.header, id)
+			} else {
+				require.NotEqual(t, tt.header, id)
+			}
+		})
+	}
+}
@@ -1,9 +1,9 @@
 package middleware
 
 import (
-	"encoding/hex"
-	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
-	"log"
+	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"log/slog"
 	"net/http"
 	"time"
 )
@@ -15,29 +15,20 @@ func TokenHandle(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
-		if err != nil {
-			log.Println(err)
+		if err != nil && err != http.ErrNoCookie {
+			slog.WarnContext(r.Context(), "can't read session cookie", "error", err)
 		}
 
-		e := encryption.New()
-
-		random, err := e.GenerateRandom(16)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		newUser := hex.EncodeToString(random)
-
-		newToken, err := e.EncryptData([]byte(newUser))
+		newToken, err := authentication.NewSessionToken()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 
 		newCookie := &http.Cookie{
 			Name:    "session_token",
 			Value:   newToken,
+			Path:    "/",
 			Expires: time.Now().Add(3 * time.Hour),
 			Secure:  false,
 		}
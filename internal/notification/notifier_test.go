@@ -0,0 +1,33 @@
+package notification
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_fileNotifier_PasswordReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	n := NewFileNotifier(path)
+
+	expiresAt := time.Date(2022, 6, 1, 10, 30, 0, 0, time.UTC)
+	require.NoError(t, n.PasswordReset("alice", "token1", expiresAt))
+	require.NoError(t, n.PasswordReset("bob", "token2", expiresAt))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+
+	m := message{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &m))
+	require.Equal(t, "password_reset", m.Kind)
+	require.Equal(t, "bob", m.Login)
+	require.Equal(t, "token2", m.Token)
+	require.True(t, expiresAt.Equal(m.ExpiresAt))
+}
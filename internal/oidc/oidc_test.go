@@ -0,0 +1,131 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"github.com/mkarulina/loyalty-system-service.git/internal/oidc/oidctest"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) (*Client, *oidctest.Provider) {
+	provider, err := oidctest.NewProvider("gophermart")
+	require.NoError(t, err)
+	t.Cleanup(provider.Close)
+
+	client := New(Config{
+		Issuer:      provider.Issuer(),
+		ClientID:    "gophermart",
+		RedirectURL: "http://localhost:8080/api/user/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	})
+	return client, provider
+}
+
+func Test_Client_flow(t *testing.T) {
+	client, provider := newTestClient(t)
+	ctx := context.Background()
+
+	verifier, err := NewVerifier()
+	require.NoError(t, err)
+
+	authURL, err := client.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	require.NoError(t, err)
+	require.Contains(t, authURL, provider.Issuer()+"/authorize?")
+	require.Contains(t, authURL, "code_challenge="+CodeChallenge(verifier))
+
+	callback, err := provider.Authorize(authURL, oidctest.User{Subject: "sub-1", Email: "alice@example.com"})
+	require.NoError(t, err)
+	require.Equal(t, "state-1", callback.Query().Get("state"))
+
+	claims, err := client.Exchange(ctx, callback.Query().Get("code"), verifier, "nonce-1")
+	require.NoError(t, err)
+	require.Equal(t, "sub-1", claims.Subject)
+	require.Equal(t, "alice@example.com", claims.Email)
+	require.True(t, claims.EmailVerified)
+}
+
+func Test_Client_wrongVerifier(t *testing.T) {
+	client, provider := newTestClient(t)
+	ctx := context.Background()
+
+	verifier, err := NewVerifier()
+	require.NoError(t, err)
+
+	authURL, err := client.AuthCodeURL(ctx, "state", "nonce", verifier)
+	require.NoError(t, err)
+	callback, err := provider.Authorize(authURL, oidctest.User{Subject: "sub"})
+	require.NoError(t, err)
+
+	_, err = client.Exchange(ctx, callback.Query().Get("code"), "another-verifier", "nonce")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "pkce")
+}
+
+func Test_Client_wrongNonce(t *testing.T) {
+	client, provider := newTestClient(t)
+	ctx := context.Background()
+
+	verifier, err := NewVerifier()
+	require.NoError(t, err)
+
+	authURL, err := client.AuthCodeURL(ctx, "state", "nonce", verifier)
+	require.NoError(t, err)
+	callback, err := provider.Authorize(authURL, oidctest.User{Subject: "sub"})
+	require.NoError(t, err)
+
+	provider.Nonce = "replayed"
+	_, err = client.Exchange(ctx, callback.Query().Get("code"), verifier, "nonce")
+	require.True(t, errors.Is(err, ErrInvalidToken))
+}
+
+func Test_Client_verify(t *testing.T) {
+	client, provider := newTestClient(t)
+	ctx := context.Background()
+	_, err := client.discover(ctx)
+	require.NoError(t, err)
+
+	now := time.Now()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   provider.Issuer(),
+			"sub":   "sub",
+			"aud":   []string{"other", "gophermart"},
+			"exp":   now.Add(time.Minute).Unix(),
+			"nonce": "nonce",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(claims map[string]interface{})
+		ok     bool
+	}{
+		{name: "valid", modify: func(map[string]interface{}) {}, ok: true},
+		{name: "other issuer", modify: func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }},
+		{name: "other audience", modify: func(c map[string]interface{}) { c["aud"] = "other" }},
+		{name: "expired", modify: func(c map[string]interface{}) { c["exp"] = now.Add(-time.Hour).Unix() }},
+		{name: "no subject", modify: func(c map[string]interface{}) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.modify(claims)
+			token, err := provider.Sign(claims)
+			require.NoError(t, err)
+
+			_, err = client.verify(ctx, token, "nonce", now)
+			if tt.ok {
+				require.NoError(t, err)
+			} else {
+				require.True(t, errors.Is(err, ErrInvalidToken), err)
+			}
+		})
+	}
+
+	token, err := provider.Sign(valid())
+	require.NoError(t, err)
+	_, err = client.verify(ctx, token[:len(token)-4]+"AAAA", "nonce", now)
+	require.True(t, errors.Is(err, ErrInvalidToken))
+}
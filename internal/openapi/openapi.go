@@ -0,0 +1,51 @@
+// Package openapi holds the OpenAPI 3 description of the HTTP API, serves it
+// and validates traffic against it.
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"net/http"
+	"sync"
+)
+
+//go:embed openapi.yaml
+var specYAML []byte
+
+var (
+	loadOnce sync.Once
+	doc      *openapi3.T
+	docJSON  []byte
+	loadErr  error
+)
+
+// Spec returns the parsed and validated document. The document is embedded
+// in the binary, so an error here means the spec itself is broken.
+func Spec() (*openapi3.T, error) {
+	loadOnce.Do(func() {
+		doc, loadErr = openapi3.NewLoader().LoadFromData(specYAML)
+		if loadErr != nil {
+			return
+		}
+		if loadErr = doc.Validate(context.Background()); loadErr != nil {
+			return
+		}
+		docJSON, loadErr = json.Marshal(doc)
+	})
+	return doc, loadErr
+}
+
+// Handler serves the document as JSON.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if _, err := Spec(); err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(docJSON)
+}
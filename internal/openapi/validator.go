@@ -0,0 +1,210 @@
+package openapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Validation modes, set with OPENAPI_VALIDATION.
+const (
+	ValidateOff      = ""
+	ValidateRequests = "requests"
+	// ValidateAll also checks every response and replaces a response that
+	// breaks the spec with a response_invalid problem. Responses are buffered,
+	// so the mode is meant for tests and staging, not for production.
+	ValidateAll = "all"
+)
+
+// Validator returns a middleware that rejects requests which do not match
+// the spec with a validation_failed problem. Requests to paths the spec
+// does not describe are passed on untouched; the router answers them.
+// Authentication is left to the handlers' own middleware.
+func Validator(mode string) (func(http.Handler) http.Handler, error) {
+	if mode != ValidateRequests && mode != ValidateAll {
+		return nil, fmt.Errorf("unknown openapi validation mode %q", mode)
+	}
+
+	spec, err := Spec()
+	if err != nil {
+		return nil, err
+	}
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					// the body is still compressed here, GzipHandle unpacks it later
+					ExcludeRequestBody: r.Header.Get("Content-Encoding") != "",
+					MultiError:         true,
+					AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+				},
+			}
+			if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+				problem.WriteValidation(w, r, requestErrors(err))
+				return
+			}
+
+			// event streams can not be buffered until they end
+			if mode != ValidateAll || streams(route.Operation) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			if err := validateResponse(r, input, rec); err != nil {
+				slog.ErrorContext(r.Context(), "response does not match the spec", "method", r.Method, "path", r.URL.Path, "error", err)
+				problem.Write(w, r, problem.ResponseInvalid, "")
+				return
+			}
+			rec.flush(w)
+		})
+	}, nil
+}
+
+// streams tells whether the operation answers with an event stream. The
+// spec decides, not the Accept header, so that a client can not switch the
+// check off for an ordinary route.
+func streams(operation *openapi3.Operation) bool {
+	for _, response := range operation.Responses {
+		if response.Value != nil && response.Value.Content["text/event-stream"] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func validateResponse(r *http.Request, input *openapi3filter.RequestValidationInput, rec *responseRecorder) error {
+	contentType := rec.header.Get("Content-Type")
+	// only JSON bodies are checked against schemas; archives and
+	// compressed bodies are checked by status code alone
+	skipBody := rec.header.Get("Content-Encoding") != "" ||
+		(contentType != "" && !strings.Contains(contentType, "json"))
+
+	out := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 rec.status,
+		Header:                 rec.header,
+		Options: &openapi3filter.Options{
+			ExcludeResponseBody:   skipBody,
+			IncludeResponseStatus: true,
+			MultiError:            true,
+		},
+	}
+	out.SetBodyBytes(rec.body.Bytes())
+
+	return openapi3filter.ValidateResponse(r.Context(), out)
+}
+
+// requestErrors turns the validator's findings into field errors in the
+// same shape as the handlers report them.
+func requestErrors(err error) validation.Errors {
+	var errs validation.Errors
+
+	var multi openapi3.MultiError
+	if !errors.As(err, &multi) {
+		multi = openapi3.MultiError{err}
+	}
+
+	for _, e := range multi {
+		var reqErr *openapi3filter.RequestError
+		if !errors.As(e, &reqErr) {
+			errs = append(errs, validation.FieldError{Field: "request", Code: "invalid", Message: e.Error()})
+			continue
+		}
+
+		switch {
+		case reqErr.Parameter != nil:
+			errs = append(errs, validation.FieldError{Field: reqErr.Parameter.Name, Code: "invalid", Message: reqErr.Error()})
+		case reqErr.RequestBody != nil:
+			errs = append(errs, bodyErrors(reqErr)...)
+		default:
+			errs = append(errs, validation.FieldError{Field: "request", Code: "invalid", Message: reqErr.Error()})
+		}
+	}
+	return errs
+}
+
+func bodyErrors(reqErr *openapi3filter.RequestError) validation.Errors {
+	var schemaErrs openapi3.MultiError
+	if !errors.As(reqErr.Err, &schemaErrs) {
+		schemaErrs = openapi3.MultiError{reqErr.Err}
+	}
+
+	var errs validation.Errors
+	for _, e := range schemaErrs {
+		var schemaErr *openapi3.SchemaError
+		if !errors.As(e, &schemaErr) {
+			errs = append(errs, validation.FieldError{Field: "body", Code: "malformed", Message: reqErr.Error()})
+			continue
+		}
+
+		field := strings.Join(schemaErr.JSONPointer(), ".")
+		code := "invalid"
+		if schemaErr.SchemaField == "required" {
+			code = validation.CodeRequired
+		}
+		if field == "" {
+			field = "body"
+		}
+		errs = append(errs, validation.FieldError{Field: field, Code: code, Message: schemaErr.Reason})
+	}
+	return errs
+}
+
+// responseRecorder holds the response until it has been validated.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.wrote {
+		return
+	}
+	rr.status = status
+	rr.wrote = true
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wrote = true
+	return rr.body.Write(b)
+}
+
+func (rr *responseRecorder) flush(w http.ResponseWriter) {
+	for k, v := range rr.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rr.status)
+	io.Copy(w, &rr.body)
+}
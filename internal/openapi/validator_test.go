@@ -0,0 +1,111 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidator_responses(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           string
+		accept         string
+		status         int
+		body           string
+		wantStatusCode int
+	}{
+		{
+			name:           "valid response",
+			mode:           ValidateAll,
+			status:         http.StatusOK,
+			body:           `{"current":500.5,"withdrawn":42}`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "wrong field type",
+			mode:           ValidateAll,
+			status:         http.StatusOK,
+			body:           `{"current":"500.5","withdrawn":42}`,
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "missing field",
+			mode:           ValidateAll,
+			status:         http.StatusOK,
+			body:           `{"current":500.5}`,
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "accepting an event stream",
+			mode:           ValidateAll,
+			accept:         "text/event-stream",
+			status:         http.StatusOK,
+			body:           `{"current":500.5}`,
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "requests only",
+			mode:           ValidateRequests,
+			status:         http.StatusOK,
+			body:           `{"current":500.5}`,
+			wantStatusCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator, err := Validator(tt.mode)
+			require.NoError(t, err)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			validator(next).ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatusCode, rec.Code)
+			if tt.wantStatusCode == http.StatusOK {
+				require.JSONEq(t, tt.body, rec.Body.String())
+				return
+			}
+
+			details := problem.Details{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &details))
+			require.Equal(t, problem.ResponseInvalid.Code, details.Code)
+		})
+	}
+}
+
+func TestValidator_eventStream(t *testing.T) {
+	validator, err := Validator(ValidateAll)
+	require.NoError(t, err)
+
+	flushed := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(": heartbeat\n\n"))
+		_, flushed = w.(http.Flusher)
+	})
+
+	rec := httptest.NewRecorder()
+	validator(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/user/events", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, flushed)
+	require.Equal(t, ": heartbeat\n\n", rec.Body.String())
+}
+
+func TestValidator_unknownMode(t *testing.T) {
+	_, err := Validator("strict")
+	require.Error(t, err)
+}
@@ -0,0 +1,137 @@
+// Package problem writes error responses as RFC 7807 problem details.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"log/slog"
+	"net/http"
+)
+
+const ContentType = "application/problem+json"
+
+// Type is a kind of failure. Code is stable and meant for clients to switch
+// on; Title is the human-readable summary that goes with it.
+type Type struct {
+	Code   string
+	Status int
+	Title  string
+}
+
+var (
+	Internal         = Type{Code: "internal_error", Status: http.StatusInternalServerError, Title: "Internal server error"}
+	BadGateway       = Type{Code: "upstream_error", Status: http.StatusBadGateway, Title: "Upstream service failed"}
+	MalformedRequest = Type{Code: "malformed_request", Status: http.StatusBadRequest, Title: "Malformed request"}
+	BodyTooLarge     = Type{Code: "body_too_large", Status: http.StatusRequestEntityTooLarge, Title: "Request body is too large"}
+	ValidationFailed = Type{Code: "validation_failed", Status: http.StatusBadRequest, Title: "Request validation failed"}
+	NotFound         = Type{Code: "not_found", Status: http.StatusNotFound, Title: "Resource not found"}
+	MethodNotAllowed = Type{Code: "method_not_allowed", Status: http.StatusMethodNotAllowed, Title: "Method not allowed"}
+	ResponseInvalid  = Type{Code: "response_invalid", Status: http.StatusInternalServerError, Title: "Response does not match the API description"}
+
+	Unauthorized         = Type{Code: "unauthorized", Status: http.StatusUnauthorized, Title: "Authentication required"}
+	InvalidCredentials   = Type{Code: "invalid_credentials", Status: http.StatusUnauthorized, Title: "Invalid login or password"}
+	Forbidden            = Type{Code: "forbidden", Status: http.StatusForbidden, Title: "Access denied"}
+	TwoFactorRequired    = Type{Code: "two_factor_required", Status: http.StatusForbidden, Title: "Two-factor authentication required"}
+	WrongPassword        = Type{Code: "wrong_password", Status: http.StatusForbidden, Title: "Current password is wrong"}
+	LoginTaken           = Type{Code: "login_taken", Status: http.StatusConflict, Title: "Login is already taken"}
+	TwoFactorNotEnrolled = Type{Code: "two_factor_not_enrolled", Status: http.StatusConflict, Title: "Two-factor authentication is not enrolled"}
+	TwoFactorEnabled     = Type{Code: "two_factor_already_enabled", Status: http.StatusConflict, Title: "Two-factor authentication is already enabled"}
+	InvalidChallenge     = Type{Code: "invalid_challenge", Status: http.StatusUnauthorized, Title: "Login challenge is invalid or expired"}
+	InvalidSecondFactor  = Type{Code: "invalid_second_factor", Status: http.StatusUnauthorized, Title: "Two-factor code is wrong"}
+	InvalidSignature     = Type{Code: "invalid_signature", Status: http.StatusUnauthorized, Title: "Request signature is invalid"}
+	MissingScope         = Type{Code: "missing_scope", Status: http.StatusForbidden, Title: "API key lacks the required scope"}
+	SignatureReplayed    = Type{Code: "signature_replayed", Status: http.StatusUnauthorized, Title: "Signed request has already been used"}
+	AccessNotGranted     = Type{Code: "access_not_granted", Status: http.StatusForbidden, Title: "User has not granted access to the API key"}
+
+	UserNotFound      = Type{Code: "user_not_found", Status: http.StatusNotFound, Title: "User not found"}
+	OrderNotFound     = Type{Code: "order_not_found", Status: http.StatusNotFound, Title: "Order not found"}
+	APIKeyNotFound    = Type{Code: "api_key_not_found", Status: http.StatusNotFound, Title: "API key not found"}
+	InvalidOrder      = Type{Code: "invalid_order_number", Status: http.StatusUnprocessableEntity, Title: "Order number fails the Luhn check"}
+	OrderOfOtherUser  = Type{Code: "order_owned_by_another_user", Status: http.StatusConflict, Title: "Order was uploaded by another user"}
+	InsufficientFunds = Type{Code: "insufficient_funds", Status: http.StatusPaymentRequired, Title: "Not enough points"}
+
+	WithdrawalNotFound   = Type{Code: "withdrawal_not_found", Status: http.StatusNotFound, Title: "Withdrawal not found"}
+	WithdrawalReversed   = Type{Code: "withdrawal_already_reversed", Status: http.StatusConflict, Title: "Withdrawal has already been reversed"}
+	ReversalWindowClosed = Type{Code: "reversal_window_closed", Status: http.StatusConflict, Title: "Withdrawal can no longer be cancelled"}
+
+	InvalidWithdrawalSum   = Type{Code: "invalid_withdrawal_sum", Status: http.StatusUnprocessableEntity, Title: "Withdrawal sum must be positive"}
+	WithdrawalBelowMinimum = Type{Code: "withdrawal_below_minimum", Status: http.StatusUnprocessableEntity, Title: "Withdrawal is below the minimum"}
+	WithdrawalAboveMaximum = Type{Code: "withdrawal_above_maximum", Status: http.StatusUnprocessableEntity, Title: "Withdrawal is above the maximum"}
+	DailyWithdrawalLimit   = Type{Code: "daily_withdrawal_limit_exceeded", Status: http.StatusUnprocessableEntity, Title: "Withdrawal exceeds the daily limit"}
+	MonthlyWithdrawalLimit = Type{Code: "monthly_withdrawal_limit_exceeded", Status: http.StatusUnprocessableEntity, Title: "Withdrawal exceeds the monthly limit"}
+	WithdrawalCoolingOff   = Type{Code: "withdrawal_cooling_off", Status: http.StatusForbidden, Title: "Account is too new to withdraw points"}
+	OrderWithdrawalLimit   = Type{Code: "order_withdrawal_limit_exceeded", Status: http.StatusConflict, Title: "Order has reached the number of withdrawals allowed"}
+
+	RecipientNotFound     = Type{Code: "recipient_not_found", Status: http.StatusNotFound, Title: "Transfer recipient not found"}
+	TransferLimitExceeded = Type{Code: "transfer_limit_exceeded", Status: http.StatusUnprocessableEntity, Title: "Transfer exceeds the per-transfer limit"}
+	DailyTransferLimit    = Type{Code: "daily_transfer_limit_exceeded", Status: http.StatusUnprocessableEntity, Title: "Transfer exceeds the daily limit"}
+	AccountTooNew         = Type{Code: "account_too_new", Status: http.StatusForbidden, Title: "Account is too new to transfer points"}
+
+	OIDCDisabled  = Type{Code: "oidc_disabled", Status: http.StatusNotFound, Title: "OIDC login is not configured"}
+	OIDCFlowError = Type{Code: "oidc_flow_invalid", Status: http.StatusBadRequest, Title: "OIDC login flow is missing, expired or forged"}
+	OIDCDenied    = Type{Code: "oidc_denied", Status: http.StatusUnauthorized, Title: "Identity provider did not authenticate the user"}
+)
+
+// Details is the application/problem+json body. Code duplicates the last
+// segment of Type so that clients do not need to parse the URI.
+type Details struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     string            `json:"code"`
+	Errors   validation.Errors `json:"errors,omitempty"`
+}
+
+func (t Type) details(r *http.Request, detail string) Details {
+	d := Details{
+		Type:   "/problems/" + t.Code,
+		Title:  t.Title,
+		Status: t.Status,
+		Detail: detail,
+		Code:   t.Code,
+	}
+	if r != nil {
+		d.Instance = r.URL.Path
+	}
+	return d
+}
+
+// Write sends the problem. detail explains this occurrence and may be empty;
+// it must not carry internal error text.
+func Write(w http.ResponseWriter, r *http.Request, t Type, detail string) {
+	write(w, t.details(r, detail))
+}
+
+// WriteValidation sends a validation_failed problem listing the field errors.
+func WriteValidation(w http.ResponseWriter, r *http.Request, errs validation.Errors) {
+	d := ValidationFailed.details(r, "")
+	d.Errors = errs
+	write(w, d)
+}
+
+// WriteError logs err and sends an internal_error problem. r may be nil.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+	}
+	slog.ErrorContext(ctx, "internal error", "error", err)
+	Write(w, r, Internal, "")
+}
+
+func write(w http.ResponseWriter, d Details) {
+	body, err := json.Marshal(d)
+	if err != nil {
+		slog.Error("can't encode problem", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(d.Status)
+	w.Write(body)
+}
@@ -0,0 +1,53 @@
+package problem
+
+import (
+	"encoding/json"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Write(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Write(rec, httptest.NewRequest(http.MethodPost, "/api/user/orders", nil), OrderOfOtherUser, "")
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+
+	d := Details{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &d))
+	require.Equal(t, Details{
+		Type:     "/problems/order_owned_by_another_user",
+		Title:    OrderOfOtherUser.Title,
+		Status:   http.StatusConflict,
+		Instance: "/api/user/orders",
+		Code:     "order_owned_by_another_user",
+	}, d)
+}
+
+func Test_WriteValidation(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteValidation(rec, nil, validation.Errors{{Field: "login", Code: validation.CodeRequired, Message: "login is required"}})
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	d := Details{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &d))
+	require.Equal(t, "validation_failed", d.Code)
+	require.Len(t, d.Errors, 1)
+	require.Equal(t, "login", d.Errors[0].Field)
+}
+
+func Test_WriteError_hidesCause(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteError(rec, nil, errTest("pq: connection refused"))
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.NotContains(t, rec.Body.String(), "connection refused")
+}
+
+type errTest string
+
+func (e errTest) Error() string { return string(e) }
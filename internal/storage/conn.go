@@ -1,16 +1,66 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"github.com/XSAM/otelsql"
+	"github.com/mkarulina/loyalty-system-service.git/internal/metrics"
+	"github.com/mkarulina/loyalty-system-service.git/internal/tracing"
 	"github.com/spf13/viper"
-	"log"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"os"
+	"sync"
 )
 
+var (
+	sharedDBOnce sync.Once
+	sharedDBPool *sql.DB
+)
+
+// initDB opens the database with a span for every query and transaction
+// made within a traced operation.
 func initDB() *sql.DB {
-	db, err := sql.Open("pgx", viper.GetString("DATABASE_URI"))
+	db, err := otelsql.Open("pgx", viper.GetString("DATABASE_URI"),
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+	)
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("can't open database", "error", err)
+		os.Exit(1)
 	}
 
 	return db
 }
+
+// sharedDB is the pool of the long-lived storages; its statistics are
+// exported as metrics.
+func sharedDB() *sql.DB {
+	sharedDBOnce.Do(func() {
+		sharedDBPool = initDB()
+		metrics.RegisterDB("storage", sharedDBPool)
+	})
+	return sharedDBPool
+}
+
+// observe starts the span and the duration metric of a storage method.
+// The returned context carries the span, so that the SQL queries made with
+// it become its children; call the returned function when the method
+// returns.
+func observe(ctx context.Context, method string) (context.Context, func()) {
+	timer := metrics.ObserveQuery(method)
+	ctx, span := tracing.Tracer().Start(ctx, "storage."+method)
+	return ctx, func() {
+		span.End()
+		timer.ObserveDuration()
+	}
+}
@@ -0,0 +1,27 @@
+package storage
+
+import "errors"
+
+var (
+	// ErrOrderExists means the user has already uploaded the order.
+	ErrOrderExists = errors.New("order already uploaded by the user")
+	// ErrOrderOwnedByAnotherUser means the order number belongs to someone else.
+	ErrOrderOwnedByAnotherUser = errors.New("order uploaded by another user")
+	ErrOrderNotFound           = errors.New("order not found")
+
+	ErrWithdrawalNotFound = errors.New("withdrawal not found")
+	// ErrWithdrawalReversed means the withdrawal has already been reversed.
+	ErrWithdrawalReversed = errors.New("withdrawal already reversed")
+	// ErrReversalWindowClosed means the withdrawal is too old to be cancelled
+	// by the user.
+	ErrReversalWindowClosed = errors.New("withdrawal can no longer be cancelled")
+
+	ErrInsufficientFunds = errors.New("not enough points")
+	// ErrRecipientNotFound means there is no active user to transfer to.
+	ErrRecipientNotFound  = errors.New("transfer recipient not found")
+	ErrSelfTransfer       = errors.New("transfer to oneself")
+	ErrDailyTransferLimit = errors.New("daily transfer limit exceeded")
+	// ErrAccountTooNew means the sender has not been registered long enough
+	// to transfer points.
+	ErrAccountTooNew = errors.New("account too new to transfer points")
+)
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// UserEventsChannel is the Postgres NOTIFY channel announcing new user
+// events. The payload is the user ID.
+const UserEventsChannel = "user_events"
+
+// Types of user events.
+const (
+	EventOrder   = "order"
+	EventBalance = "balance"
+)
+
+type UserEvent struct {
+	ID        int64
+	UserID    string
+	Type      string
+	Data      json.RawMessage
+	CreatedAt time.Time
+}
+
+// OrderEvent is the data of an EventOrder.
+type OrderEvent struct {
+	Number          string    `json:"number"`
+	Status          string    `json:"status"`
+	Accrual         float32   `json:"accrual"`
+	StatusChangedAt time.Time `json:"status_changed_at"`
+}
+
+// BalanceEvent is the data of an EventBalance.
+type BalanceEvent struct {
+	Current   float32 `json:"current"`
+	Withdrawn float32 `json:"withdrawn"`
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// addUserEvent records the event and notifies the listeners of all
+// replicas. Inside a transaction the notification is delivered on commit.
+// The event number is taken from users.event_seq, so the row lock of the
+// user is held until commit and the events of one user commit in the
+// order of their numbers; a reader never skips an event that commits late.
+func addUserEvent(ctx context.Context, q queryer, userID string, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var id int64
+	return q.QueryRowContext(ctx, `
+WITH u AS (
+    UPDATE users SET event_seq = event_seq + 1 WHERE id = $1::bigint RETURNING id, event_seq
+), e AS (
+    INSERT INTO user_events (user_id, seq, type, data) SELECT u.id::text, u.event_seq, $2, $3 FROM u RETURNING seq, user_id
+)
+SELECT e.seq FROM e, pg_notify($4, e.user_id)`,
+		userID, eventType, string(payload), UserEventsChannel,
+	).Scan(&id)
+}
+
+// addBalanceEvent records the current balance of the user as an event.
+func addBalanceEvent(ctx context.Context, q queryer, userID string) error {
+	event := BalanceEvent{}
+	if err := q.QueryRowContext(ctx, balanceQuery, userID).Scan(&event.Current, &event.Withdrawn); err != nil {
+		return err
+	}
+	return addUserEvent(ctx, q, userID, EventBalance, event)
+}
+
+// GetUserEvents returns at most limit events of the user following afterID,
+// oldest first.
+func (s *orderStorage) GetUserEvents(ctx context.Context, userID string, afterID int64, limit int) ([]UserEvent, error) {
+	ctx, end := observe(ctx, "GetUserEvents")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT seq, user_id, type, data, created_at FROM user_events WHERE user_id = $1 AND seq > $2 ORDER BY seq LIMIT $3",
+		userID, afterID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []UserEvent
+	for rows.Next() {
+		e := UserEvent{}
+		var data []byte
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Type, &data, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Data = data
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// GetLastUserEventID returns the ID of the latest event of the user, or 0.
+// It is kept on the user, so it survives the pruning of old events.
+func (s *orderStorage) GetLastUserEventID(ctx context.Context, userID string) (int64, error) {
+	ctx, end := observe(ctx, "GetLastUserEventID")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE((SELECT event_seq FROM users WHERE id = $1::bigint), 0)", userID).Scan(&id)
+	return id, err
+}
+
+// PruneUserEvents deletes the events recorded before the given time and
+// returns how many were deleted. A client resuming from a pruned event
+// continues with the oldest one kept.
+func (s *orderStorage) PruneUserEvents(ctx context.Context, before time.Time) (int64, error) {
+	ctx, end := observe(ctx, "PruneUserEvents")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM user_events WHERE created_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
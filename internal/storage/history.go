@@ -3,88 +3,138 @@ package storage
 import (
 	"context"
 	"database/sql"
-	"errors"
-	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
 	"sync"
 	"time"
 )
 
 type Withdrawn struct {
+	ID          string
 	UserID      string
 	OrderNumber string
 	Sum         float32
 	ProcessedAt time.Time
+	ReversedAt  *time.Time
+}
+
+const withdrawnColumns = "id::text, user_id, order_number, sum, uploaded_at, reversed_at"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWithdrawn(row scanner) (Withdrawn, error) {
+	var w Withdrawn
+	var reversedAt sql.NullTime
+
+	err := row.Scan(&w.ID, &w.UserID, &w.OrderNumber, &w.Sum, &w.ProcessedAt, &reversedAt)
+	if reversedAt.Valid {
+		w.ReversedAt = &reversedAt.Time
+	}
+	return w, err
 }
 
 type HistoryStorage interface {
-	AddWithdrawnHistory(user string, order string, sum float32) error
-	GetWithdrawalsHistory(token string) ([]Withdrawn, error)
+	GetWithdrawalsHistory(ctx context.Context, userID string) ([]Withdrawn, error)
+	StreamWithdrawalsHistory(ctx context.Context, userID string, fn func(Withdrawn) error) error
+	GetOrderWithdrawals(ctx context.Context, userID string, order string) ([]Withdrawn, error)
 }
 
 type historyStorage struct {
-	mu   sync.RWMutex
-	db   *sql.DB
-	auth authentication.Auth
+	mu sync.RWMutex
+	db *sql.DB
 }
 
 func NewHistoryStorage() HistoryStorage {
 	s := &historyStorage{
-		mu:   sync.RWMutex{},
-		db:   initDB(),
-		auth: authentication.New(),
+		mu: sync.RWMutex{},
+		db: sharedDB(),
 	}
 	return s
 }
 
-func (s *historyStorage) AddWithdrawnHistory(user string, order string, sum float32) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (s *historyStorage) GetWithdrawalsHistory(ctx context.Context, userID string) ([]Withdrawn, error) {
+	ctx, end := observe(ctx, "GetWithdrawalsHistory")
+	defer end()
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	var history []Withdrawn
 
-	_, err := s.db.ExecContext(
-		ctx,
-		"INSERT INTO withdrawals_history (user_id, order_number, sum, processed_at) VALUES ($1, $2, $3, $4)",
-		user, order, sum, time.Now().Format(time.RFC3339),
-	)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.QueryContext(ctx, "SELECT "+withdrawnColumns+" FROM withdrawals_history WHERE user_id = $1 ORDER BY uploaded_at ASC", userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	for result.Next() {
+		w, err := scanWithdrawn(result)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, w)
+	}
+
+	return history, nil
 }
 
-func (s *historyStorage) GetWithdrawalsHistory(token string) ([]Withdrawn, error) {
+func (s *historyStorage) GetOrderWithdrawals(ctx context.Context, userID string, order string) ([]Withdrawn, error) {
+	ctx, end := observe(ctx, "GetOrderWithdrawals")
+	defer end()
+
 	var history []Withdrawn
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	login, err := s.auth.GetUserLoginByToken(token, s.db)
+	result, err := s.db.QueryContext(
+		ctx,
+		"SELECT "+withdrawnColumns+" FROM withdrawals_history WHERE user_id = $1 AND order_number = $2 ORDER BY uploaded_at ASC",
+		userID, order,
+	)
 	if err != nil {
 		return nil, err
 	}
-	if login == "" {
-		return nil, errors.New("user not found")
+	defer result.Close()
+
+	for result.Next() {
+		w, err := scanWithdrawn(result)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, w)
 	}
 
-	result, err := s.db.QueryContext(ctx, "SELECT * FROM withdrawals_history WHERE user_id = $1", login)
+	return history, result.Err()
+}
+
+// StreamWithdrawalsHistory is the cursor-backed counterpart of
+// GetWithdrawalsHistory for exports, see StreamUserOrders.
+func (s *historyStorage) StreamWithdrawalsHistory(ctx context.Context, userID string, fn func(Withdrawn) error) error {
+	ctx, end := observe(ctx, "StreamWithdrawalsHistory")
+	defer end()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT "+withdrawnColumns+" FROM withdrawals_history WHERE user_id = $1 ORDER BY uploaded_at ASC",
+		userID,
+	)
 	if err != nil {
-		return nil, err
-	}
-	if result.Err() != nil {
-		return nil, result.Err()
+		return err
 	}
+	defer rows.Close()
 
-	for result.Next() {
-		var w Withdrawn
-
-		err = result.Scan(&w.UserID, &w.OrderNumber, &w.Sum, &w.ProcessedAt)
+	for rows.Next() {
+		w, err := scanWithdrawn(rows)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err = fn(w); err != nil {
+			return err
 		}
-		history = append(history, w)
 	}
 
-	return history, nil
+	return rows.Err()
 }
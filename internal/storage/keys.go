@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/mkarulina/loyalty-system-service.git/internal/encryption"
+	"time"
+)
+
+type encryptedColumn struct {
+	table  string
+	id     string
+	column string
+}
+
+// encryptedColumns lists every column holding data produced by
+// encryption.Encryptor that is decrypted later, so that key rotation can
+// re-encrypt it. Session tokens in sessions.token and login_challenges.token
+// are left out on purpose: they are never decrypted, only looked up by the
+// exact cookie value, so re-encrypting them would log everybody out.
+var encryptedColumns = []encryptedColumn{
+	{table: "users", id: "id", column: "totp_secret"},
+	{table: "api_keys", id: "id", column: "secret"},
+}
+
+// RotateEncryptedData re-encrypts every stored ciphertext that was not
+// produced with the active key and returns the number of updated values.
+func RotateEncryptedData(e encryption.Encryptor) (int, error) {
+	db := initDB()
+	defer db.Close()
+
+	rotated := 0
+
+	for _, c := range encryptedColumns {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+		n, err := rotateColumn(ctx, e, c, db)
+		cancel()
+		rotated += n
+		if err != nil {
+			return rotated, fmt.Errorf("%s.%s: %w", c.table, c.column, err)
+		}
+	}
+
+	return rotated, nil
+}
+
+func rotateColumn(ctx context.Context, e encryption.Encryptor, c encryptedColumn, db *sql.DB) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s, %s FROM %s WHERE %s IS NOT NULL AND %s != '' FOR UPDATE",
+		c.id, c.column, c.table, c.column, c.column,
+	))
+	if err != nil {
+		return 0, err
+	}
+
+	updates := map[string]string{}
+	for rows.Next() {
+		var id, value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		rotated, changed, err := e.Rotate(value)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s %s: %w", c.id, id, err)
+		}
+		if changed {
+			updates[id] = rotated
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	update := fmt.Sprintf("UPDATE %s SET %s = $1 WHERE %s = $2", c.table, c.column, c.id)
+	for id, value := range updates {
+		if _, err := tx.ExecContext(ctx, update, value, id); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(updates), tx.Commit()
+}
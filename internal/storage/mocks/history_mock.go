@@ -5,12 +5,54 @@
 package mock_storage
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
 	storage "github.com/mkarulina/loyalty-system-service.git/internal/storage"
 )
 
+// Mockscanner is a mock of scanner interface.
+type Mockscanner struct {
+	ctrl     *gomock.Controller
+	recorder *MockscannerMockRecorder
+}
+
+// MockscannerMockRecorder is the mock recorder for Mockscanner.
+type MockscannerMockRecorder struct {
+	mock *Mockscanner
+}
+
+// NewMockscanner creates a new mock instance.
+func NewMockscanner(ctrl *gomock.Controller) *Mockscanner {
+	mock := &Mockscanner{ctrl: ctrl}
+	mock.recorder = &MockscannerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockscanner) EXPECT() *MockscannerMockRecorder {
+	return m.recorder
+}
+
+// Scan mocks base method.
+func (m *Mockscanner) Scan(dest ...interface{}) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range dest {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Scan", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Scan indicates an expected call of Scan.
+func (mr *MockscannerMockRecorder) Scan(dest ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scan", reflect.TypeOf((*Mockscanner)(nil).Scan), dest...)
+}
+
 // MockHistoryStorage is a mock of HistoryStorage interface.
 type MockHistoryStorage struct {
 	ctrl     *gomock.Controller
@@ -34,31 +76,46 @@ func (m *MockHistoryStorage) EXPECT() *MockHistoryStorageMockRecorder {
 	return m.recorder
 }
 
-// AddWithdrawnHistory mocks base method.
-func (m *MockHistoryStorage) AddWithdrawnHistory(user, order string, sum float32) error {
+// GetOrderWithdrawals mocks base method.
+func (m *MockHistoryStorage) GetOrderWithdrawals(ctx context.Context, userID, order string) ([]storage.Withdrawn, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddWithdrawnHistory", user, order, sum)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "GetOrderWithdrawals", ctx, userID, order)
+	ret0, _ := ret[0].([]storage.Withdrawn)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// AddWithdrawnHistory indicates an expected call of AddWithdrawnHistory.
-func (mr *MockHistoryStorageMockRecorder) AddWithdrawnHistory(user, order, sum interface{}) *gomock.Call {
+// GetOrderWithdrawals indicates an expected call of GetOrderWithdrawals.
+func (mr *MockHistoryStorageMockRecorder) GetOrderWithdrawals(ctx, userID, order interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWithdrawnHistory", reflect.TypeOf((*MockHistoryStorage)(nil).AddWithdrawnHistory), user, order, sum)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderWithdrawals", reflect.TypeOf((*MockHistoryStorage)(nil).GetOrderWithdrawals), ctx, userID, order)
 }
 
 // GetWithdrawalsHistory mocks base method.
-func (m *MockHistoryStorage) GetWithdrawalsHistory(token string) ([]storage.Withdrawn, error) {
+func (m *MockHistoryStorage) GetWithdrawalsHistory(ctx context.Context, userID string) ([]storage.Withdrawn, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetWithdrawalsHistory", token)
+	ret := m.ctrl.Call(m, "GetWithdrawalsHistory", ctx, userID)
 	ret0, _ := ret[0].([]storage.Withdrawn)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetWithdrawalsHistory indicates an expected call of GetWithdrawalsHistory.
-func (mr *MockHistoryStorageMockRecorder) GetWithdrawalsHistory(token interface{}) *gomock.Call {
+func (mr *MockHistoryStorageMockRecorder) GetWithdrawalsHistory(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawalsHistory", reflect.TypeOf((*MockHistoryStorage)(nil).GetWithdrawalsHistory), ctx, userID)
+}
+
+// StreamWithdrawalsHistory mocks base method.
+func (m *MockHistoryStorage) StreamWithdrawalsHistory(ctx context.Context, userID string, fn func(storage.Withdrawn) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamWithdrawalsHistory", ctx, userID, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamWithdrawalsHistory indicates an expected call of StreamWithdrawalsHistory.
+func (mr *MockHistoryStorageMockRecorder) StreamWithdrawalsHistory(ctx, userID, fn interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawalsHistory", reflect.TypeOf((*MockHistoryStorage)(nil).GetWithdrawalsHistory), token)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamWithdrawalsHistory", reflect.TypeOf((*MockHistoryStorage)(nil).StreamWithdrawalsHistory), ctx, userID, fn)
 }
@@ -5,10 +5,13 @@
 package mock_storage
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	storage "github.com/mkarulina/loyalty-system-service.git/internal/storage"
+	withdrawal "github.com/mkarulina/loyalty-system-service.git/internal/withdrawal"
 )
 
 // MockOrderStorage is a mock of OrderStorage interface.
@@ -35,38 +38,98 @@ func (m *MockOrderStorage) EXPECT() *MockOrderStorageMockRecorder {
 }
 
 // AddOrderNumber mocks base method.
-func (m *MockOrderStorage) AddOrderNumber(order, token string) error {
+func (m *MockOrderStorage) AddOrderNumber(ctx context.Context, order, userID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddOrderNumber", order, token)
+	ret := m.ctrl.Call(m, "AddOrderNumber", ctx, order, userID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // AddOrderNumber indicates an expected call of AddOrderNumber.
-func (mr *MockOrderStorageMockRecorder) AddOrderNumber(order, token interface{}) *gomock.Call {
+func (mr *MockOrderStorageMockRecorder) AddOrderNumber(ctx, order, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrderNumber", reflect.TypeOf((*MockOrderStorage)(nil).AddOrderNumber), order, token)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrderNumber", reflect.TypeOf((*MockOrderStorage)(nil).AddOrderNumber), ctx, order, userID)
+}
+
+// AddOrderNumbers mocks base method.
+func (m *MockOrderStorage) AddOrderNumbers(ctx context.Context, orders []string, userID string) ([]storage.AddResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddOrderNumbers", ctx, orders, userID)
+	ret0, _ := ret[0].([]storage.AddResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddOrderNumbers indicates an expected call of AddOrderNumbers.
+func (mr *MockOrderStorageMockRecorder) AddOrderNumbers(ctx, orders, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrderNumbers", reflect.TypeOf((*MockOrderStorage)(nil).AddOrderNumbers), ctx, orders, userID)
+}
+
+// CountOrdersByStatus mocks base method.
+func (m *MockOrderStorage) CountOrdersByStatus(ctx context.Context) (map[string]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountOrdersByStatus", ctx)
+	ret0, _ := ret[0].(map[string]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountOrdersByStatus indicates an expected call of CountOrdersByStatus.
+func (mr *MockOrderStorageMockRecorder) CountOrdersByStatus(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountOrdersByStatus", reflect.TypeOf((*MockOrderStorage)(nil).CountOrdersByStatus), ctx)
+}
+
+// GetLastUserEventID mocks base method.
+func (m *MockOrderStorage) GetLastUserEventID(ctx context.Context, userID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastUserEventID", ctx, userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastUserEventID indicates an expected call of GetLastUserEventID.
+func (mr *MockOrderStorageMockRecorder) GetLastUserEventID(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastUserEventID", reflect.TypeOf((*MockOrderStorage)(nil).GetLastUserEventID), ctx, userID)
+}
+
+// GetStatement mocks base method.
+func (m *MockOrderStorage) GetStatement(ctx context.Context, userID string, from, to *time.Time) (*storage.Statement, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStatement", ctx, userID, from, to)
+	ret0, _ := ret[0].(*storage.Statement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStatement indicates an expected call of GetStatement.
+func (mr *MockOrderStorageMockRecorder) GetStatement(ctx, userID, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStatement", reflect.TypeOf((*MockOrderStorage)(nil).GetStatement), ctx, userID, from, to)
 }
 
 // GetUnprocessedOrders mocks base method.
-func (m *MockOrderStorage) GetUnprocessedOrders() ([]string, error) {
+func (m *MockOrderStorage) GetUnprocessedOrders(ctx context.Context) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUnprocessedOrders")
+	ret := m.ctrl.Call(m, "GetUnprocessedOrders", ctx)
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUnprocessedOrders indicates an expected call of GetUnprocessedOrders.
-func (mr *MockOrderStorageMockRecorder) GetUnprocessedOrders() *gomock.Call {
+func (mr *MockOrderStorageMockRecorder) GetUnprocessedOrders(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnprocessedOrders", reflect.TypeOf((*MockOrderStorage)(nil).GetUnprocessedOrders))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnprocessedOrders", reflect.TypeOf((*MockOrderStorage)(nil).GetUnprocessedOrders), ctx)
 }
 
 // GetUserBalanceAndWithdrawn mocks base method.
-func (m *MockOrderStorage) GetUserBalanceAndWithdrawn(token string) (float32, float32, error) {
+func (m *MockOrderStorage) GetUserBalanceAndWithdrawn(ctx context.Context, userID string) (float32, float32, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserBalanceAndWithdrawn", token)
+	ret := m.ctrl.Call(m, "GetUserBalanceAndWithdrawn", ctx, userID)
 	ret0, _ := ret[0].(float32)
 	ret1, _ := ret[1].(float32)
 	ret2, _ := ret[2].(error)
@@ -74,50 +137,183 @@ func (m *MockOrderStorage) GetUserBalanceAndWithdrawn(token string) (float32, fl
 }
 
 // GetUserBalanceAndWithdrawn indicates an expected call of GetUserBalanceAndWithdrawn.
-func (mr *MockOrderStorageMockRecorder) GetUserBalanceAndWithdrawn(token interface{}) *gomock.Call {
+func (mr *MockOrderStorageMockRecorder) GetUserBalanceAndWithdrawn(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserBalanceAndWithdrawn", reflect.TypeOf((*MockOrderStorage)(nil).GetUserBalanceAndWithdrawn), ctx, userID)
+}
+
+// GetUserDataVersion mocks base method.
+func (m *MockOrderStorage) GetUserDataVersion(ctx context.Context, userID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserDataVersion", ctx, userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserDataVersion indicates an expected call of GetUserDataVersion.
+func (mr *MockOrderStorageMockRecorder) GetUserDataVersion(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserDataVersion", reflect.TypeOf((*MockOrderStorage)(nil).GetUserDataVersion), ctx, userID)
+}
+
+// GetUserEvents mocks base method.
+func (m *MockOrderStorage) GetUserEvents(ctx context.Context, userID string, afterID int64, limit int) ([]storage.UserEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserEvents", ctx, userID, afterID, limit)
+	ret0, _ := ret[0].([]storage.UserEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserEvents indicates an expected call of GetUserEvents.
+func (mr *MockOrderStorageMockRecorder) GetUserEvents(ctx, userID, afterID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserEvents", reflect.TypeOf((*MockOrderStorage)(nil).GetUserEvents), ctx, userID, afterID, limit)
+}
+
+// GetUserOrder mocks base method.
+func (m *MockOrderStorage) GetUserOrder(ctx context.Context, userID, order string) (*storage.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserOrder", ctx, userID, order)
+	ret0, _ := ret[0].(*storage.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserOrder indicates an expected call of GetUserOrder.
+func (mr *MockOrderStorageMockRecorder) GetUserOrder(ctx, userID, order interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserBalanceAndWithdrawn", reflect.TypeOf((*MockOrderStorage)(nil).GetUserBalanceAndWithdrawn), token)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserOrder", reflect.TypeOf((*MockOrderStorage)(nil).GetUserOrder), ctx, userID, order)
 }
 
 // GetUserOrders mocks base method.
-func (m *MockOrderStorage) GetUserOrders(token string) ([]storage.Order, error) {
+func (m *MockOrderStorage) GetUserOrders(ctx context.Context, userID string) ([]storage.Order, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserOrders", token)
+	ret := m.ctrl.Call(m, "GetUserOrders", ctx, userID)
 	ret0, _ := ret[0].([]storage.Order)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserOrders indicates an expected call of GetUserOrders.
-func (mr *MockOrderStorageMockRecorder) GetUserOrders(token interface{}) *gomock.Call {
+func (mr *MockOrderStorageMockRecorder) GetUserOrders(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserOrders", reflect.TypeOf((*MockOrderStorage)(nil).GetUserOrders), ctx, userID)
+}
+
+// ListTransfers mocks base method.
+func (m *MockOrderStorage) ListTransfers(ctx context.Context, userID string) ([]storage.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTransfers", ctx, userID)
+	ret0, _ := ret[0].([]storage.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTransfers indicates an expected call of ListTransfers.
+func (mr *MockOrderStorageMockRecorder) ListTransfers(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTransfers", reflect.TypeOf((*MockOrderStorage)(nil).ListTransfers), ctx, userID)
+}
+
+// PruneUserEvents mocks base method.
+func (m *MockOrderStorage) PruneUserEvents(ctx context.Context, before time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PruneUserEvents", ctx, before)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PruneUserEvents indicates an expected call of PruneUserEvents.
+func (mr *MockOrderStorageMockRecorder) PruneUserEvents(ctx, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PruneUserEvents", reflect.TypeOf((*MockOrderStorage)(nil).PruneUserEvents), ctx, before)
+}
+
+// ReprocessOrder mocks base method.
+func (m *MockOrderStorage) ReprocessOrder(ctx context.Context, order string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReprocessOrder", ctx, order)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReprocessOrder indicates an expected call of ReprocessOrder.
+func (mr *MockOrderStorageMockRecorder) ReprocessOrder(ctx, order interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReprocessOrder", reflect.TypeOf((*MockOrderStorage)(nil).ReprocessOrder), ctx, order)
+}
+
+// ReverseWithdrawal mocks base method.
+func (m *MockOrderStorage) ReverseWithdrawal(ctx context.Context, id, userID, actor string, notBefore time.Time) (*storage.Withdrawn, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReverseWithdrawal", ctx, id, userID, actor, notBefore)
+	ret0, _ := ret[0].(*storage.Withdrawn)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReverseWithdrawal indicates an expected call of ReverseWithdrawal.
+func (mr *MockOrderStorageMockRecorder) ReverseWithdrawal(ctx, id, userID, actor, notBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReverseWithdrawal", reflect.TypeOf((*MockOrderStorage)(nil).ReverseWithdrawal), ctx, id, userID, actor, notBefore)
+}
+
+// StreamUserOrders mocks base method.
+func (m *MockOrderStorage) StreamUserOrders(ctx context.Context, userID string, fn func(storage.Order) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamUserOrders", ctx, userID, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamUserOrders indicates an expected call of StreamUserOrders.
+func (mr *MockOrderStorageMockRecorder) StreamUserOrders(ctx, userID, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamUserOrders", reflect.TypeOf((*MockOrderStorage)(nil).StreamUserOrders), ctx, userID, fn)
+}
+
+// TransferPoints mocks base method.
+func (m *MockOrderStorage) TransferPoints(ctx context.Context, senderID, recipientID string, sum float64, limits storage.TransferLimits) (*storage.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransferPoints", ctx, senderID, recipientID, sum, limits)
+	ret0, _ := ret[0].(*storage.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TransferPoints indicates an expected call of TransferPoints.
+func (mr *MockOrderStorageMockRecorder) TransferPoints(ctx, senderID, recipientID, sum, limits interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserOrders", reflect.TypeOf((*MockOrderStorage)(nil).GetUserOrders), token)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferPoints", reflect.TypeOf((*MockOrderStorage)(nil).TransferPoints), ctx, senderID, recipientID, sum, limits)
 }
 
 // UpdateOrdersStatus mocks base method.
-func (m *MockOrderStorage) UpdateOrdersStatus(orders []storage.Order) error {
+func (m *MockOrderStorage) UpdateOrdersStatus(ctx context.Context, orders []storage.Order) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateOrdersStatus", orders)
+	ret := m.ctrl.Call(m, "UpdateOrdersStatus", ctx, orders)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateOrdersStatus indicates an expected call of UpdateOrdersStatus.
-func (mr *MockOrderStorageMockRecorder) UpdateOrdersStatus(orders interface{}) *gomock.Call {
+func (mr *MockOrderStorageMockRecorder) UpdateOrdersStatus(ctx, orders interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrdersStatus", reflect.TypeOf((*MockOrderStorage)(nil).UpdateOrdersStatus), orders)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrdersStatus", reflect.TypeOf((*MockOrderStorage)(nil).UpdateOrdersStatus), ctx, orders)
 }
 
-// WithdrawUserPoints mocks base method.
-func (m *MockOrderStorage) WithdrawUserPoints(token, order string, sum float32) error {
+// Withdraw mocks base method.
+func (m *MockOrderStorage) Withdraw(ctx context.Context, userID, order string, sum float64, rules withdrawal.Rules) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "WithdrawUserPoints", token, order, sum)
+	ret := m.ctrl.Call(m, "Withdraw", ctx, userID, order, sum, rules)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// WithdrawUserPoints indicates an expected call of WithdrawUserPoints.
-func (mr *MockOrderStorageMockRecorder) WithdrawUserPoints(token, order, sum interface{}) *gomock.Call {
+// Withdraw indicates an expected call of Withdraw.
+func (mr *MockOrderStorageMockRecorder) Withdraw(ctx, userID, order, sum, rules interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithdrawUserPoints", reflect.TypeOf((*MockOrderStorage)(nil).WithdrawUserPoints), token, order, sum)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Withdraw", reflect.TypeOf((*MockOrderStorage)(nil).Withdraw), ctx, userID, order, sum, rules)
 }
@@ -4,9 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"github.com/jackc/pgerrcode"
-	"github.com/mkarulina/loyalty-system-service.git/internal/authentication"
-	"log"
+	"github.com/mkarulina/loyalty-system-service.git/internal/metrics"
+	"github.com/mkarulina/loyalty-system-service.git/internal/withdrawal"
 	"sync"
 	"time"
 )
@@ -18,49 +17,58 @@ type Order struct {
 	Accrual    float32
 	Withdrawn  float32
 	UploadedAt time.Time
+	// StatusChangedAt is the upload time until the accrual system reports
+	// the first status.
+	StatusChangedAt time.Time
 }
 
+const orderColumns = "user_id, number, status, accrual, withdrawn, uploaded_at, COALESCE(status_changed_at, uploaded_at)"
+
 type OrderStorage interface {
-	AddOrderNumber(order string, token string) error
-	GetUserOrders(token string) ([]Order, error)
-	GetUserBalanceAndWithdrawn(token string) (float32, float32, error)
-	WithdrawUserPoints(token string, order string, sum float32) error
-	GetUnprocessedOrders() ([]string, error)
-	UpdateOrdersStatus(orders []Order) error
+	AddOrderNumber(ctx context.Context, order string, userID string) error
+	AddOrderNumbers(ctx context.Context, orders []string, userID string) ([]AddResult, error)
+	GetUserOrders(ctx context.Context, userID string) ([]Order, error)
+	StreamUserOrders(ctx context.Context, userID string, fn func(Order) error) error
+	GetUserOrder(ctx context.Context, userID string, order string) (*Order, error)
+	GetUserBalanceAndWithdrawn(ctx context.Context, userID string) (float32, float32, error)
+	GetStatement(ctx context.Context, userID string, from *time.Time, to *time.Time) (*Statement, error)
+	Withdraw(ctx context.Context, userID string, order string, sum float64, rules withdrawal.Rules) error
+	ReverseWithdrawal(ctx context.Context, id string, userID string, actor string, notBefore time.Time) (*Withdrawn, error)
+	TransferPoints(ctx context.Context, senderID string, recipientID string, sum float64, limits TransferLimits) (*Transfer, error)
+	ListTransfers(ctx context.Context, userID string) ([]Transfer, error)
+	GetUserEvents(ctx context.Context, userID string, afterID int64, limit int) ([]UserEvent, error)
+	GetLastUserEventID(ctx context.Context, userID string) (int64, error)
+	PruneUserEvents(ctx context.Context, before time.Time) (int64, error)
+	GetUserDataVersion(ctx context.Context, userID string) (int64, error)
+	GetUnprocessedOrders(ctx context.Context) ([]string, error)
+	CountOrdersByStatus(ctx context.Context) (map[string]int, error)
+	UpdateOrdersStatus(ctx context.Context, orders []Order) error
+	ReprocessOrder(ctx context.Context, order string) error
 }
 
 type orderStorage struct {
-	mu         sync.RWMutex
-	db         *sql.DB
-	auth       authentication.Auth
-	historyStg HistoryStorage
+	mu sync.RWMutex
+	db *sql.DB
 }
 
 func NewOrderStorage() OrderStorage {
 	s := &orderStorage{
-		mu:         sync.RWMutex{},
-		db:         initDB(),
-		auth:       authentication.New(),
-		historyStg: NewHistoryStorage(),
+		mu: sync.RWMutex{},
+		db: sharedDB(),
 	}
 	return s
 }
 
-func (s *orderStorage) AddOrderNumber(order string, token string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *orderStorage) AddOrderNumber(ctx context.Context, order string, userID string) error {
+	ctx, end := observe(ctx, "AddOrderNumber")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	login, err := s.auth.GetUserLoginByToken(token, s.db)
-	if err != nil {
-		return err
-	}
-	if login == "" {
-		return errors.New("user not found")
-	}
-
 	existingOrder, err := s.db.ExecContext(ctx, "SELECT * FROM orders WHERE number = $1", order)
 	if err != nil {
 		return err
@@ -68,21 +76,21 @@ func (s *orderStorage) AddOrderNumber(order string, token string) error {
 
 	if affected, _ := existingOrder.RowsAffected(); affected > 0 {
 
-		orderByCurrentUser, err := s.db.ExecContext(ctx, "SELECT * FROM orders WHERE user_id = $2 AND number = $1", order, login)
+		orderByCurrentUser, err := s.db.ExecContext(ctx, "SELECT * FROM orders WHERE user_id = $2 AND number = $1", order, userID)
 		if err != nil {
 			return err
 		}
 
 		if affected, _ = orderByCurrentUser.RowsAffected(); affected > 0 {
-			return errors.New("duplicate")
+			return ErrOrderExists
 		}
-		return errors.New(pgerrcode.UniqueViolation)
+		return ErrOrderOwnedByAnotherUser
 	}
 
 	_, err = s.db.ExecContext(
 		ctx,
-		"INSERT INTO orders (user_id, number, uploaded_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
-		login, order, time.Now().Format(time.RFC3339),
+		"INSERT INTO orders (user_id, number, uploaded_at, status_changed_at) VALUES ($1, $2, $3, $3) ON CONFLICT DO NOTHING",
+		userID, order, time.Now().Format(time.RFC3339),
 	)
 	if err != nil {
 		return err
@@ -91,18 +99,89 @@ func (s *orderStorage) AddOrderNumber(order string, token string) error {
 	return nil
 }
 
-func (s *orderStorage) GetUserOrders(token string) ([]Order, error) {
-	var orders []Order
+// AddResult is what became of one order of a batch.
+type AddResult int
+
+const (
+	OrderAdded AddResult = iota
+	OrderAlreadyUploaded
+	OrderOfAnotherUser
+)
+
+// AddOrderNumbers inserts the orders of one user in a single transaction.
+// The returned slice follows orders. Any failure other than an order that
+// was already uploaded rolls the whole batch back and is returned as the
+// error, so the results are only ever set when everything was committed.
+func (s *orderStorage) AddOrderNumbers(ctx context.Context, orders []string, userID string) ([]AddResult, error) {
+	ctx, end := observe(ctx, "AddOrderNumbers")
+	defer end()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	login, err := s.auth.GetUserLoginByToken(token, s.db)
-	if err != nil || login == "" {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.PrepareContext(
+		ctx,
+		"INSERT INTO orders (user_id, number, uploaded_at, status_changed_at) VALUES ($1, $2, $3, $3) ON CONFLICT (number) DO NOTHING",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer insert.Close()
+
+	uploadedAt := time.Now().Format(time.RFC3339)
+	results := make([]AddResult, len(orders))
+
+	for i, order := range orders {
+		result, err := insert.ExecContext(ctx, userID, order, uploadedAt)
+		if err != nil {
+			return nil, err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			continue
+		}
+
+		var owner string
+		err = tx.QueryRowContext(ctx, "SELECT user_id FROM orders WHERE number = $1", order).Scan(&owner)
+		if err != nil {
+			return nil, err
+		}
+		if owner == userID {
+			results[i] = OrderAlreadyUploaded
+		} else {
+			results[i] = OrderOfAnotherUser
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	ordersRows, err := s.db.QueryContext(ctx, "SELECT * FROM orders WHERE user_id = $1 ORDER BY uploaded_at ASC", login)
+	return results, nil
+}
+
+func (s *orderStorage) GetUserOrders(ctx context.Context, userID string) ([]Order, error) {
+	ctx, end := observe(ctx, "GetUserOrders")
+	defer end()
+
+	var orders []Order
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	ordersRows, err := s.db.QueryContext(
+		ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE user_id = $1 ORDER BY uploaded_at ASC",
+		userID,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +192,7 @@ func (s *orderStorage) GetUserOrders(token string) ([]Order, error) {
 	for ordersRows.Next() {
 		var o Order
 
-		err = ordersRows.Scan(&o.UserID, &o.Number, &o.Status, &o.Accrual, &o.Withdrawn, &o.UploadedAt)
+		err = ordersRows.Scan(&o.UserID, &o.Number, &o.Status, &o.Accrual, &o.Withdrawn, &o.UploadedAt, &o.StatusChangedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -123,77 +202,264 @@ func (s *orderStorage) GetUserOrders(token string) ([]Order, error) {
 	return orders, nil
 }
 
-func (s *orderStorage) GetUserBalanceAndWithdrawn(token string) (float32, float32, error) {
-	var withdrawn float32
-	var accrual float32
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// StreamUserOrders calls fn for every order of the user as rows arrive
+// from the cursor. ctx bounds the whole export instead of the usual five
+// seconds; an error from fn stops the query and is returned.
+func (s *orderStorage) StreamUserOrders(ctx context.Context, userID string, fn func(Order) error) error {
+	ctx, end := observe(ctx, "StreamUserOrders")
+	defer end()
 
-	login, err := s.auth.GetUserLoginByToken(token, s.db)
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE user_id = $1 ORDER BY uploaded_at ASC",
+		userID,
+	)
 	if err != nil {
-		return 0, 0, err
+		return err
 	}
-	if login == "" {
-		return 0, 0, errors.New("user not found")
+	defer rows.Close()
+
+	for rows.Next() {
+		var o Order
+
+		err = rows.Scan(&o.UserID, &o.Number, &o.Status, &o.Accrual, &o.Withdrawn, &o.UploadedAt, &o.StatusChangedAt)
+		if err != nil {
+			return err
+		}
+		if err = fn(o); err != nil {
+			return err
+		}
 	}
 
-	result, err := s.db.QueryContext(ctx, "SELECT SUM(accrual), SUM(withdrawn) FROM orders WHERE user_id = $1", login)
+	return rows.Err()
+}
+
+// GetUserOrder returns ErrOrderNotFound for an unknown number and
+// ErrOrderOwnedByAnotherUser for an order of another user.
+func (s *orderStorage) GetUserOrder(ctx context.Context, userID string, order string) (*Order, error) {
+	ctx, end := observe(ctx, "GetUserOrder")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var o Order
+	err := s.db.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders WHERE number = $1", order).
+		Scan(&o.UserID, &o.Number, &o.Status, &o.Accrual, &o.Withdrawn, &o.UploadedAt, &o.StatusChangedAt)
 	if err != nil {
-		return 0, 0, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
 	}
-	if result.Err() != nil {
-		return 0, 0, result.Err()
+	if o.UserID != userID {
+		return nil, ErrOrderOwnedByAnotherUser
 	}
 
-	for result.Next() {
-		err = result.Scan(&accrual, &withdrawn)
-		if err != nil {
-			return 0, 0, err
-		}
-	}
+	return &o, nil
+}
 
-	balance := accrual - withdrawn
+func (s *orderStorage) GetUserBalanceAndWithdrawn(ctx context.Context, userID string) (float32, float32, error) {
+	ctx, end := observe(ctx, "GetUserBalanceAndWithdrawn")
+	defer end()
+
+	var balance float32
+	var withdrawn float32
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, balanceQuery, userID).Scan(&balance, &withdrawn)
+	if err != nil {
+		return 0, 0, err
+	}
 
 	return balance, withdrawn, nil
 }
 
-func (s *orderStorage) WithdrawUserPoints(token string, order string, sum float32) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// Withdraw withdraws sum points of the user against the order. The user
+// row is locked first, the same lock TransferPoints takes, so the usage
+// and the balance the rules are checked against can't change until the
+// withdrawal is recorded. A broken rule is returned as *withdrawal.Rejection;
+// the balance and the owner of the order are checked afterwards and fail
+// with ErrInsufficientFunds and ErrOrderOwnedByAnotherUser. An order the
+// user has not uploaded yet is added.
+func (s *orderStorage) Withdraw(ctx context.Context, userID string, order string, sum float64, rules withdrawal.Rules) error {
+	ctx, end := observe(ctx, "Withdraw")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	login, err := s.auth.GetUserLoginByToken(token, s.db)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	if login == "" {
-		return errors.New("user not found")
+	defer tx.Rollback()
+
+	usage := withdrawal.Usage{}
+	err = tx.QueryRowContext(ctx, "SELECT created_at FROM users WHERE id = $1::bigint FOR UPDATE", userID).Scan(&usage.RegisteredAt)
+	if err != nil {
+		return err
 	}
 
-	result, err := s.db.ExecContext(ctx, "UPDATE orders SET withdrawn = $1 WHERE user_id = $2 AND number = $3", sum, login, order)
+	err = tx.QueryRowContext(ctx, `
+SELECT COALESCE(SUM(sum) FILTER (WHERE user_id = $1 AND uploaded_at >= date_trunc('day', now())), 0),
+       COALESCE(SUM(sum) FILTER (WHERE user_id = $1 AND uploaded_at >= date_trunc('month', now())), 0),
+       COUNT(*) FILTER (WHERE order_number = $2)
+FROM withdrawals_history
+WHERE (user_id = $1 OR order_number = $2) AND reversed_at IS NULL`,
+		userID, order,
+	).Scan(&usage.WithdrawnToday, &usage.WithdrawnThisMonth, &usage.OrderWithdrawals)
 	if err != nil {
 		return err
 	}
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return errors.New("order not found")
+
+	if rejection := rules.Check(order, sum, usage, time.Now()); rejection != nil {
+		return rejection
+	}
+
+	var balance, withdrawn float64
+	if err := tx.QueryRowContext(ctx, balanceQuery, userID).Scan(&balance, &withdrawn); err != nil {
+		return err
+	}
+	if balance < sum {
+		return ErrInsufficientFunds
+	}
+
+	now := time.Now().Format(time.RFC3339)
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO orders (user_id, number, uploaded_at, status_changed_at) VALUES ($1, $2, $3, $3) ON CONFLICT (number) DO NOTHING",
+		userID, order, now,
+	)
+	if err != nil {
+		return err
 	}
 
-	s.mu.Unlock()
+	result, err := tx.ExecContext(ctx, "UPDATE orders SET withdrawn = withdrawn + $1 WHERE user_id = $2 AND number = $3", sum, userID, order)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrOrderOwnedByAnotherUser
+	}
 
-	err = s.historyStg.AddWithdrawnHistory(login, order, sum)
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO withdrawals_history (user_id, order_number, sum, uploaded_at) VALUES ($1, $2, $3, $4)",
+		userID, order, sum, now,
+	)
 	if err != nil {
-		log.Println("can't add withdrawn history")
+		return err
+	}
+
+	if err := addBalanceEvent(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
 	}
 
+	metrics.PointsWithdrawn.Add(sum)
 	return nil
 }
 
-func (s *orderStorage) GetUnprocessedOrders() ([]string, error) {
+// ReverseWithdrawal cancels a withdrawal and gives the points back: the
+// withdrawal is marked reversed, a compensating entry is recorded and the
+// order's withdrawn sum is decreased, all in one transaction. A non-empty
+// userID limits the call to that user's withdrawals; a non-zero notBefore
+// refuses withdrawals processed earlier with ErrReversalWindowClosed. id
+// must be numeric; the handlers answer anything else with 404 themselves.
+func (s *orderStorage) ReverseWithdrawal(ctx context.Context, id string, userID string, actor string, notBefore time.Time) (*Withdrawn, error) {
+	ctx, end := observe(ctx, "ReverseWithdrawal")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	withdrawn, err := scanWithdrawn(tx.QueryRowContext(
+		ctx,
+		"SELECT "+withdrawnColumns+" FROM withdrawals_history WHERE id = $1::bigint FOR UPDATE",
+		id,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWithdrawalNotFound
+		}
+		return nil, err
+	}
+	if userID != "" && withdrawn.UserID != userID {
+		return nil, ErrWithdrawalNotFound
+	}
+	if withdrawn.ReversedAt != nil {
+		return nil, ErrWithdrawalReversed
+	}
+	if !notBefore.IsZero() && withdrawn.ProcessedAt.Before(notBefore) {
+		return nil, ErrReversalWindowClosed
+	}
+
+	var reversedAt time.Time
+	err = tx.QueryRowContext(
+		ctx,
+		"UPDATE withdrawals_history SET reversed_at = now() WHERE id = $1::bigint RETURNING reversed_at",
+		id,
+	).Scan(&reversedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO withdrawal_reversals (withdrawal_id, user_id, order_number, sum, actor) VALUES ($1::bigint, $2, $3, $4, $5)",
+		id, withdrawn.UserID, withdrawn.OrderNumber, withdrawn.Sum, actor,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE orders SET withdrawn = GREATEST(withdrawn - $1, 0) WHERE user_id = $2 AND number = $3",
+		withdrawn.Sum, withdrawn.UserID, withdrawn.OrderNumber,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addBalanceEvent(ctx, tx, withdrawn.UserID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	withdrawn.ReversedAt = &reversedAt
+	return &withdrawn, nil
+}
+
+func (s *orderStorage) GetUnprocessedOrders(ctx context.Context) ([]string, error) {
+	ctx, end := observe(ctx, "GetUnprocessedOrders")
+	defer end()
+
 	var orders []string
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	ordersRows, err := s.db.QueryContext(ctx, "SELECT number FROM orders WHERE status != 'PROCESSED'")
@@ -217,24 +483,136 @@ func (s *orderStorage) GetUnprocessedOrders() ([]string, error) {
 	return orders, nil
 }
 
-func (s *orderStorage) UpdateOrdersStatus(orders []Order) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// CountOrdersByStatus returns the number of orders of all users by status.
+func (s *orderStorage) CountOrdersByStatus(ctx context.Context) (map[string]int, error) {
+	ctx, end := observe(ctx, "CountOrdersByStatus")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	update, err := s.db.PrepareContext(ctx, "UPDATE orders SET status = $1, accrual = $2 WHERE number = $3")
+	rows, err := s.db.QueryContext(ctx, "SELECT status, COUNT(*) FROM orders GROUP BY status")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer update.Close()
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (s *orderStorage) UpdateOrdersStatus(ctx context.Context, orders []Order) error {
+	ctx, end := observe(ctx, "UpdateOrdersStatus")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the owners are locked up front in id order, like in TransferPoints,
+	// rather than in the order of the batch by the data version trigger
+	numbers := make([]string, 0, len(orders))
 	for _, order := range orders {
-		_, err = update.ExecContext(ctx, order.Status, order.Accrual, order.Number)
+		numbers = append(numbers, order.Number)
+	}
+	_, err = tx.ExecContext(ctx, `
+SELECT id FROM users WHERE id IN (SELECT user_id::bigint FROM orders WHERE number = ANY($1))
+ORDER BY id FOR UPDATE`, numbers)
+	if err != nil {
+		return err
+	}
+
+	// orders that already have the status and accrual are left alone, so
+	// that only real changes become events; the old accrual is returned for
+	// the accrued points metric
+	update, err := tx.PrepareContext(ctx, `
+UPDATE orders o SET status_changed_at = CASE WHEN o.status IS DISTINCT FROM $1 THEN now() ELSE o.status_changed_at END, status = $1, accrual = $2
+FROM (SELECT number, accrual FROM orders WHERE number = $3 FOR UPDATE) old
+WHERE o.number = old.number AND (o.status IS DISTINCT FROM $1 OR o.accrual IS DISTINCT FROM $2)
+RETURNING o.user_id, o.status_changed_at, COALESCE(old.accrual, 0)`)
+	if err != nil {
+		return err
+	}
+	defer update.Close()
+
+	var changedUsers []string
+	changed := map[string]bool{}
+	var accrued float32
+
+	for _, order := range orders {
+		event := OrderEvent{Number: order.Number, Status: order.Status, Accrual: order.Accrual}
+		var userID string
+		var oldAccrual float32
+
+		err = update.QueryRowContext(ctx, order.Status, order.Accrual, order.Number).Scan(&userID, &event.StatusChangedAt, &oldAccrual)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
 		if err != nil {
 			return err
 		}
+
+		if err := addUserEvent(ctx, tx, userID, EventOrder, event); err != nil {
+			return err
+		}
+		if order.Accrual > oldAccrual {
+			accrued += order.Accrual - oldAccrual
+		}
+		if !changed[userID] {
+			changed[userID] = true
+			changedUsers = append(changedUsers, userID)
+		}
+	}
+
+	for _, userID := range changedUsers {
+		if err := addBalanceEvent(ctx, tx, userID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	metrics.PointsAccrued.Add(float64(accrued))
+	return nil
+}
+
+// ReprocessOrder puts the order back into the queue of the accrual poller.
+func (s *orderStorage) ReprocessOrder(ctx context.Context, order string) error {
+	ctx, end := observe(ctx, "ReprocessOrder")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.ExecContext(ctx, "UPDATE orders SET status = 'NEW', status_changed_at = now() WHERE number = $1", order)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrOrderNotFound
 	}
 
 	return nil
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Kinds of statement lines.
+const (
+	StatementAccrual     = "accrual"
+	StatementWithdrawal  = "withdrawal"
+	StatementReversal    = "reversal"
+	StatementTransferIn  = "transfer_in"
+	StatementTransferOut = "transfer_out"
+)
+
+type StatementLine struct {
+	At          time.Time
+	Kind        string
+	OrderNumber string
+	// Amount is negative for withdrawals and sent transfers. OrderNumber is
+	// empty for transfers.
+	Amount  float64
+	Balance float64
+}
+
+type Statement struct {
+	OpeningBalance float64
+	Lines          []StatementLine
+	ClosingBalance float64
+}
+
+// statementQuery merges processed accruals, withdrawals, their reversals and
+// the transfers of the user and computes the running balance with a window
+// function. The opening balance is joined from the left so that a period
+// without lines still yields one row carrying it.
+const statementQuery = `
+WITH entries AS (
+    SELECT COALESCE(status_changed_at, uploaded_at) AS at, 'accrual' AS kind, number AS order_number, accrual AS amount
+    FROM orders
+    WHERE user_id = $1 AND status = 'PROCESSED' AND accrual > 0
+    UNION ALL
+    SELECT uploaded_at, 'withdrawal', order_number, -sum
+    FROM withdrawals_history
+    WHERE user_id = $1
+    UNION ALL
+    SELECT created_at, 'reversal', order_number, sum
+    FROM withdrawal_reversals
+    WHERE user_id = $1
+    UNION ALL
+    SELECT created_at, CASE WHEN recipient_id = $1 THEN 'transfer_in' ELSE 'transfer_out' END, '',
+           CASE WHEN recipient_id = $1 THEN sum ELSE -sum END
+    FROM transfers
+    WHERE sender_id = $1 OR recipient_id = $1
+), opening AS (
+    SELECT COALESCE(SUM(amount), 0) AS balance
+    FROM entries
+    WHERE $2::timestamp IS NOT NULL AND at < $2::timestamp
+)
+SELECT o.balance, e.at, e.kind, e.order_number, e.amount,
+       o.balance + SUM(e.amount) OVER (ORDER BY e.at, e.kind, e.order_number ROWS UNBOUNDED PRECEDING)
+FROM opening o
+LEFT JOIN entries e ON ($2::timestamp IS NULL OR e.at >= $2::timestamp) AND ($3::timestamp IS NULL OR e.at < $3::timestamp)
+ORDER BY e.at, e.kind, e.order_number`
+
+// GetStatement returns the lines in [from, to). A nil bound leaves that side
+// of the period open.
+func (s *orderStorage) GetStatement(ctx context.Context, userID string, from *time.Time, to *time.Time) (*Statement, error) {
+	ctx, end := observe(ctx, "GetStatement")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var fromParam, toParam sql.NullTime
+	if from != nil {
+		fromParam = sql.NullTime{Time: *from, Valid: true}
+	}
+	if to != nil {
+		toParam = sql.NullTime{Time: *to, Valid: true}
+	}
+
+	rows, err := s.db.QueryContext(ctx, statementQuery, userID, fromParam, toParam)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statement := &Statement{}
+	for rows.Next() {
+		var (
+			at          sql.NullTime
+			kind        sql.NullString
+			orderNumber sql.NullString
+			amount      sql.NullFloat64
+			balance     sql.NullFloat64
+		)
+
+		err = rows.Scan(&statement.OpeningBalance, &at, &kind, &orderNumber, &amount, &balance)
+		if err != nil {
+			return nil, err
+		}
+		if !at.Valid {
+			continue
+		}
+
+		statement.Lines = append(statement.Lines, StatementLine{
+			At:          at.Time,
+			Kind:        kind.String,
+			OrderNumber: orderNumber.String,
+			Amount:      amount.Float64,
+			Balance:     balance.Float64,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statement.ClosingBalance = statement.OpeningBalance
+	if n := len(statement.Lines); n > 0 {
+		statement.ClosingBalance = statement.Lines[n-1].Balance
+	}
+
+	return statement, nil
+}
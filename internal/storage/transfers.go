@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Transfer struct {
+	ID          string
+	SenderID    string
+	RecipientID string
+	// Logins are encoded the way they are stored in users.
+	SenderLogin    string
+	RecipientLogin string
+	Sum            float64
+	CreatedAt      time.Time
+}
+
+// TransferLimits are checked inside the transfer transaction. Zero values
+// disable the check.
+type TransferLimits struct {
+	// Daily caps the sum the sender may transfer since the start of the day.
+	Daily float64
+	// MinAccountAge is how long the sender must have been registered.
+	MinAccountAge time.Duration
+}
+
+// maxListedTransfers bounds ListTransfers without a user.
+const maxListedTransfers = 500
+
+// balanceQuery computes the balance of $1: processed accruals minus
+// withdrawals, plus the points received and minus the points sent.
+const balanceQuery = `
+SELECT (SELECT COALESCE(SUM(accrual), 0) - COALESCE(SUM(withdrawn), 0) FROM orders WHERE user_id = $1)
+     + (SELECT COALESCE(SUM(CASE WHEN recipient_id = $1 THEN sum ELSE -sum END), 0) FROM transfers WHERE sender_id = $1 OR recipient_id = $1),
+       (SELECT COALESCE(SUM(withdrawn), 0) FROM orders WHERE user_id = $1)`
+
+const transferColumns = `t.id::text, t.sender_id, t.recipient_id, COALESCE(s.login, ''), COALESCE(r.login, ''), t.sum, t.created_at
+FROM transfers t
+LEFT JOIN users s ON s.id = t.sender_id::bigint
+LEFT JOIN users r ON r.id = t.recipient_id::bigint`
+
+// TransferPoints moves sum points from the sender to the recipient. Both
+// users are locked for the duration of the transaction, so concurrent
+// transfers of either of them see each other's effect on the balance and
+// the daily total.
+func (s *orderStorage) TransferPoints(ctx context.Context, senderID string, recipientID string, sum float64, limits TransferLimits) (*Transfer, error) {
+	ctx, end := observe(ctx, "TransferPoints")
+	defer end()
+
+	if senderID == recipientID {
+		return nil, ErrSelfTransfer
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT id::text, created_at FROM users WHERE id IN ($1::bigint, $2::bigint) AND deleted_at IS NULL ORDER BY id FOR UPDATE",
+		senderID, recipientID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	registered := map[string]time.Time{}
+	for rows.Next() {
+		var id string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &createdAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		registered[id] = createdAt
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := registered[recipientID]; !ok {
+		return nil, ErrRecipientNotFound
+	}
+	senderCreatedAt, ok := registered[senderID]
+	if !ok {
+		return nil, ErrRecipientNotFound
+	}
+	if limits.MinAccountAge > 0 && time.Since(senderCreatedAt) < limits.MinAccountAge {
+		return nil, ErrAccountTooNew
+	}
+
+	var balance, withdrawn float64
+	if err := tx.QueryRowContext(ctx, balanceQuery, senderID).Scan(&balance, &withdrawn); err != nil {
+		return nil, err
+	}
+	if balance < sum {
+		return nil, ErrInsufficientFunds
+	}
+
+	if limits.Daily > 0 {
+		var sentToday float64
+		err = tx.QueryRowContext(
+			ctx,
+			"SELECT COALESCE(SUM(sum), 0) FROM transfers WHERE sender_id = $1 AND created_at >= date_trunc('day', now())",
+			senderID,
+		).Scan(&sentToday)
+		if err != nil {
+			return nil, err
+		}
+		if sentToday+sum > limits.Daily {
+			return nil, ErrDailyTransferLimit
+		}
+	}
+
+	transfer := Transfer{SenderID: senderID, RecipientID: recipientID, Sum: sum}
+	err = tx.QueryRowContext(
+		ctx,
+		"INSERT INTO transfers (sender_id, recipient_id, sum) VALUES ($1, $2, $3) RETURNING id::text, created_at",
+		senderID, recipientID, sum,
+	).Scan(&transfer.ID, &transfer.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userID := range []string{senderID, recipientID} {
+		if err := addBalanceEvent(ctx, tx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &transfer, nil
+}
+
+// ListTransfers returns the transfers sent or received by the user, newest
+// first. An empty userID lists the latest transfers of everybody.
+func (s *orderStorage) ListTransfers(ctx context.Context, userID string) ([]Transfer, error) {
+	ctx, end := observe(ctx, "ListTransfers")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var rows *sql.Rows
+	var err error
+	if userID == "" {
+		rows, err = s.db.QueryContext(ctx, "SELECT "+transferColumns+" ORDER BY t.created_at DESC, t.id DESC LIMIT $1", maxListedTransfers)
+	} else {
+		rows, err = s.db.QueryContext(
+			ctx,
+			"SELECT "+transferColumns+" WHERE t.sender_id = $1 OR t.recipient_id = $1 ORDER BY t.created_at DESC, t.id DESC",
+			userID,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []Transfer
+	for rows.Next() {
+		t := Transfer{}
+		err = rows.Scan(&t.ID, &t.SenderID, &t.RecipientID, &t.SenderLogin, &t.RecipientLogin, &t.Sum, &t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// GetUserDataVersion returns the version of the user's orders, withdrawals
+// and transfers. Database triggers increase it on every change, so equal
+// versions mean equal data. It is 0 for an unknown user.
+func (s *orderStorage) GetUserDataVersion(ctx context.Context, userID string) (int64, error) {
+	ctx, end := observe(ctx, "GetUserDataVersion")
+	defer end()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var version int64
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(data_version), 0) FROM users WHERE id = $1::bigint", userID).Scan(&version)
+	return version, err
+}
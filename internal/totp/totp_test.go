@@ -0,0 +1,67 @@
+package totp
+
+import (
+	"encoding/base32"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238, appendix B, truncated to six digits.
+func Test_Code_rfc6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range tests {
+		got, err := Code(secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		require.Equal(t, want, got, unix)
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1655000000, 0)
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+
+	require.True(t, Validate(secret, code, now))
+	require.True(t, Validate(secret, code, now.Add(Period)))
+	require.True(t, Validate(secret, " "+code+" ", now.Add(-Period)))
+	require.False(t, Validate(secret, code, now.Add(3*Period)))
+	require.False(t, Validate(secret, "12345", now))
+	require.False(t, Validate("not base32!", code, now))
+}
+
+func Test_Match(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1655000000, 0)
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+
+	counter, ok := Match(secret, code, now.Add(Period))
+	require.True(t, ok)
+	require.Equal(t, now.Unix()/30, counter)
+
+	_, ok = Match(secret, code, now.Add(3*Period))
+	require.False(t, ok)
+}
+
+func Test_URI(t *testing.T) {
+	uri := URI("Gophermart", "alice", "JBSWY3DPEHPK3PXP")
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/Gophermart:alice?"))
+	require.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	require.Contains(t, uri, "issuer=Gophermart")
+}
@@ -0,0 +1,158 @@
+// Package tracing sets up OpenTelemetry tracing of the service and the
+// spans of incoming HTTP requests.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+)
+
+const (
+	serviceName     = "gophermart"
+	instrumentation = "github.com/mkarulina/loyalty-system-service.git"
+)
+
+// Exporters, set with TRACING_EXPORTER.
+const (
+	ExporterNone = ""
+	// ExporterOTLP sends spans over OTLP/HTTP; the endpoint, headers and
+	// so on come from the standard OTEL_EXPORTER_OTLP_* variables.
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans as JSON to TRACING_FILE, or to stdout
+	// when it is empty. It needs no collector, so it is meant for local
+	// debugging.
+	ExporterStdout = "stdout"
+)
+
+// Setup installs the W3C trace context propagator and the tracer provider
+// of TRACING_EXPORTER. With no exporter spans are not recorded, but the
+// trace context of incoming requests is still passed on to the accrual
+// system. The returned function flushes the spans left and must be called
+// before exit.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	noop := func(context.Context) error { return nil }
+
+	exporter, closeOutput, err := newExporter(ctx, viper.GetString("TRACING_EXPORTER"))
+	if err != nil || exporter == nil {
+		return noop, err
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		closeOutput()
+		return noop, err
+	}
+
+	// the sampler follows OTEL_TRACES_SAMPLER, parent based always-on by default
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeErr := closeOutput(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
+
+// newExporter returns the exporter and the function closing the file it
+// writes to, if any.
+func newExporter(ctx context.Context, name string) (sdktrace.SpanExporter, func() error, error) {
+	noop := func() error { return nil }
+
+	switch name {
+	case ExporterNone:
+		return nil, noop, nil
+	case ExporterOTLP:
+		exporter, err := otlptracehttp.New(ctx)
+		return exporter, noop, err
+	case ExporterStdout:
+		path := viper.GetString("TRACING_FILE")
+		if path == "" {
+			exporter, err := stdouttrace.New()
+			return exporter, noop, err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, noop, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, noop, err
+		}
+		return exporter, file.Close, nil
+	default:
+		return nil, noop, fmt.Errorf("unknown tracing exporter %q", name)
+	}
+}
+
+// Tracer returns the tracer of the service.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Middleware starts a server span for each request, continuing the trace
+// of the caller when the request carries a traceparent header. The span is
+// named after the chi route pattern once the request has been routed;
+// requests that match no route keep the bare method as their name.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// Inject adds the trace context of ctx to the headers of an outgoing
+// request.
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
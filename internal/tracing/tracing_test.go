@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"github.com/go-chi/chi"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withRecorder installs a tracer provider keeping the ended spans in memory.
+func withRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	_, err := Setup(context.Background())
+	require.NoError(t, err)
+	return recorder
+}
+
+func Test_Middleware(t *testing.T) {
+	recorder := withRecorder(t)
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/api/user/orders/{number}", func(w http.ResponseWriter, r *http.Request) {
+		require.True(t, trace.SpanContextFromContext(r.Context()).IsValid())
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		span   string
+		status int
+	}{
+		{name: "routed", path: "/api/user/orders/79927398713", span: "GET /api/user/orders/{number}", status: http.StatusInternalServerError},
+		{name: "unmatched", path: "/unknown", span: "GET", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			span := spans[len(spans)-1]
+			require.Equal(t, tt.span, span.Name())
+			require.Equal(t, trace.SpanKindServer, span.SpanKind())
+			require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+			require.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+			require.Contains(t, span.Attributes(), semconv.HTTPResponseStatusCode(tt.status))
+			if tt.status >= http.StatusInternalServerError {
+				require.Equal(t, codes.Error, span.Status().Code)
+			} else {
+				require.Equal(t, codes.Unset, span.Status().Code)
+			}
+		})
+	}
+}
+
+func Test_Setup(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	viper.Set("TRACING_EXPORTER", "zipkin")
+	_, err := Setup(context.Background())
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "spans.json")
+	viper.Set("TRACING_EXPORTER", ExporterStdout)
+	viper.Set("TRACING_FILE", path)
+	shutdown, err := Setup(context.Background())
+	require.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "accrual.poll")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"Name":"accrual.poll"`)
+	require.Contains(t, string(data), `"Value":"gophermart"`)
+}
@@ -0,0 +1,192 @@
+package validation
+
+import (
+	_ "embed"
+	"fmt"
+	"github.com/spf13/viper"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	CodeRequired       = "required"
+	CodeTooShort       = "too_short"
+	CodeTooLong        = "too_long"
+	CodeInvalidChars   = "invalid_characters"
+	CodeMissingUpper   = "missing_uppercase"
+	CodeMissingLower   = "missing_lowercase"
+	CodeMissingDigit   = "missing_digit"
+	CodeMissingSymbol  = "missing_symbol"
+	CodeCommonPassword = "common_password"
+	CodeSameAsLogin    = "same_as_login"
+
+	loginMinLength = 3
+	loginMaxLength = 64
+)
+
+var loginPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._@-]*$`)
+
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+var commonPasswords = func() map[string]struct{} {
+	m := map[string]struct{}{}
+	for _, p := range strings.Split(commonPasswordsList, "\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			m[p] = struct{}{}
+		}
+	}
+	return m
+}()
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	DenyCommon    bool
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:    8,
+		MaxLength:    128,
+		RequireDigit: true,
+		DenyCommon:   true,
+	}
+}
+
+// PasswordPolicyFromConfig overrides the defaults with the PASSWORD_*
+// settings that are present in the configuration.
+func PasswordPolicyFromConfig() PasswordPolicy {
+	p := DefaultPasswordPolicy()
+
+	if viper.IsSet("PASSWORD_MIN_LENGTH") {
+		p.MinLength = viper.GetInt("PASSWORD_MIN_LENGTH")
+	}
+	if viper.IsSet("PASSWORD_MAX_LENGTH") {
+		p.MaxLength = viper.GetInt("PASSWORD_MAX_LENGTH")
+	}
+	if viper.IsSet("PASSWORD_REQUIRE_UPPER") {
+		p.RequireUpper = viper.GetBool("PASSWORD_REQUIRE_UPPER")
+	}
+	if viper.IsSet("PASSWORD_REQUIRE_LOWER") {
+		p.RequireLower = viper.GetBool("PASSWORD_REQUIRE_LOWER")
+	}
+	if viper.IsSet("PASSWORD_REQUIRE_DIGIT") {
+		p.RequireDigit = viper.GetBool("PASSWORD_REQUIRE_DIGIT")
+	}
+	if viper.IsSet("PASSWORD_REQUIRE_SYMBOL") {
+		p.RequireSymbol = viper.GetBool("PASSWORD_REQUIRE_SYMBOL")
+	}
+	if viper.IsSet("PASSWORD_DENY_COMMON") {
+		p.DenyCommon = viper.GetBool("PASSWORD_DENY_COMMON")
+	}
+
+	return p
+}
+
+// NormalizeLogin trims surrounding spaces and folds the case, so that
+// "Alice " and "alice" name the same account.
+func NormalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+// ValidateLogin checks an already normalised login.
+func ValidateLogin(login string) Errors {
+	length := utf8.RuneCountInString(login)
+
+	switch {
+	case length == 0:
+		return Errors{{Field: "login", Code: CodeRequired, Message: "login is required"}}
+	case length < loginMinLength:
+		return Errors{{Field: "login", Code: CodeTooShort, Message: fmt.Sprintf("login must be at least %d characters", loginMinLength)}}
+	case length > loginMaxLength:
+		return Errors{{Field: "login", Code: CodeTooLong, Message: fmt.Sprintf("login must be at most %d characters", loginMaxLength)}}
+	case !loginPattern.MatchString(login):
+		return Errors{{Field: "login", Code: CodeInvalidChars, Message: "login may contain only latin letters, digits and . _ @ -, and must start with a letter or digit"}}
+	}
+
+	return nil
+}
+
+// Validate checks password against the policy. login is the normalised
+// login of the account and is used to reject passwords equal to it.
+func (p PasswordPolicy) Validate(password string, login string) Errors {
+	var errs Errors
+
+	add := func(code, message string) {
+		errs = append(errs, FieldError{Field: "password", Code: code, Message: message})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length == 0 {
+		add(CodeRequired, "password is required")
+		return errs
+	}
+	if length < p.MinLength {
+		add(CodeTooShort, fmt.Sprintf("password must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(CodeTooLong, fmt.Sprintf("password must be at most %d characters", p.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		add(CodeMissingUpper, "password must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		add(CodeMissingLower, "password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		add(CodeMissingDigit, "password must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add(CodeMissingSymbol, "password must contain a symbol")
+	}
+
+	folded := strings.ToLower(password)
+	if p.DenyCommon {
+		if _, ok := commonPasswords[folded]; ok {
+			add(CodeCommonPassword, "password is too common")
+		}
+	}
+	if login != "" && folded == login {
+		add(CodeSameAsLogin, "password must differ from the login")
+	}
+
+	return errs
+}
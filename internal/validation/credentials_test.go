@@ -0,0 +1,49 @@
+package validation
+
+import (
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func Test_NormalizeLogin(t *testing.T) {
+	require.Equal(t, "alice", NormalizeLogin("  Alice\t"))
+}
+
+func Test_ValidateLogin(t *testing.T) {
+	require.Empty(t, ValidateLogin("alice.smith@shop"))
+	require.Equal(t, CodeTooShort, ValidateLogin("al")[0].Code)
+	require.Equal(t, CodeInvalidChars, ValidateLogin("-alice")[0].Code)
+	require.Equal(t, CodeInvalidChars, ValidateLogin("алиса")[0].Code)
+}
+
+func Test_PasswordPolicy_Validate(t *testing.T) {
+	p := PasswordPolicy{MinLength: 10, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true, DenyCommon: true}
+
+	require.Empty(t, p.Validate("Correct-horse-42", "alice"))
+
+	codes := func(errs Errors) []string {
+		var c []string
+		for _, e := range errs {
+			c = append(c, e.Code)
+		}
+		return c
+	}
+
+	require.Equal(t, []string{CodeTooShort, CodeMissingUpper, CodeMissingSymbol, CodeCommonPassword}, codes(p.Validate("qwerty123", "alice")))
+	require.Equal(t, []string{CodeSameAsLogin}, codes(DefaultPasswordPolicy().Validate("Alice2000", "alice2000")))
+}
+
+func Test_PasswordPolicyFromConfig(t *testing.T) {
+	defer viper.Reset()
+
+	require.Equal(t, DefaultPasswordPolicy(), PasswordPolicyFromConfig())
+
+	viper.Set("PASSWORD_MIN_LENGTH", 12)
+	viper.Set("PASSWORD_DENY_COMMON", false)
+
+	p := PasswordPolicyFromConfig()
+	require.Equal(t, 12, p.MinLength)
+	require.False(t, p.DenyCommon)
+	require.True(t, p.RequireDigit)
+}
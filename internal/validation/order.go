@@ -0,0 +1,39 @@
+package validation
+
+// OrderDigits reports whether the order number is a non-empty string of
+// ASCII digits.
+func OrderDigits(number string) bool {
+	if number == "" {
+		return false
+	}
+	for i := 0; i < len(number); i++ {
+		if number[i] < '0' || number[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Luhn reports whether the order number passes the Luhn check. It works on
+// the digits themselves, so numbers too long for an int are checked too;
+// anything but digits fails.
+func Luhn(number string) bool {
+	if !OrderDigits(number) {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
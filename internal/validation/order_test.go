@@ -0,0 +1,18 @@
+package validation
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func Test_Luhn(t *testing.T) {
+	require.True(t, Luhn("79927398713"))
+	require.True(t, Luhn("12345678903"))
+	require.False(t, Luhn("79927398710"))
+	// longer than an int64 can hold
+	require.True(t, Luhn("123456789012345678901234567891"))
+	require.False(t, Luhn("123456789012345678901234567890"))
+	require.False(t, Luhn(""))
+	require.False(t, Luhn("-79927398713"))
+	require.False(t, Luhn("7992 7398 713"))
+}
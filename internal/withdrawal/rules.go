@@ -0,0 +1,143 @@
+// Package withdrawal decides whether a withdrawal of points is allowed.
+package withdrawal
+
+import (
+	"fmt"
+	"github.com/mkarulina/loyalty-system-service.git/internal/problem"
+	"github.com/mkarulina/loyalty-system-service.git/internal/validation"
+	"github.com/spf13/viper"
+	"time"
+)
+
+// Codes of the rejections, one per rule.
+const (
+	CodeInvalidOrder = "invalid_order_number"
+	CodeInvalidSum   = "invalid_withdrawal_sum"
+	CodeBelowMinimum = "withdrawal_below_minimum"
+	CodeAboveMaximum = "withdrawal_above_maximum"
+	CodeDailyLimit   = "daily_withdrawal_limit_exceeded"
+	CodeMonthlyLimit = "monthly_withdrawal_limit_exceeded"
+	CodeCoolingOff   = "withdrawal_cooling_off"
+	CodeOrderLimit   = "order_withdrawal_limit_exceeded"
+)
+
+// Rejection is the rule a withdrawal broke.
+type Rejection struct {
+	Code    string
+	Message string
+}
+
+func (r *Rejection) Error() string {
+	return r.Message
+}
+
+var rejectionProblems = map[string]problem.Type{
+	CodeInvalidOrder: problem.InvalidOrder,
+	CodeInvalidSum:   problem.InvalidWithdrawalSum,
+	CodeBelowMinimum: problem.WithdrawalBelowMinimum,
+	CodeAboveMaximum: problem.WithdrawalAboveMaximum,
+	CodeDailyLimit:   problem.DailyWithdrawalLimit,
+	CodeMonthlyLimit: problem.MonthlyWithdrawalLimit,
+	CodeCoolingOff:   problem.WithdrawalCoolingOff,
+	CodeOrderLimit:   problem.OrderWithdrawalLimit,
+}
+
+// Problem is the problem type the APIs answer the rejection with.
+func (r *Rejection) Problem() problem.Type {
+	if t, ok := rejectionProblems[r.Code]; ok {
+		return t
+	}
+	return problem.Internal
+}
+
+// Rules are the limits of a single withdrawal. Zero values disable the
+// limit.
+type Rules struct {
+	MinSum       float64
+	MaxSum       float64
+	DailyLimit   float64
+	MonthlyLimit float64
+	// CoolingOff is how long after registration withdrawals are refused.
+	CoolingOff  time.Duration
+	MaxPerOrder int
+}
+
+// Usage is what the user has already done that the limits depend on.
+// Reversed withdrawals are not counted.
+type Usage struct {
+	RegisteredAt time.Time
+	// WithdrawnToday and WithdrawnThisMonth count from the start of the
+	// calendar day and month.
+	WithdrawnToday     float64
+	WithdrawnThisMonth float64
+	OrderWithdrawals   int
+}
+
+func DefaultRules() Rules {
+	return Rules{}
+}
+
+// RulesFromConfig overrides the defaults with the WITHDRAWAL_* settings
+// that are present in the configuration.
+func RulesFromConfig() Rules {
+	r := DefaultRules()
+
+	if viper.IsSet("WITHDRAWAL_MIN_SUM") {
+		r.MinSum = viper.GetFloat64("WITHDRAWAL_MIN_SUM")
+	}
+	if viper.IsSet("WITHDRAWAL_MAX_SUM") {
+		r.MaxSum = viper.GetFloat64("WITHDRAWAL_MAX_SUM")
+	}
+	if viper.IsSet("WITHDRAWAL_DAILY_LIMIT") {
+		r.DailyLimit = viper.GetFloat64("WITHDRAWAL_DAILY_LIMIT")
+	}
+	if viper.IsSet("WITHDRAWAL_MONTHLY_LIMIT") {
+		r.MonthlyLimit = viper.GetFloat64("WITHDRAWAL_MONTHLY_LIMIT")
+	}
+	if viper.IsSet("WITHDRAWAL_COOLING_OFF") {
+		r.CoolingOff = viper.GetDuration("WITHDRAWAL_COOLING_OFF")
+	}
+	if viper.IsSet("WITHDRAWAL_MAX_PER_ORDER") {
+		r.MaxPerOrder = viper.GetInt("WITHDRAWAL_MAX_PER_ORDER")
+	}
+
+	return r
+}
+
+// CheckRequest applies the rules that need nothing but the request itself,
+// so that malformed requests are refused before the storage is asked.
+func (r Rules) CheckRequest(order string, sum float64) *Rejection {
+	if !validation.Luhn(order) {
+		return &Rejection{Code: CodeInvalidOrder, Message: "order number must be digits passing the Luhn check"}
+	}
+	if sum <= 0 {
+		return &Rejection{Code: CodeInvalidSum, Message: "sum must be positive"}
+	}
+	if r.MinSum > 0 && sum < r.MinSum {
+		return &Rejection{Code: CodeBelowMinimum, Message: fmt.Sprintf("at least %g points must be withdrawn at once", r.MinSum)}
+	}
+	if r.MaxSum > 0 && sum > r.MaxSum {
+		return &Rejection{Code: CodeAboveMaximum, Message: fmt.Sprintf("at most %g points can be withdrawn at once", r.MaxSum)}
+	}
+	return nil
+}
+
+// Check applies all rules, the ones depending on usage last.
+func (r Rules) Check(order string, sum float64, usage Usage, now time.Time) *Rejection {
+	if rejection := r.CheckRequest(order, sum); rejection != nil {
+		return rejection
+	}
+	if r.CoolingOff > 0 && now.Sub(usage.RegisteredAt) < r.CoolingOff {
+		return &Rejection{Code: CodeCoolingOff, Message: "withdrawals are allowed " + r.CoolingOff.String() + " after registration"}
+	}
+	if r.DailyLimit > 0 && usage.WithdrawnToday+sum > r.DailyLimit {
+		return &Rejection{Code: CodeDailyLimit, Message: fmt.Sprintf("at most %g points can be withdrawn a day", r.DailyLimit)}
+	}
+	if r.MonthlyLimit > 0 && usage.WithdrawnThisMonth+sum > r.MonthlyLimit {
+		return &Rejection{Code: CodeMonthlyLimit, Message: fmt.Sprintf("at most %g points can be withdrawn a month", r.MonthlyLimit)}
+	}
+	if r.MaxPerOrder > 0 && usage.OrderWithdrawals >= r.MaxPerOrder {
+		return &Rejection{Code: CodeOrderLimit, Message: fmt.Sprintf("at most %d withdrawals are allowed per order", r.MaxPerOrder)}
+	}
+	return nil
+}
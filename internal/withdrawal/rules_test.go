@@ -0,0 +1,100 @@
+package withdrawal
+
+import (
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRules_Check(t *testing.T) {
+	now := time.Date(2022, 5, 15, 12, 0, 0, 0, time.UTC)
+	rules := Rules{
+		MinSum:       10,
+		MaxSum:       1000,
+		DailyLimit:   1500,
+		MonthlyLimit: 5000,
+		CoolingOff:   7 * 24 * time.Hour,
+		MaxPerOrder:  2,
+	}
+	usage := Usage{
+		RegisteredAt:       now.AddDate(0, -1, 0),
+		WithdrawnToday:     1000,
+		WithdrawnThisMonth: 4000,
+		OrderWithdrawals:   1,
+	}
+
+	tests := []struct {
+		name     string
+		order    string
+		sum      float64
+		usage    func(u Usage) Usage
+		wantCode string
+	}{
+		{name: "allowed", order: "12345678903", sum: 500},
+		{name: "letters in the order", order: "1234567890a", sum: 500, wantCode: CodeInvalidOrder},
+		{name: "Luhn", order: "12345678901", sum: 500, wantCode: CodeInvalidOrder},
+		{name: "zero sum", order: "12345678903", sum: 0, wantCode: CodeInvalidSum},
+		{name: "below minimum", order: "12345678903", sum: 5, wantCode: CodeBelowMinimum},
+		{name: "above maximum", order: "12345678903", sum: 1001, wantCode: CodeAboveMaximum},
+		{name: "daily limit", order: "12345678903", sum: 501, wantCode: CodeDailyLimit},
+		{
+			name:     "monthly limit",
+			order:    "12345678903",
+			sum:      500,
+			usage:    func(u Usage) Usage { u.WithdrawnThisMonth = 4600; return u },
+			wantCode: CodeMonthlyLimit,
+		},
+		{
+			name:     "cooling-off",
+			order:    "12345678903",
+			sum:      500,
+			usage:    func(u Usage) Usage { u.RegisteredAt = now.Add(-time.Hour); return u },
+			wantCode: CodeCoolingOff,
+		},
+		{
+			name:     "withdrawals per order",
+			order:    "12345678903",
+			sum:      500,
+			usage:    func(u Usage) Usage { u.OrderWithdrawals = 2; return u },
+			wantCode: CodeOrderLimit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := usage
+			if tt.usage != nil {
+				u = tt.usage(u)
+			}
+
+			rejection := rules.Check(tt.order, tt.sum, u, now)
+			if tt.wantCode == "" {
+				require.Nil(t, rejection)
+				return
+			}
+			require.NotNil(t, rejection)
+			require.Equal(t, tt.wantCode, rejection.Code)
+		})
+	}
+}
+
+func TestRules_Check_noLimits(t *testing.T) {
+	usage := Usage{WithdrawnToday: 1e6, WithdrawnThisMonth: 1e7, OrderWithdrawals: 100}
+	require.Nil(t, DefaultRules().Check("12345678903", 1e5, usage, time.Now()))
+}
+
+func TestRulesFromConfig(t *testing.T) {
+	defer viper.Reset()
+
+	require.Equal(t, DefaultRules(), RulesFromConfig())
+
+	viper.Set("WITHDRAWAL_MIN_SUM", 10)
+	viper.Set("WITHDRAWAL_COOLING_OFF", "48h")
+	viper.Set("WITHDRAWAL_MAX_PER_ORDER", 1)
+
+	r := RulesFromConfig()
+	require.Equal(t, float64(10), r.MinSum)
+	require.Equal(t, 48*time.Hour, r.CoolingOff)
+	require.Equal(t, 1, r.MaxPerOrder)
+	require.Zero(t, r.DailyLimit)
+}
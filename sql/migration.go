@@ -7,7 +7,8 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/spf13/viper"
-	"log"
+	"log/slog"
+	"os"
 )
 
 func RunMigration() {
@@ -15,16 +16,21 @@ func RunMigration() {
 
 	db, err := sql.Open("pgx", dbAddress)
 	if err != nil {
-		log.Fatal(err)
+		fatal("can't open database", err)
 	}
 	defer db.Close()
 
 	m, err := migrate.New("file://sql/migrations", dbAddress)
 	if err != nil {
-		log.Fatal(err)
+		fatal("can't prepare migrations", err)
 	}
 
 	if err = m.Up(); err != nil && err != migrate.ErrNoChange {
-		log.Fatal(err)
+		fatal("migration failed", err)
 	}
 }
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,6 @@
+-- Идентификатор пользователя --
+ALTER TABLE users ADD COLUMN IF NOT EXISTS id BIGSERIAL;
+
+-- Заказы и списания привязываются к идентификатору, а не к логину --
+UPDATE orders SET user_id = users.id::text FROM users WHERE orders.user_id = users.login;
+UPDATE withdrawals_history SET user_id = users.id::text FROM users WHERE withdrawals_history.user_id = users.login;
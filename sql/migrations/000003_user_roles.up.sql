@@ -0,0 +1,2 @@
+-- Роль пользователя: user, support или admin --
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'user';
@@ -0,0 +1,22 @@
+-- Сессии пользователей: одна строка на каждый вход --
+CREATE TABLE IF NOT EXISTS sessions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    token VARCHAR(255) UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMP
+                                    );
+
+INSERT INTO sessions (user_id, token)
+SELECT id::text, token FROM users WHERE token IS NOT NULL AND token != ''
+ON CONFLICT DO NOTHING;
+
+-- Одноразовые токены сброса пароля, хранятся только их хеши --
+CREATE TABLE IF NOT EXISTS password_resets (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+                                           );
@@ -0,0 +1,23 @@
+-- Двухфакторная аутентификация: секрет TOTP хранится зашифрованным --
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT false;
+
+-- Коды восстановления, хранятся только их хеши --
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP
+                                          );
+
+-- Второй шаг входа: сессия создаётся только после проверки кода --
+CREATE TABLE IF NOT EXISTS login_challenges (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    challenge_hash VARCHAR(64) UNIQUE NOT NULL,
+    token VARCHAR(255) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+                                            );
@@ -0,0 +1,12 @@
+-- API-ключи партнёров: секрет подписи хранится зашифрованным --
+CREATE TABLE IF NOT EXISTS api_keys (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    secret TEXT NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    usage_count BIGINT NOT NULL DEFAULT 0
+                                    );
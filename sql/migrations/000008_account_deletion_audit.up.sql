@@ -0,0 +1,14 @@
+-- Удалённые пользователи обезличиваются, записи остаются для учёта --
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+-- Журнал действий с персональными данными --
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+                                    );
+
+CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log (user_id);
@@ -0,0 +1,6 @@
+-- Время последней смены статуса заказа --
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP;
+
+UPDATE orders SET status_changed_at = uploaded_at WHERE status_changed_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS withdrawals_history_order_number_idx ON withdrawals_history (order_number);
@@ -0,0 +1,16 @@
+-- Идентификатор списания и отметка об отмене --
+ALTER TABLE withdrawals_history ADD COLUMN IF NOT EXISTS id BIGSERIAL PRIMARY KEY;
+ALTER TABLE withdrawals_history ADD COLUMN IF NOT EXISTS reversed_at TIMESTAMP;
+
+-- Компенсирующие записи об отмене списаний, не больше одной на списание --
+CREATE TABLE IF NOT EXISTS withdrawal_reversals (
+    id BIGSERIAL PRIMARY KEY,
+    withdrawal_id BIGINT NOT NULL UNIQUE REFERENCES withdrawals_history (id),
+    user_id VARCHAR(255) NOT NULL,
+    order_number VARCHAR(255) NOT NULL,
+    sum FLOAT NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+                                                );
+
+CREATE INDEX IF NOT EXISTS withdrawal_reversals_user_id_idx ON withdrawal_reversals (user_id);
@@ -0,0 +1,20 @@
+-- Дата регистрации пользователя, для старых записей - первая загрузка заказа --
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMP;
+UPDATE users SET created_at = COALESCE(
+    (SELECT MIN(uploaded_at) FROM orders WHERE orders.user_id = users.id::text),
+    'epoch'
+) WHERE created_at IS NULL;
+ALTER TABLE users ALTER COLUMN created_at SET DEFAULT now();
+ALTER TABLE users ALTER COLUMN created_at SET NOT NULL;
+
+-- Переводы баллов между пользователями --
+CREATE TABLE IF NOT EXISTS transfers (
+    id BIGSERIAL PRIMARY KEY,
+    sender_id VARCHAR(255) NOT NULL,
+    recipient_id VARCHAR(255) NOT NULL,
+    sum FLOAT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+                                     );
+
+CREATE INDEX IF NOT EXISTS transfers_sender_id_idx ON transfers (sender_id, created_at);
+CREATE INDEX IF NOT EXISTS transfers_recipient_id_idx ON transfers (recipient_id);
@@ -0,0 +1,10 @@
+-- События пользователя для потока /api/user/events, id служит Last-Event-ID --
+CREATE TABLE IF NOT EXISTS user_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    type VARCHAR(64) NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+                                       );
+
+CREATE INDEX IF NOT EXISTS user_events_user_id_idx ON user_events (user_id, id);
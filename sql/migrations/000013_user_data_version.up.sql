@@ -0,0 +1,27 @@
+-- Версия данных пользователя для ETag, растёт при любом изменении заказов, списаний и переводов --
+ALTER TABLE users ADD COLUMN IF NOT EXISTS data_version BIGINT NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION bump_user_data_version() RETURNS trigger AS $$
+BEGIN
+    IF TG_TABLE_NAME = 'transfers' THEN
+        UPDATE users SET data_version = data_version + 1 WHERE id::text IN (NEW.sender_id, NEW.recipient_id);
+    ELSIF TG_OP = 'DELETE' THEN
+        UPDATE users SET data_version = data_version + 1 WHERE id::text = OLD.user_id;
+    ELSE
+        UPDATE users SET data_version = data_version + 1 WHERE id::text = NEW.user_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orders_data_version ON orders;
+CREATE TRIGGER orders_data_version AFTER INSERT OR UPDATE OR DELETE ON orders
+    FOR EACH ROW EXECUTE PROCEDURE bump_user_data_version();
+
+DROP TRIGGER IF EXISTS withdrawals_history_data_version ON withdrawals_history;
+CREATE TRIGGER withdrawals_history_data_version AFTER INSERT OR UPDATE OR DELETE ON withdrawals_history
+    FOR EACH ROW EXECUTE PROCEDURE bump_user_data_version();
+
+DROP TRIGGER IF EXISTS transfers_data_version ON transfers;
+CREATE TRIGGER transfers_data_version AFTER INSERT ON transfers
+    FOR EACH ROW EXECUTE PROCEDURE bump_user_data_version();
@@ -0,0 +1,2 @@
+-- Уникальный индекс по идентификатору пользователя: по нему ищут сессии, переводы, лимиты и триггеры --
+CREATE UNIQUE INDEX IF NOT EXISTS users_id_idx ON users (id);
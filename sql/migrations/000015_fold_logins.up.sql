@@ -0,0 +1,41 @@
+-- Логины приводятся к нижнему регистру, как их нормализует validation.NormalizeLogin. --
+-- Логин хранится в base64 (URL-алфавит), поэтому он раскодируется, приводится и кодируется обратно --
+CREATE TEMPORARY TABLE login_folding AS
+SELECT id,
+       login AS old_login,
+       lower(btrim(convert_from(decode(translate(login, '-_', '+/'), 'base64'), 'UTF8'))) AS folded
+FROM users
+WHERE deleted_at IS NULL
+  AND login ~ '^[A-Za-z0-9_-]+={0,2}$'
+  AND length(login) % 4 = 0;
+
+ALTER TABLE login_folding ADD COLUMN folded_login VARCHAR(255);
+ALTER TABLE login_folding ADD COLUMN new_login VARCHAR(255);
+
+UPDATE login_folding
+SET folded_login = translate(replace(encode(convert_to(folded, 'UTF8'), 'base64'), E'\n', ''), '+/', '-_');
+
+-- Из совпавших после приведения логинов его получает пользователь, у которого он уже такой, --
+-- иначе самый ранний; остальные получают логин с суффиксом -<id> --
+UPDATE login_folding f
+SET new_login = CASE
+    WHEN f.id = (
+        SELECT g.id FROM login_folding g
+        WHERE g.folded = f.folded
+        ORDER BY g.old_login = g.folded_login DESC, g.id
+        LIMIT 1
+    ) THEN f.folded_login
+    ELSE translate(replace(encode(convert_to(f.folded || '-' || f.id, 'UTF8'), 'base64'), E'\n', ''), '+/', '-_')
+END;
+
+UPDATE users SET login = f.new_login
+FROM login_folding f
+WHERE users.id = f.id AND users.login != f.new_login;
+
+-- Переименования записываются в журнал, чтобы поддержка могла сообщить новый логин --
+INSERT INTO audit_log (user_id, actor, action, details)
+SELECT id::text, 'migration', 'login_renamed', folded || '-' || id
+FROM login_folding
+WHERE new_login != folded_login;
+
+DROP TABLE login_folding;
@@ -0,0 +1,2 @@
+-- Последний принятый шаг TOTP: код того же или более раннего шага повторно не принимается --
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_counter BIGINT;
@@ -0,0 +1,16 @@
+-- Согласие пользователя на доступ партнёра с API-ключом к его данным --
+CREATE TABLE IF NOT EXISTS api_key_grants (
+    api_key_id VARCHAR(64) NOT NULL REFERENCES api_keys (id),
+    user_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (api_key_id, user_id)
+                                          );
+
+-- Подписи принятых запросов партнёров: повтор запроса отклоняется, пока не истечёт API_KEY_MAX_SKEW --
+CREATE TABLE IF NOT EXISTS api_key_requests (
+    api_key_id VARCHAR(64) NOT NULL,
+    signature VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (api_key_id, signature)
+                                            );
+CREATE INDEX IF NOT EXISTS api_key_requests_expires_at_idx ON api_key_requests (expires_at);
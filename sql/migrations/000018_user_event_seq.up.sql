@@ -0,0 +1,16 @@
+-- Номер события растёт по каждому пользователю и выдаётся под блокировкой строки пользователя, --
+-- поэтому события фиксируются в порядке номеров. Старые события сохраняют id как номер, --
+-- чтобы Last-Event-ID уже подключённых клиентов оставался верным --
+ALTER TABLE users ADD COLUMN IF NOT EXISTS event_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE user_events ADD COLUMN IF NOT EXISTS seq BIGINT;
+
+UPDATE user_events SET seq = id WHERE seq IS NULL;
+UPDATE users u SET event_seq = e.seq
+FROM (SELECT user_id, MAX(seq) AS seq FROM user_events GROUP BY user_id) e
+WHERE u.id = e.user_id::bigint;
+
+ALTER TABLE user_events ALTER COLUMN seq SET NOT NULL;
+
+DROP INDEX IF EXISTS user_events_user_id_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS user_events_user_seq_idx ON user_events (user_id, seq);
+CREATE INDEX IF NOT EXISTS user_events_created_at_idx ON user_events (created_at);
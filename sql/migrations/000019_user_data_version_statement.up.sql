@@ -0,0 +1,55 @@
+-- Версия данных растёт один раз на пользователя за оператор. Пользователи блокируются по возрастанию id, --
+-- как в переводах, поэтому триггер не создаёт взаимных блокировок; поиск идёт по индексу users.id --
+CREATE OR REPLACE FUNCTION bump_user_data_version() RETURNS trigger AS $$
+DECLARE
+    ids BIGINT[];
+BEGIN
+    IF TG_TABLE_NAME = 'transfers' THEN
+        SELECT array_agg(DISTINCT u.id) INTO ids
+        FROM new_rows, LATERAL (VALUES (new_rows.sender_id::bigint), (new_rows.recipient_id::bigint)) AS u(id);
+    ELSIF TG_OP = 'DELETE' THEN
+        SELECT array_agg(DISTINCT user_id::bigint) INTO ids FROM old_rows;
+    ELSIF TG_OP = 'UPDATE' THEN
+        SELECT array_agg(DISTINCT c.user_id::bigint) INTO ids
+        FROM (SELECT user_id FROM new_rows UNION SELECT user_id FROM old_rows) c;
+    ELSE
+        SELECT array_agg(DISTINCT user_id::bigint) INTO ids FROM new_rows;
+    END IF;
+
+    IF ids IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    PERFORM 1 FROM users WHERE id = ANY (ids) ORDER BY id FOR UPDATE;
+    UPDATE users SET data_version = data_version + 1 WHERE id = ANY (ids);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Таблицы переходов допускаются только у триггеров на одно событие --
+DROP TRIGGER IF EXISTS orders_data_version ON orders;
+CREATE TRIGGER orders_data_version_insert AFTER INSERT ON orders
+    REFERENCING NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE PROCEDURE bump_user_data_version();
+CREATE TRIGGER orders_data_version_update AFTER UPDATE ON orders
+    REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE PROCEDURE bump_user_data_version();
+CREATE TRIGGER orders_data_version_delete AFTER DELETE ON orders
+    REFERENCING OLD TABLE AS old_rows
+    FOR EACH STATEMENT EXECUTE PROCEDURE bump_user_data_version();
+
+DROP TRIGGER IF EXISTS withdrawals_history_data_version ON withdrawals_history;
+CREATE TRIGGER withdrawals_history_data_version_insert AFTER INSERT ON withdrawals_history
+    REFERENCING NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE PROCEDURE bump_user_data_version();
+CREATE TRIGGER withdrawals_history_data_version_update AFTER UPDATE ON withdrawals_history
+    REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE PROCEDURE bump_user_data_version();
+CREATE TRIGGER withdrawals_history_data_version_delete AFTER DELETE ON withdrawals_history
+    REFERENCING OLD TABLE AS old_rows
+    FOR EACH STATEMENT EXECUTE PROCEDURE bump_user_data_version();
+
+DROP TRIGGER IF EXISTS transfers_data_version ON transfers;
+CREATE TRIGGER transfers_data_version AFTER INSERT ON transfers
+    REFERENCING NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE PROCEDURE bump_user_data_version();
@@ -0,0 +1,5 @@
+-- До исправления EncodeData отбрасывал последние один-два байта логина и пароля. --
+-- Отброшенное не восстановить, поэтому такие строки помечаются: для них принимается и усечённая форма, --
+-- а при входе логин и пароль перезаписываются полностью --
+ALTER TABLE users ADD COLUMN IF NOT EXISTS legacy_encoding BOOLEAN NOT NULL DEFAULT false;
+UPDATE users SET legacy_encoding = true WHERE login NOT LIKE '%=';
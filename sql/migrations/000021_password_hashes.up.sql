@@ -0,0 +1,8 @@
+-- Пароли хранятся хешами bcrypt. Имеющиеся пароли хешируются в той base64-форме, в которой хранились, --
+-- password_encoded отмечает такие хеши; при входе пароль хешируется заново уже сам --
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_encoded BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE users SET password = crypt(password, gen_salt('bf', 10)), password_encoded = true
+WHERE password IS NOT NULL AND password != '';
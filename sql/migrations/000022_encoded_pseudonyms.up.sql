@@ -0,0 +1,6 @@
+-- Псевдонимы удалённых учётных записей хранились без EncodeData, в отличие от остальных логинов. --
+-- Они кодируются так же, как логины (base64 с URL-алфавитом) --
+UPDATE users
+SET login = translate(encode(convert_to(login, 'UTF8'), 'base64'), '+/', '-_'),
+    legacy_encoding = false
+WHERE deleted_at IS NOT NULL AND login LIKE 'deleted-%';